@@ -0,0 +1,44 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Duration is a time.Duration that is written to and read from config json as a string, e.g "30s" or "2m"
+type Duration time.Duration
+
+// Never is written as "never", for settings that can be turned off, e.g an idle_timeout that keeps the function warm
+const Never Duration = math.MinInt64
+
+// Std returns the duration as a time.Duration
+func (d Duration) Std() time.Duration {
+	return time.Duration(d)
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	if d == Never {
+		return json.Marshal("never")
+	}
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like '30s' or '2m': %v", err)
+	}
+	if s == "never" {
+		*d = Never
+		return nil
+	}
+
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration '%s': %v", s, err)
+	}
+	*d = Duration(parsed)
+	return nil
+}
@@ -0,0 +1,35 @@
+package data
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDurationJSON(t *testing.T) {
+	var config AutoscalingConfig
+	err := json.Unmarshal([]byte(`{"scale_up_cooldown":"15s","stabilization_window":"2m"}`), &config)
+	assert.NoError(t, err)
+	assert.Equal(t, 15*time.Second, config.ScaleUpCooldown.Std())
+	assert.Equal(t, 2*time.Minute, config.StabilizationWindow.Std())
+
+	out, err := json.Marshal(config)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"scale_up_cooldown":"15s","stabilization_window":"2m0s"}`, string(out))
+
+	err = json.Unmarshal([]byte(`{"scale_up_cooldown":"soon"}`), &config)
+	assert.Error(t, err)
+}
+
+func TestDurationNeverJSON(t *testing.T) {
+	var config FunctionConfig
+	err := json.Unmarshal([]byte(`{"idle_timeout":"never"}`), &config)
+	assert.NoError(t, err)
+	assert.Equal(t, Never, config.IdleTimeout)
+
+	out, err := json.Marshal(config)
+	assert.NoError(t, err)
+	assert.Contains(t, string(out), `"idle_timeout":"never"`)
+}
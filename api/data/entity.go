@@ -18,4 +18,160 @@ type FunctionConfig struct {
 	Type    string            `json:"type"`
 	Port    *int              `json:"port,omitempty"`
 	EnvVars map[string]string `json:"env_vars,omitempty"`
+
+	// Scaling options, zero values fall back to the defaults of the instance pool
+	MinInstances      int                `json:"min_instances,omitempty"`
+	MaxInstances      int                `json:"max_instances,omitempty"`
+	ConcurrencyTarget int                `json:"concurrency_target,omitempty"`
+	Autoscaling       *AutoscalingConfig `json:"autoscaling,omitempty"`
+	// MaxConcurrency is the most requests a single instance serves at once, further requests wait in a queue. 0 is unlimited.
+	MaxConcurrency int          `json:"max_concurrency,omitempty" example:"2"`
+	Queue          *QueueConfig `json:"queue,omitempty"`
+
+	// IdleTimeout is how long the function can go without requests before its instances are stopped,
+	// e.g "2m", or "never" to keep it warm. Empty uses the server default.
+	IdleTimeout Duration `json:"idle_timeout,omitempty" swaggertype:"string" example:"2m"`
+	// WarmInstances are started when jambda boots and after every deploy, and are never stopped when idle
+	WarmInstances int `json:"warm_instances,omitempty"`
+
+	HealthCheck *HealthCheckConfig `json:"health_check,omitempty"`
+
+	// Isolation is "container" by default, or "vm" to run the function's binary in its own microVM instead of sharing the host kernel
+	Isolation string `json:"isolation,omitempty" example:"container"`
+	// RateLimit rejects requests over a rate or daily quota before they reach the function
+	RateLimit *RateLimitConfig `json:"rate_limit,omitempty"`
+	// Timeout bounds the wait for the function to start responding, e.g "30s". Streamed responses aren't cut off once started. Empty uses the server default.
+	// WebSocket connections are not bounded.
+	Timeout Duration `json:"timeout,omitempty" swaggertype:"string" example:"30s"`
+	// MaxRequestBody and MaxResponseBody limit the size of bodies in bytes, 0 is unlimited
+	MaxRequestBody  int64 `json:"max_request_body,omitempty" example:"1048576"`
+	MaxResponseBody int64 `json:"max_response_body,omitempty" example:"10485760"`
+	// Cache serves repeated GET and HEAD requests from responses cached at the gateway, without waking the function
+	Cache *CacheConfig `json:"cache,omitempty"`
+	// Retry resends idempotent requests that failed to reach an instance
+	Retry *RetryConfig `json:"retry,omitempty"`
+	// CircuitBreaker fails requests fast while the function's instances keep failing to respond
+	CircuitBreaker *CircuitBreakerConfig `json:"circuit_breaker,omitempty"`
+	// Transform rewrites the headers and path of requests to the function, and the headers of its responses
+	Transform *TransformConfig `json:"transform,omitempty"`
+	// Version labels the deployed function, e.g "1.4.2", and is sent to it when transform.inject_headers is set
+	Version string `json:"version,omitempty" example:"1.4.2"`
+}
+
+// HealthCheckConfig controls how jambda decides an instance is ready, and still alive once it is serving requests
+type HealthCheckConfig struct {
+	// Path is requested on the instance, defaults to "/health"
+	Path string `json:"path,omitempty" example:"/health"`
+	// ExpectedStatus is the status code of a healthy response, defaults to 200
+	ExpectedStatus int `json:"expected_status,omitempty" example:"200"`
+	// TCPOnly only checks the function port accepts connections, for functions without a health route
+	TCPOnly        bool     `json:"tcp_only,omitempty"`
+	InitialDelay   Duration `json:"initial_delay,omitempty" swaggertype:"string" example:"0s"`
+	Interval       Duration `json:"interval,omitempty" swaggertype:"string" example:"2s"`
+	Timeout        Duration `json:"timeout,omitempty" swaggertype:"string" example:"2s"`
+	MaxStartupTime Duration `json:"max_startup_time,omitempty" swaggertype:"string" example:"30s"`
+	// LivenessInterval is how often running instances are checked, defaults to "30s"
+	LivenessInterval Duration `json:"liveness_interval,omitempty" swaggertype:"string" example:"30s"`
+	// FailureThreshold is the consecutive failed liveness checks before an instance is restarted, defaults to 3
+	FailureThreshold int `json:"failure_threshold,omitempty" example:"3"`
+}
+
+const (
+	IsolationContainer = "container"
+	// IsolationVM runs each instance in a microVM, for functions uploaded by less trusted users
+	IsolationVM = "vm"
+)
+
+// QueueConfig bounds the FIFO queue of requests waiting for an instance below max_concurrency
+type QueueConfig struct {
+	// MaxSize is the most requests waiting at once, defaults to 100
+	MaxSize int `json:"max_size,omitempty" example:"100"`
+	// MaxWait is how long a request waits before it gets a 503, defaults to "30s"
+	MaxWait Duration `json:"max_wait,omitempty" swaggertype:"string" example:"30s"`
+}
+
+// CacheConfig caches the function's responses to GET requests in memory
+type CacheConfig struct {
+	// TTL is how long responses are cached, unless the function's Cache-Control max-age or s-maxage says otherwise
+	TTL Duration `json:"ttl" swaggertype:"string" example:"1h"`
+	// Vary are the request headers that get their own cached responses, e.g "Accept"
+	Vary []string `json:"vary,omitempty" example:"Accept"`
+}
+
+// RetryConfig retries idempotent requests without a body that failed at the connection level, e.g the instance refused or reset the connection
+type RetryConfig struct {
+	// Attempts is the number of retries after the first attempt
+	Attempts int `json:"attempts" example:"2"`
+	// Backoff is the wait before the first retry, doubling for each retry after it, defaults to "100ms". Waits are jittered.
+	Backoff Duration `json:"backoff,omitempty" swaggertype:"string" example:"100ms"`
+	// MaxBackoff caps the wait between retries, defaults to "2s"
+	MaxBackoff Duration `json:"max_backoff,omitempty" swaggertype:"string" example:"2s"`
+}
+
+// CircuitBreakerConfig opens the function's circuit after consecutive connection failures, rejecting requests with a 503
+// and recreating the failing containers, until a trial request succeeds after OpenDuration
+type CircuitBreakerConfig struct {
+	// FailureThreshold is the consecutive failed requests, after retries, that open the circuit
+	FailureThreshold int `json:"failure_threshold" example:"5"`
+	// OpenDuration is how long requests are rejected before a trial request is let through, defaults to "30s"
+	OpenDuration Duration `json:"open_duration,omitempty" swaggertype:"string" example:"30s"`
+}
+
+// TransformConfig is the header policy of a function. Hop-by-hop headers are always stripped.
+type TransformConfig struct {
+	// Request rules apply after jambda sets the X-Forwarded-* and X-Real-IP headers, so they can be renamed or removed
+	Request HeaderRules `json:"request,omitempty"`
+	// Response rules apply to the function's responses before they reach the client
+	Response HeaderRules `json:"response,omitempty"`
+	// PathRewrites replace the prefix of the forwarded path with the first rewrite that matches
+	PathRewrites []PathRewrite `json:"path_rewrites,omitempty"`
+	// InjectHeaders sends the X-Jambda-Function-Id, X-Jambda-Function-Version and X-Jambda-Invocation-Id headers to the function
+	InjectHeaders bool `json:"inject_headers,omitempty"`
+	// StripSensitiveHeaders drops the client's credentials from requests, and headers revealing the function's server from responses
+	StripSensitiveHeaders bool `json:"strip_sensitive_headers,omitempty"`
+}
+
+// HeaderRules are applied in order, renaming, then removing, then adding headers
+type HeaderRules struct {
+	// Rename moves the values of headers to new names, e.g {"X-Api-Key": "X-Client-Key"}
+	Rename map[string]string `json:"rename,omitempty"`
+	Remove []string          `json:"remove,omitempty"`
+	// Add sets headers, replacing any values they have
+	Add map[string]string `json:"add,omitempty"`
+}
+
+// PathRewrite replaces the From prefix of paths forwarded to the function with To, e.g "/v1" with "/api/v1"
+type PathRewrite struct {
+	From string `json:"from" example:"/v1"`
+	To   string `json:"to" example:"/api/v1"`
+}
+
+// RateLimitConfig limits how often clients can invoke a function. Rejected requests don't start or keep instances warm.
+type RateLimitConfig struct {
+	// RPS is the sustained requests per second allowed for each key, 0 disables the rate limit
+	RPS float64 `json:"rps,omitempty" example:"5"`
+	// Burst is the requests allowed at once before RPS applies, defaults to RPS rounded up
+	Burst int `json:"burst,omitempty" example:"10"`
+	// Key is what requests are limited by, "function" for every client together (default), "ip" or "api_key"
+	Key string `json:"key,omitempty" example:"ip"`
+	// APIKeys are the X-Api-Key values limited separately with the "api_key" key, requests with any other key are limited by their ip
+	APIKeys []string `json:"api_keys,omitempty"`
+	// DailyQuota is the requests allowed for each key per UTC day, 0 is unlimited
+	DailyQuota int `json:"daily_quota,omitempty" example:"10000"`
+}
+
+const (
+	RateLimitKeyFunction = "function"
+	RateLimitKeyIP       = "ip"
+	// RateLimitKeyAPIKey limits by the X-Api-Key header when it's one of the APIKeys, falling back to the client ip
+	RateLimitKeyAPIKey = "api_key"
+)
+
+// AutoscalingConfig tunes how the autoscaler moves a function between min_instances and max_instances
+type AutoscalingConfig struct {
+	// TargetRPS is the requests per second a single instance should serve, 0 scales on concurrency only
+	TargetRPS           float64  `json:"target_rps,omitempty"`
+	ScaleUpCooldown     Duration `json:"scale_up_cooldown,omitempty" swaggertype:"string" example:"10s"`
+	ScaleDownCooldown   Duration `json:"scale_down_cooldown,omitempty" swaggertype:"string" example:"30s"`
+	StabilizationWindow Duration `json:"stabilization_window,omitempty" swaggertype:"string" example:"1m"`
 }
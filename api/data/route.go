@@ -0,0 +1,20 @@
+package data
+
+import "time"
+
+// RouteEntity sends requests for a host and/or path prefix to a function, so clients don't need to know its id
+type RouteEntity struct {
+	ID int `json:"id"`
+	// Host matches the request's Host header, empty matches any host
+	Host string `json:"host,omitempty" example:"api.home.lan"`
+	// PathPrefix matches the request path on segment boundaries, defaults to "/"
+	PathPrefix string `json:"path_prefix" example:"/weather"`
+	// FunctionId is the function requests are sent to
+	FunctionId string `json:"function_id,omitempty" example:"ab12cd34"`
+	// FunctionName is an alias for the active function with this name, so the route keeps working when the function is recreated
+	FunctionName string `json:"function_name,omitempty" example:"weather"`
+	// KeepPrefix forwards the full path to the function, by default the path prefix is removed
+	KeepPrefix bool      `json:"keep_prefix,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
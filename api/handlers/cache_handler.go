@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/jwtly10/jambda/internal/logging"
+	"github.com/jwtly10/jambda/internal/service"
+	"github.com/jwtly10/jambda/internal/utils"
+)
+
+type CacheHandler struct {
+	log     logging.Logger
+	service *service.ResponseCacheService
+}
+
+func NewCacheHandler(l logging.Logger, rc *service.ResponseCacheService) *CacheHandler {
+	return &CacheHandler{
+		log:     l,
+		service: rc,
+	}
+}
+
+// @Summary Purge the cached responses of a function
+// @Description Removes every response of the function cached by the gateway, so the next requests reach the function. Responses are also purged when the function is updated or deleted.
+// @Tags Functions
+// @Produce application/json
+// @Param id path string true "Function ID"
+// @Success 200 {object} service.CachePurge "Number of cached responses purged"
+// @Failure 400 {object} utils.ErrorResponse "Bad Request"
+// @Router /function/{id}/cache [delete]
+func (ch *CacheHandler) PurgeCache(w http.ResponseWriter, r *http.Request) {
+	externalId := r.PathValue("id")
+	if externalId == "" {
+		utils.HandleBadRequest(w, fmt.Errorf("error parsing externalId from URL"))
+		return
+	}
+
+	res := service.CachePurge{
+		FunctionId: externalId,
+		Purged:     ch.service.Purge(externalId),
+	}
+
+	jsonResponse, err := json.Marshal(res)
+	if err != nil {
+		ch.log.Error("Error marshaling cache purge to JSON: ", err)
+		utils.HandleInternalError(w, fmt.Errorf("error marshalling response json: %v", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonResponse)
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/jwtly10/jambda/internal/errors"
+	"github.com/jwtly10/jambda/internal/logging"
+	"github.com/jwtly10/jambda/internal/service"
+	"github.com/jwtly10/jambda/internal/utils"
+)
+
+type ContainerHandler struct {
+	log      logging.Logger
+	registry *service.ContainerRegistry
+	backend  service.ExecutionBackend
+}
+
+func NewContainerHandler(l logging.Logger, cr *service.ContainerRegistry, backend service.ExecutionBackend) *ContainerHandler {
+	return &ContainerHandler{
+		log:      l,
+		registry: cr,
+		backend:  backend,
+	}
+}
+
+// @Summary Get the containers of a function
+// @Description Returns the state, host ports and start time of every container of a function as last reported by docker, along with its most recent crashes and OOM kills.
+// @Tags Functions
+// @Produce application/json
+// @Param id path string true "Function ID"
+// @Success 200 {object} service.FunctionContainers "Containers and recent crashes of the function"
+// @Failure 400 {object} utils.ErrorResponse "Bad Request"
+// @Router /function/{id}/containers [get]
+func (ch *ContainerHandler) GetFunctionContainers(w http.ResponseWriter, r *http.Request) {
+	externalId := r.PathValue("id")
+	if externalId == "" {
+		utils.HandleBadRequest(w, fmt.Errorf("error parsing externalId from URL"))
+		return
+	}
+
+	containers := ch.registry.GetFunctionContainers(externalId)
+
+	jsonResponse, err := json.Marshal(containers)
+	if err != nil {
+		ch.log.Error("Error marshaling containers to JSON: ", err)
+		utils.HandleInternalError(w, fmt.Errorf("error marshalling response json: %v", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonResponse)
+}
+
+// @Summary Get the logs of a container
+// @Description Returns the stdout and stderr of a single container of a function, from whichever execution backend it runs on.
+// @Tags Functions
+// @Produce text/plain
+// @Param id path string true "Function ID"
+// @Param containerId path string true "Container ID"
+// @Param tail query int false "Number of lines from the end of the logs to return, defaults to all"
+// @Success 200 {string} string "Container logs"
+// @Failure 400 {object} utils.ErrorResponse "Bad Request"
+// @Failure 404 {object} utils.ErrorResponse "Not Found"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Router /function/{id}/containers/{containerId}/logs [get]
+func (ch *ContainerHandler) GetContainerLogs(w http.ResponseWriter, r *http.Request) {
+	externalId := r.PathValue("id")
+	containerId := r.PathValue("containerId")
+	if externalId == "" || containerId == "" {
+		utils.HandleBadRequest(w, fmt.Errorf("error parsing externalId or containerId from URL"))
+		return
+	}
+
+	tail := 0
+	if tailParam := r.URL.Query().Get("tail"); tailParam != "" {
+		var err error
+		tail, err = strconv.Atoi(tailParam)
+		if err != nil || tail < 0 {
+			utils.HandleValidationError(w, fmt.Errorf("tail must be a positive number"))
+			return
+		}
+	}
+
+	// Only serve logs for containers of the requested function
+	if record, found := ch.registry.GetContainer(containerId); found && record.FunctionId != externalId {
+		utils.HandleCustomErrors(w, errors.NewNotFoundError(fmt.Sprintf("container '%s' not found for function '%s'", containerId, externalId)))
+		return
+	}
+
+	logs, err := ch.backend.Logs(r.Context(), containerId, tail)
+	if err != nil {
+		ch.log.Errorf("Failed to get logs of container '%s': %v", containerId, err)
+		utils.HandleCustomErrors(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(logs))
+}
@@ -166,6 +166,29 @@ func (nfh *FunctionHandler) DeleteFunction(w http.ResponseWriter, r *http.Reques
 	return
 }
 
+// @Summary Download a function's artifact
+// @Description Downloads the uploaded binary or jar of a function, used by the kubernetes backend to deliver it to pods.
+// @Tags Functions
+// @Produce application/octet-stream
+// @Param id path string true "Function ID"
+// @Success 200 {file} file "Function artifact"
+// @Failure 404 {object} utils.ErrorResponse "Not Found"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Router /function/{id}/artifact [get]
+func (nfh *FunctionHandler) GetArtifact(w http.ResponseWriter, r *http.Request) {
+	externalId := r.PathValue("id")
+
+	path, err := nfh.service.GetArtifactPath(externalId)
+	if err != nil {
+		nfh.log.Error("Failed to get function artifact: ", err)
+		utils.HandleCustomErrors(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	http.ServeFile(w, r, path)
+}
+
 func getIdFromUrl(url *url.URL) (string, error) {
 	pathParts := strings.Split(url.Path, "/")
 	// Assuming the URL pattern is v1/api/function/{id} and split should return 5 parts
@@ -1,43 +1,96 @@
 package handlers
 
 import (
+	"context"
+	stderrors "errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"strings"
+	"time"
 
+	"github.com/google/uuid"
+	"github.com/jwtly10/jambda/api/data"
 	"github.com/jwtly10/jambda/internal/logging"
 	"github.com/jwtly10/jambda/internal/service"
 	"github.com/jwtly10/jambda/internal/utils"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
 
+// proxyFlushInterval is how often buffered response bodies are flushed to the client.
+// Server-sent events and chunked responses of unknown length are always flushed straight away.
+const proxyFlushInterval = 100 * time.Millisecond
+
+// proxyTargetKey holds the url a request is proxied to in its context
+type proxyTargetKey struct{}
+
+// invocationKey holds the service.Invocation a request is proxied as in its context
+type invocationKey struct{}
+
+// maxResponseBodyKey holds the function's max_response_body in the context of requests that have one
+type maxResponseBodyKey struct{}
+
+// responseTimerKey holds the timer cancelling a request when its instance hasn't responded within the function's timeout
+type responseTimerKey struct{}
+
+// responseTooLargeError is returned when an instance's response is larger than the function's max_response_body
+type responseTooLargeError struct {
+	limit int64
+}
+
+func (e *responseTooLargeError) Error() string {
+	return fmt.Sprintf("function response is larger than its max_response_body of %d bytes", e.limit)
+}
+
 type GatewayHandler struct {
 	log     logging.Logger
-	service service.GatewayService
+	service *service.GatewayService
+	proxy   *httputil.ReverseProxy
 }
 
-func NewGatewayHandler(l logging.Logger, gs service.GatewayService) *GatewayHandler {
-	return &GatewayHandler{
+func NewGatewayHandler(l logging.Logger, gs *service.GatewayService) *GatewayHandler {
+	gwh := &GatewayHandler{
 		log:     l,
 		service: gs,
 	}
+	gwh.proxy = &httputil.ReverseProxy{
+		Rewrite: rewriteToInstance,
+		// Each proxied request gets a client span, whose W3C trace context is sent on to the function
+		Transport: otelhttp.NewTransport(gs, otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			return "upstream " + r.Method
+		})),
+		FlushInterval:  proxyFlushInterval,
+		ErrorHandler:   gwh.handleProxyError,
+		ModifyResponse: modifyResponse,
+	}
+	return gwh
 }
 
 // @Summary Make request to a REST function
-// @Description Proxies requests to docker instance running executable. Method passed to instance forwarded from req. Middleware figures out the instance URL to proxy the request to, based on ExternalId. Returns proxied response.
+// @Description Proxies requests to docker instance running executable. Method passed to instance forwarded from req. Middleware figures out the instance URL to proxy the request to, based on ExternalId. Returns proxied response. Server-sent events, streamed responses and WebSocket upgrades are passed through.
 // @Tags Executions
 // @Accept plain
 // @Produce */*
 // @Param id path string true "External ID"
+// @Param path path string true "Path forwarded to the function"
 // @Success 200 {string} string "Request successfully proxied and processed"
 // @Failure 400 {object} utils.ErrorResponse "Bad Request"
+// @Failure 413 {object} utils.ErrorResponse "Request body larger than the function's max_request_body"
 // @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
-// @Router /execute/{id}/ [post]
-// @Router /execute/{id}/ [get]
-// @Router /execute/{id}/ [put]
-// @Router /execute/{id}/ [delete]
+// @Failure 502 {object} utils.ErrorResponse "Function instance unavailable, or its response is larger than max_response_body"
+// @Failure 504 {object} utils.ErrorResponse "Function instance did not respond within the function's timeout"
+// @Router /execute/{id}/{path} [post]
+// @Router /execute/{id}/{path} [get]
+// @Router /execute/{id}/{path} [put]
+// @Router /execute/{id}/{path} [patch]
+// @Router /execute/{id}/{path} [delete]
+// @Router /execute/{id}/{path} [head]
+// @Router /execute/{id}/{path} [options]
 func (gwh *GatewayHandler) ProxyToInstance(w http.ResponseWriter, r *http.Request) {
+	log := logging.FromContext(r.Context(), gwh.log)
 	// Retrieve the base URL from the context, set by docker middleware
 	baseContainerUrl, ok := r.Context().Value("containerUrl").(string)
 	if !ok || baseContainerUrl == "" {
@@ -47,25 +100,183 @@ func (gwh *GatewayHandler) ProxyToInstance(w http.ResponseWriter, r *http.Reques
 
 	url, err := parseProxiedUrlGivenBaseUrl(baseContainerUrl, r.URL)
 	if err != nil {
-		gwh.log.Errorf("Unable to route request to container: %v", err)
+		log.Errorf("Unable to route request to container: %v", err)
 		utils.HandleInternalError(w, fmt.Errorf("Failed to parse url and proxy request - %v", err))
 		return
 	}
 
-	gwh.log.Infof("Proxing request to instance url: '%s'", url)
+	// The config is set by the middlewares, handlers without it fall back to the defaults
+	config, _ := r.Context().Value("functionConfig").(*data.FunctionConfig)
+	if config != nil && config.Transform != nil {
+		url.Path = service.RewritePath(url.Path, config.Transform.PathRewrites)
+		url.RawPath = ""
+	}
+	// The invocation id is set by the invocation middleware, handlers without it make their own
+	invocationId, ok := r.Context().Value("invocationId").(string)
+	if !ok {
+		invocationId = uuid.NewString()
+	}
+	invocation := service.Invocation{FunctionId: r.PathValue("id"), InvocationId: invocationId}
+	if config != nil {
+		invocation.Version = config.Version
+	}
+	ctx := context.WithValue(r.Context(), proxyTargetKey{}, url)
+	ctx = context.WithValue(ctx, invocationKey{}, invocation)
+
+	if config != nil && config.MaxRequestBody > 0 {
+		if r.ContentLength > config.MaxRequestBody {
+			utils.HandlePayloadTooLarge(w, fmt.Errorf("request body is larger than the function's max_request_body of %d bytes", config.MaxRequestBody))
+			return
+		}
+		// Bodies of unknown length fail the proxied request once they pass the limit
+		r.Body = http.MaxBytesReader(w, r.Body, config.MaxRequestBody)
+	}
+	if config != nil && config.MaxResponseBody > 0 {
+		ctx = context.WithValue(ctx, maxResponseBodyKey{}, config.MaxResponseBody)
+	}
+	if config != nil {
+		containerId, _ := r.Context().Value("containerId").(string)
+		ctx = service.WithUpstream(ctx, service.Upstream{FunctionId: r.PathValue("id"), ContainerId: containerId, Config: config})
+	}
 
-	// Configure reverse proxy
-	proxy := httputil.NewSingleHostReverseProxy(url)
-	proxy.Director = func(req *http.Request) {
-		req.URL = url
-		req.Host = url.Host
-		req.Header.Set("X-Forwarded-Host", req.Host)
-		req.Header.Set("X-Real-IP", req.RemoteAddr)
+	// The function's timeout bounds the wait for its response headers, which stops the timer, so streamed responses
+	// carry on for as long as the instance sends them. WebSocket connections last as long as the client keeps them open.
+	if !isUpgradeRequest(r) {
+		var cancel context.CancelCauseFunc
+		ctx, cancel = context.WithCancelCause(ctx)
+		defer cancel(nil)
+		timer := time.AfterFunc(gwh.service.FunctionTimeout(config), func() { cancel(context.DeadlineExceeded) })
+		defer timer.Stop()
+		ctx = context.WithValue(ctx, responseTimerKey{}, timer)
 	}
 
+	log.Infof("Proxing request to instance url: '%s'", url)
+
 	// Serve HTTP through the proxy
-	proxy.ServeHTTP(w, r)
+	r = r.WithContext(ctx)
+	gwh.proxy.ServeHTTP(w, r)
+}
+
+func isUpgradeRequest(r *http.Request) bool {
+	return r.Header.Get("Upgrade") != "" && strings.Contains(strings.ToLower(r.Header.Get("Connection")), "upgrade")
+}
+
+// limitResponseBody fails responses larger than the function's max_response_body.
+// Responses of unknown length are cut off once they pass the limit, after what was within it has been sent.
+func limitResponseBody(resp *http.Response) error {
+	limit, ok := resp.Request.Context().Value(maxResponseBodyKey{}).(int64)
+	if !ok || resp.StatusCode == http.StatusSwitchingProtocols {
+		return nil
+	}
+	if resp.ContentLength > limit {
+		return &responseTooLargeError{limit: limit}
+	}
+	resp.Body = &limitedBody{ReadCloser: resp.Body, limit: limit, remaining: limit}
+	return nil
+}
+
+// limitedBody returns a responseTooLargeError once more than limit bytes are read
+type limitedBody struct {
+	io.ReadCloser
+	limit     int64
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		// A body of exactly the limit is fine, only fail if there is more
+		var extra [1]byte
+		n, err := b.ReadCloser.Read(extra[:])
+		if n > 0 {
+			return 0, &responseTooLargeError{limit: b.limit}
+		}
+		return 0, err
+	}
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	return n, err
+}
+
+// rewriteToInstance points the outgoing request at the instance url in its context, and applies the function's header policy.
+// Upgrade headers are kept by the proxy, so WebSocket connections are tunnelled through to the instance.
+func rewriteToInstance(pr *httputil.ProxyRequest) {
+	target := pr.In.Context().Value(proxyTargetKey{}).(*url.URL)
+	pr.Out.URL = target
+	pr.Out.Host = target.Host
+
+	// Forwarded headers describe the client's request, before it was addressed to the instance
+	pr.SetXForwarded()
+	clientIP, _, err := net.SplitHostPort(pr.In.RemoteAddr)
+	if err != nil {
+		clientIP = pr.In.RemoteAddr
+	}
+	pr.Out.Header.Set("X-Real-IP", clientIP)
+
+	invocation, _ := pr.In.Context().Value(invocationKey{}).(service.Invocation)
+	if config, ok := pr.In.Context().Value("functionConfig").(*data.FunctionConfig); ok {
+		service.TransformRequestHeaders(pr.Out.Header, config.Transform, invocation)
+	}
+	// Set after the header policy, so the function always gets the invocation id
+	pr.Out.Header.Set(service.RequestIdHeader, invocation.InvocationId)
+}
+
+// modifyResponse stops the function's timeout once it has responded, and applies its header policy and body limit to the response
+func modifyResponse(resp *http.Response) error {
+	if timer, ok := resp.Request.Context().Value(responseTimerKey{}).(*time.Timer); ok {
+		timer.Stop()
+	}
+	// The gateway returns the invocation id itself, functions echoing it would duplicate it
+	resp.Header.Del(service.RequestIdHeader)
+	if config, ok := resp.Request.Context().Value("functionConfig").(*data.FunctionConfig); ok {
+		service.TransformResponseHeaders(resp.Header, config.Transform)
+	}
+	return limitResponseBody(resp)
+}
 
+// handleProxyError responds with jambda's error json when the instance can't be reached or doesn't respond in time,
+// and asks for the instance's health to be checked again as it may have died
+func (gwh *GatewayHandler) handleProxyError(w http.ResponseWriter, r *http.Request, err error) {
+	log := logging.FromContext(r.Context(), gwh.log)
+	if context.Cause(r.Context()) == context.Canceled {
+		// The client went away, there is no one to respond to and nothing wrong with the instance
+		log.Debugf("Client cancelled proxied request: %v", err)
+		return
+	}
+
+	// Bodies over the function's limits aren't the instance's fault
+	var maxBytesErr *http.MaxBytesError
+	if stderrors.As(err, &maxBytesErr) {
+		utils.HandlePayloadTooLarge(w, fmt.Errorf("request body is larger than the function's max_request_body of %d bytes", maxBytesErr.Limit))
+		return
+	}
+	var tooLargeErr *responseTooLargeError
+	if stderrors.As(err, &tooLargeErr) {
+		log.Warn("Function response rejected", "function", r.PathValue("id"), "error", err)
+		utils.HandleBadGateway(w, tooLargeErr)
+		return
+	}
+
+	functionId := r.PathValue("id")
+	containerId, _ := r.Context().Value("containerId").(string)
+	gwh.service.UpstreamError(functionId, containerId, err)
+
+	if context.Cause(r.Context()) == context.DeadlineExceeded {
+		config, _ := r.Context().Value("functionConfig").(*data.FunctionConfig)
+		timeout := gwh.service.FunctionTimeout(config)
+		gwh.service.TimedOut(functionId, timeout)
+		utils.HandleGatewayTimeout(w, fmt.Errorf("function did not respond within its timeout of %s", timeout))
+		return
+	}
+
+	var netErr net.Error
+	if stderrors.Is(err, context.DeadlineExceeded) || (stderrors.As(err, &netErr) && netErr.Timeout()) {
+		utils.HandleGatewayTimeout(w, fmt.Errorf("function instance did not respond in time"))
+		return
+	}
+	utils.HandleBadGateway(w, fmt.Errorf("function instance is unavailable: %v", err))
 }
 
 func parseProxiedUrlGivenBaseUrl(baseUrl string, proxiedUrl *url.URL) (*url.URL, error) {
@@ -1,8 +1,31 @@
 package handlers
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/jwtly10/jambda/api/data"
+	"github.com/jwtly10/jambda/api/middleware"
+	"github.com/jwtly10/jambda/internal/logging"
+	"github.com/jwtly10/jambda/internal/service"
+	"github.com/jwtly10/jambda/internal/tracing"
+	"github.com/jwtly10/jambda/internal/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.uber.org/zap/zapcore"
 )
 
 func TestCanParseUrlFromContainerBase(t *testing.T) {
@@ -65,3 +88,357 @@ func TestCanParseUrlFromContainerBase(t *testing.T) {
 	}
 
 }
+
+func newGatewayService() *service.GatewayService {
+	logger := logging.NewLogger(false, zapcore.DebugLevel)
+	return service.NewGatewayService(logger, time.Minute, service.NewCircuitBreakerService(logger))
+}
+
+// serveThroughGateway serves the gateway handler in front of an instance, as the docker middleware would
+func serveThroughGateway(t *testing.T, instance http.Handler) *httptest.Server {
+	return serveFunctionThroughGateway(t, newGatewayService(), nil, instance)
+}
+
+// serveFunctionThroughGateway is serveThroughGateway for a function with the config, which may be nil
+func serveFunctionThroughGateway(t *testing.T, gs *service.GatewayService, config *data.FunctionConfig, instance http.Handler) *httptest.Server {
+	backend := httptest.NewServer(instance)
+	t.Cleanup(backend.Close)
+
+	gwh := NewGatewayHandler(logging.NewLogger(false, zapcore.DebugLevel), gs)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/api/execute/{id}/{path...}", func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), "containerUrl", backend.URL)
+		if config != nil {
+			ctx = context.WithValue(ctx, "functionConfig", config)
+		}
+		gwh.ProxyToInstance(w, r.WithContext(ctx))
+	})
+	gateway := httptest.NewServer(mux)
+	t.Cleanup(gateway.Close)
+	return gateway
+}
+
+func TestProxyStreamsServerSentEvents(t *testing.T) {
+	next := make(chan struct{})
+	gateway := serveThroughGateway(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: first\n\n")
+		w.(http.Flusher).Flush()
+		// Only send the second event once the client has seen the first, so it must have been streamed
+		<-next
+		fmt.Fprint(w, "data: second\n\n")
+	}))
+
+	resp, err := http.Get(gateway.URL + "/v1/api/execute/fn/events")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	reader := bufio.NewReader(resp.Body)
+	line, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "data: first\n", line)
+
+	close(next)
+	rest, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "\ndata: second\n\n", string(rest))
+}
+
+func TestProxyStreamsOutliveTimeout(t *testing.T) {
+	config := &data.FunctionConfig{Timeout: data.Duration(50 * time.Millisecond)}
+	gateway := serveFunctionThroughGateway(t, newGatewayService(), config, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 0; i < 4; i++ {
+			fmt.Fprintf(w, "data: %d\n\n", i)
+			w.(http.Flusher).Flush()
+			time.Sleep(50 * time.Millisecond)
+		}
+	}))
+
+	resp, err := http.Get(gateway.URL + "/v1/api/execute/fn/events")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	// The timeout only bounds the wait for the response to start, so every event arrives
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "data: 0\n\ndata: 1\n\ndata: 2\n\ndata: 3\n\n", string(body))
+}
+
+func TestProxyUpgradesWebSockets(t *testing.T) {
+	gateway := serveThroughGateway(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "websocket" || r.URL.Path != "/ws" {
+			http.Error(w, "expected a websocket upgrade", http.StatusBadRequest)
+			return
+		}
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		fmt.Fprint(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+		rw.Flush()
+
+		// Echo a line back, standing in for websocket frames
+		line, _ := rw.ReadString('\n')
+		fmt.Fprint(rw, "echo: "+line)
+		rw.Flush()
+	}))
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(gateway.URL, "http://"))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	fmt.Fprint(conn, "GET /v1/api/execute/fn/ws HTTP/1.1\r\nHost: jambda\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+
+	fmt.Fprint(conn, "hello\n")
+	line, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "echo: hello\n", line)
+}
+
+func TestProxyErrorRespondsWithJson(t *testing.T) {
+	// Nothing is listening on the instance url, as if the container died
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	deadUrl := "http://" + listener.Addr().String()
+	listener.Close()
+
+	logger := logging.NewLogger(false, zapcore.DebugLevel)
+	gs := service.NewGatewayService(logger, time.Minute, service.NewCircuitBreakerService(logger))
+	rechecked := make(chan string, 1)
+	gs.OnUpstreamError(func(functionId string, containerId string) {
+		rechecked <- functionId + "/" + containerId
+	})
+	gwh := NewGatewayHandler(logger, gs)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/api/execute/{id}/{path...}", func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), "containerUrl", deadUrl)
+		ctx = context.WithValue(ctx, "containerId", "abc")
+		gwh.ProxyToInstance(w, r.WithContext(ctx))
+	})
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/api/execute/fn/hello", nil))
+
+	assert.Equal(t, http.StatusBadGateway, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	var body utils.ErrorResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Equal(t, "BAD_GATEWAY", body.Error)
+	assert.Equal(t, "fn/abc", <-rechecked)
+}
+
+func TestProxyTimeoutRespondsWithJson(t *testing.T) {
+	gs := newGatewayService()
+	timedOut := make(chan string, 1)
+	gs.OnTimeout(func(functionId string) { timedOut <- functionId })
+
+	config := &data.FunctionConfig{Timeout: data.Duration(50 * time.Millisecond)}
+	gateway := serveFunctionThroughGateway(t, gs, config, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+
+	resp, err := http.Get(gateway.URL + "/v1/api/execute/fn/slow")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusGatewayTimeout, resp.StatusCode)
+	var body utils.ErrorResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, "GATEWAY_TIMEOUT", body.Error)
+	assert.Contains(t, body.Message, "50ms")
+	assert.Equal(t, "fn", <-timedOut)
+}
+
+func TestProxyEnforcesBodyLimits(t *testing.T) {
+	gs := newGatewayService()
+	config := &data.FunctionConfig{MaxRequestBody: 8, MaxResponseBody: 16}
+	gateway := serveFunctionThroughGateway(t, gs, config, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			return
+		}
+		fmt.Fprint(w, strings.Repeat("x", len(strings.TrimPrefix(r.URL.Path, "/"))))
+	}))
+	url := gateway.URL + "/v1/api/execute/fn/"
+
+	tests := []struct {
+		name   string
+		path   string
+		body   io.Reader
+		status int
+	}{
+		{"within limits", strings.Repeat("a", 16), strings.NewReader("12345678"), http.StatusOK},
+		{"request body over limit", "a", strings.NewReader("123456789"), http.StatusRequestEntityTooLarge},
+		// Hides the length, so the body is only found to be too large while it's proxied
+		{"request body of unknown length over limit", "a", io.MultiReader(strings.NewReader("123456789")), http.StatusRequestEntityTooLarge},
+		{"response body over limit", strings.Repeat("a", 17), strings.NewReader(""), http.StatusBadGateway},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Post(url+tt.path, "text/plain", tt.body)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, tt.status, resp.StatusCode)
+		})
+	}
+}
+
+func TestProxyAppliesHeaderPolicy(t *testing.T) {
+	config := &data.FunctionConfig{
+		Version: "1.4.2",
+		Transform: &data.TransformConfig{
+			Request:               data.HeaderRules{Rename: map[string]string{"X-Token": "X-Client-Token"}},
+			Response:              data.HeaderRules{Add: map[string]string{"X-Served-By": "jambda"}},
+			PathRewrites:          []data.PathRewrite{{From: "/v1", To: "/api/v1"}},
+			InjectHeaders:         true,
+			StripSensitiveHeaders: true,
+		},
+	}
+	received := make(chan *http.Request, 1)
+	gateway := serveFunctionThroughGateway(t, newGatewayService(), config, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r
+		w.Header().Set("Server", "gunicorn")
+	}))
+
+	req, err := http.NewRequest(http.MethodGet, gateway.URL+"/v1/api/execute/fn/v1/users?page=2", nil)
+	require.NoError(t, err)
+	req.Header.Set("X-Token", "abc")
+	req.Header.Set("Cookie", "session=1")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, "jambda", resp.Header.Get("X-Served-By"))
+	assert.Empty(t, resp.Header.Get("Server"))
+
+	r := <-received
+	assert.Equal(t, "/api/v1/users", r.URL.Path)
+	assert.Equal(t, "page=2", r.URL.RawQuery)
+	assert.Equal(t, "abc", r.Header.Get("X-Client-Token"))
+	assert.Empty(t, r.Header.Get("X-Token"))
+	assert.Empty(t, r.Header.Get("Cookie"))
+	assert.Equal(t, "fn", r.Header.Get(service.FunctionIdHeader))
+	assert.Equal(t, "1.4.2", r.Header.Get(service.FunctionVersionHeader))
+	assert.NotEmpty(t, r.Header.Get(service.InvocationIdHeader))
+	// Forwarded headers describe the request to the gateway, not the instance
+	assert.Equal(t, strings.TrimPrefix(gateway.URL, "http://"), r.Header.Get("X-Forwarded-Host"))
+	assert.Equal(t, "127.0.0.1", r.Header.Get("X-Real-IP"))
+}
+
+func TestProxyForwardsInvocationId(t *testing.T) {
+	config := &data.FunctionConfig{Transform: &data.TransformConfig{InjectHeaders: true}}
+	received := make(chan *http.Request, 1)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r
+		// Echoed ids aren't returned twice
+		w.Header().Set(service.RequestIdHeader, r.Header.Get(service.RequestIdHeader))
+	}))
+	t.Cleanup(backend.Close)
+
+	logger := logging.NewLogger(false, zapcore.DebugLevel)
+	gwh := NewGatewayHandler(logger, newGatewayService())
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/api/execute/{id}/{path...}", func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), "containerUrl", backend.URL)
+		ctx = context.WithValue(ctx, "functionConfig", config)
+		gwh.ProxyToInstance(w, r.WithContext(ctx))
+	})
+	gateway := httptest.NewServer(middleware.NewInvocationMiddleware(logger).BeforeNext(mux))
+	t.Cleanup(gateway.Close)
+
+	tests := []struct {
+		name      string
+		requestId string
+		reused    bool
+	}{
+		{"reuses the client's id", "req-42.a:b", true},
+		{"generates an id without one", "", false},
+		{"replaces invalid ids", "two words", false},
+		{"replaces long ids", strings.Repeat("a", 129), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, gateway.URL+"/v1/api/execute/fn/", nil)
+			require.NoError(t, err)
+			if tt.requestId != "" {
+				req.Header.Set(service.RequestIdHeader, tt.requestId)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+
+			invocationId := resp.Header.Get(service.RequestIdHeader)
+			assert.Len(t, resp.Header.Values(service.RequestIdHeader), 1)
+			if tt.reused {
+				assert.Equal(t, tt.requestId, invocationId)
+			} else {
+				assert.Len(t, invocationId, 36)
+			}
+
+			r := <-received
+			assert.Equal(t, invocationId, r.Header.Get(service.RequestIdHeader))
+			assert.Equal(t, invocationId, r.Header.Get(service.InvocationIdHeader))
+		})
+	}
+}
+
+func TestProxyTracesUpstreamCall(t *testing.T) {
+	_, err := tracing.Setup(context.Background(), tracing.Config{})
+	require.NoError(t, err)
+	recorder := tracetest.NewSpanRecorder()
+	provider := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(provider) })
+
+	received := make(chan *http.Request, 1)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r
+	}))
+	t.Cleanup(backend.Close)
+
+	logger := logging.NewLogger(false, zapcore.DebugLevel)
+	gwh := NewGatewayHandler(logger, newGatewayService())
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/api/execute/{id}/{path...}", func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), "containerUrl", backend.URL)
+		ctx = context.WithValue(ctx, "containerId", "c1")
+		ctx = context.WithValue(ctx, "functionConfig", &data.FunctionConfig{})
+		gwh.ProxyToInstance(w, r.WithContext(ctx))
+	})
+	gateway := httptest.NewServer(middleware.NewTracingMiddleware(logger).BeforeNext(mux))
+	t.Cleanup(gateway.Close)
+
+	// The client's trace is continued
+	clientTrace := "4bf92f3577b34da6a3ce929d0e0e4736"
+	req, err := http.NewRequest(http.MethodGet, gateway.URL+"/v1/api/execute/fn/", nil)
+	require.NoError(t, err)
+	req.Header.Set("Traceparent", "00-"+clientTrace+"-00f067aa0ba902b7-01")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	upstream, server := spans[0], spans[1]
+	assert.Equal(t, "gateway GET", server.Name())
+	assert.Equal(t, clientTrace, server.SpanContext().TraceID().String())
+	assert.Equal(t, "upstream GET", upstream.Name())
+	assert.Equal(t, server.SpanContext().SpanID(), upstream.Parent().SpanID())
+	assert.Contains(t, upstream.Attributes(), tracing.ContainerIdKey.String("c1"))
+
+	// The function gets the trace context of the upstream call
+	r := <-received
+	assert.Equal(t, "00-"+clientTrace+"-"+upstream.SpanContext().SpanID().String()+"-01", r.Header.Get("Traceparent"))
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/jwtly10/jambda/api/data"
+	"github.com/jwtly10/jambda/internal/logging"
+	"github.com/jwtly10/jambda/internal/service"
+	"github.com/jwtly10/jambda/internal/utils"
+)
+
+type RouteHandler struct {
+	log     logging.Logger
+	service *service.RouteService
+}
+
+func NewRouteHandler(l logging.Logger, rs *service.RouteService) *RouteHandler {
+	return &RouteHandler{
+		log:     l,
+		service: rs,
+	}
+}
+
+// @Summary List all routes
+// @Description Retrieves the custom domain and path routes that send requests to functions.
+// @Tags Routes
+// @Produce application/json
+// @Success 200 {array} data.RouteEntity "List of all routes"
+// @Router /routes [get]
+func (rh *RouteHandler) ListRoutes(w http.ResponseWriter, r *http.Request) {
+	rh.writeJson(w, http.StatusOK, rh.service.GetRoutes())
+}
+
+// @Summary Create a route
+// @Description Sends requests for a host and/or path prefix to a function, by id or by name. Routes are matched before the execute path, and the path prefix is removed from the forwarded path unless keep_prefix is set.
+// @Tags Routes
+// @Accept application/json
+// @Produce application/json
+// @Param route body data.RouteEntity true "Route to create"
+// @Success 201 {object} data.RouteEntity "Route created successfully"
+// @Failure 400 {object} utils.ErrorResponse "Bad Request"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Router /routes [post]
+func (rh *RouteHandler) CreateRoute(w http.ResponseWriter, r *http.Request) {
+	var route data.RouteEntity
+	if err := json.NewDecoder(r.Body).Decode(&route); err != nil {
+		utils.HandleBadRequest(w, fmt.Errorf("error unmarshling route json: %v", err))
+		return
+	}
+
+	res, err := rh.service.CreateRoute(route)
+	if err != nil {
+		rh.log.Error("Failed to create route: ", err)
+		utils.HandleCustomErrors(w, err)
+		return
+	}
+
+	rh.writeJson(w, http.StatusCreated, res)
+}
+
+// @Summary Update a route
+// @Description Replaces an existing route.
+// @Tags Routes
+// @Accept application/json
+// @Produce application/json
+// @Param id path int true "Route ID"
+// @Param route body data.RouteEntity true "Updated route"
+// @Success 200 {object} data.RouteEntity "Route updated successfully"
+// @Failure 400 {object} utils.ErrorResponse "Bad Request"
+// @Failure 404 {object} utils.ErrorResponse "Not Found"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Router /routes/{id} [put]
+func (rh *RouteHandler) UpdateRoute(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		utils.HandleBadRequest(w, fmt.Errorf("error parsing route id from URL"))
+		return
+	}
+
+	var route data.RouteEntity
+	if err := json.NewDecoder(r.Body).Decode(&route); err != nil {
+		utils.HandleBadRequest(w, fmt.Errorf("error unmarshling route json: %v", err))
+		return
+	}
+
+	res, err := rh.service.UpdateRoute(id, route)
+	if err != nil {
+		rh.log.Error("Failed to update route: ", err)
+		utils.HandleCustomErrors(w, err)
+		return
+	}
+
+	rh.writeJson(w, http.StatusOK, res)
+}
+
+// @Summary Delete a route
+// @Description Deletes a route, requests for it are no longer sent to its function.
+// @Tags Routes
+// @Param id path int true "Route ID"
+// @Success 204 {string} string "Route deleted successfully"
+// @Failure 400 {object} utils.ErrorResponse "Bad Request"
+// @Failure 404 {object} utils.ErrorResponse "Not Found"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Router /routes/{id} [delete]
+func (rh *RouteHandler) DeleteRoute(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		utils.HandleBadRequest(w, fmt.Errorf("error parsing route id from URL"))
+		return
+	}
+
+	if err := rh.service.DeleteRoute(id); err != nil {
+		rh.log.Error("Failed to delete route: ", err)
+		utils.HandleCustomErrors(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (rh *RouteHandler) writeJson(w http.ResponseWriter, status int, res interface{}) {
+	jsonResponse, err := json.Marshal(res)
+	if err != nil {
+		rh.log.Error("Error marshaling route to JSON: ", err)
+		utils.HandleInternalError(w, fmt.Errorf("error marshalling response json: %v", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(jsonResponse)
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jwtly10/jambda/internal/logging"
+	"github.com/jwtly10/jambda/internal/service"
+	"github.com/jwtly10/jambda/internal/utils"
+)
+
+type ScalingHandler struct {
+	log     logging.Logger
+	service *service.AutoscalerService
+	prewarm *service.PrewarmService
+}
+
+func NewScalingHandler(l logging.Logger, as *service.AutoscalerService, pw *service.PrewarmService) *ScalingHandler {
+	return &ScalingHandler{
+		log:     l,
+		service: as,
+		prewarm: pw,
+	}
+}
+
+// @Summary Get the scaling state of a function
+// @Description Returns the current instance count, load, and most recent autoscaler decisions for a function. Useful for debugging why a function did or did not scale.
+// @Tags Functions
+// @Produce application/json
+// @Param id path string true "Function ID"
+// @Success 200 {object} service.ScalingStatus "Scaling state of the function"
+// @Failure 400 {object} utils.ErrorResponse "Bad Request"
+// @Router /function/{id}/scaling [get]
+func (sh *ScalingHandler) GetScalingStatus(w http.ResponseWriter, r *http.Request) {
+	externalId := r.PathValue("id")
+	if externalId == "" {
+		utils.HandleBadRequest(w, fmt.Errorf("error parsing externalId from URL"))
+		return
+	}
+
+	status := sh.service.GetScalingStatus(externalId)
+
+	jsonResponse, err := json.Marshal(status)
+	if err != nil {
+		sh.log.Error("Error marshaling scaling status to JSON: ", err)
+		utils.HandleInternalError(w, fmt.Errorf("error marshalling response json: %v", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonResponse)
+}
+
+// @Summary Pre-warm instances of a function
+// @Description Starts instances of a REST function ahead of a known spike in traffic, and waits for them to become ready. Defaults to the function's warm_instances, or a single instance. The instances are kept running for the duration, even without requests.
+// @Tags Functions
+// @Produce application/json
+// @Param id path string true "Function ID"
+// @Param instances query int false "Number of instances to keep warm"
+// @Param duration query string false "How long to keep the instances warm, e.g 30m, defaults to 10m"
+// @Success 200 {array} service.Instance "Running instances of the function"
+// @Failure 400 {object} utils.ErrorResponse "Bad Request"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Router /function/{id}/warm [post]
+func (sh *ScalingHandler) WarmFunction(w http.ResponseWriter, r *http.Request) {
+	externalId := r.PathValue("id")
+	if externalId == "" {
+		utils.HandleBadRequest(w, fmt.Errorf("error parsing externalId from URL"))
+		return
+	}
+
+	count := 0
+	if instances := r.URL.Query().Get("instances"); instances != "" {
+		var err error
+		count, err = strconv.Atoi(instances)
+		if err != nil || count < 1 {
+			utils.HandleValidationError(w, fmt.Errorf("instances must be a positive number"))
+			return
+		}
+	}
+
+	var duration time.Duration
+	if value := r.URL.Query().Get("duration"); value != "" {
+		var err error
+		duration, err = time.ParseDuration(value)
+		if err != nil || duration <= 0 {
+			utils.HandleValidationError(w, fmt.Errorf("duration must be a positive duration like '30m'"))
+			return
+		}
+	}
+
+	instances, err := sh.prewarm.WarmFunction(r.Context(), externalId, count, duration)
+	if err != nil {
+		sh.log.Errorf("Failed to warm function '%s': %v", externalId, err)
+		utils.HandleCustomErrors(w, err)
+		return
+	}
+
+	jsonResponse, err := json.Marshal(instances)
+	if err != nil {
+		sh.log.Error("Error marshaling instances to JSON: ", err)
+		utils.HandleInternalError(w, fmt.Errorf("error marshalling response json: %v", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonResponse)
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/jwtly10/jambda/internal/service"
+)
+
+const acmeChallengePath = "/.well-known/acme-challenge/"
+
+// AcmeChallengeMiddleware answers http-01 challenges of the ACME server, before routes are matched
+type AcmeChallengeMiddleware struct {
+	provider *service.HTTP01Provider
+}
+
+func NewAcmeChallengeMiddleware(provider *service.HTTP01Provider) *AcmeChallengeMiddleware {
+	return &AcmeChallengeMiddleware{
+		provider: provider,
+	}
+}
+
+func (amw *AcmeChallengeMiddleware) BeforeNext(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || !strings.HasPrefix(r.URL.Path, acmeChallengePath) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		response, ok := amw.provider.Response(strings.TrimPrefix(r.URL.Path, acmeChallengePath))
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(response))
+	})
+}
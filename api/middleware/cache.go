@@ -0,0 +1,159 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jwtly10/jambda/api/data"
+	"github.com/jwtly10/jambda/internal/logging"
+	"github.com/jwtly10/jambda/internal/service"
+	"github.com/jwtly10/jambda/internal/utils"
+)
+
+// CacheMiddleware serves GET and HEAD requests from the function's cached responses, and caches the responses to GET requests that miss.
+// It runs before the usage and docker middlewares, so cached responses are served without acquiring or waking an instance.
+type CacheMiddleware struct {
+	log   logging.Logger
+	ds    service.DockerService
+	cache *service.ResponseCacheService
+}
+
+func NewCacheMiddleware(log logging.Logger, ds service.DockerService, cache *service.ResponseCacheService) *CacheMiddleware {
+	return &CacheMiddleware{
+		log:   log,
+		ds:    ds,
+		cache: cache,
+	}
+}
+
+func (cmw *CacheMiddleware) BeforeNext(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log := logging.FromContext(r.Context(), cmw.log)
+		if (r.Method != http.MethodGet && r.Method != http.MethodHead) || r.Header.Get("Upgrade") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		functionId := utils.GetFunctionIdFromExecutePath(r)
+		config, ok := r.Context().Value("functionConfig").(*data.FunctionConfig)
+		if !ok {
+			var err error
+			config, err = cmw.ds.GetFunctionConfiguration(r.Context(), functionId)
+			if err != nil {
+				log.Errorf("Failed to get function config for id: %s %v", functionId, err)
+				utils.HandleCustomErrors(w, err)
+				return
+			}
+			r = r.WithContext(context.WithValue(r.Context(), "functionConfig", config))
+		}
+		if config.Cache == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Clients can skip the cache, no-cache still stores the fresh response
+		requestCC := service.ParseCacheControl(r.Header)
+		if requestCC.Has("no-store") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := service.CacheKey(functionId, r, *config.Cache)
+		if !requestCC.Has("no-cache") {
+			if cached, ok := cmw.cache.Get(key, time.Now()); ok {
+				log.Debugf("Serving cached response of function '%s'", functionId)
+				writeCachedResponse(w, r, cached)
+				return
+			}
+		}
+
+		w.Header().Set("X-Cache", "MISS")
+		// HEAD responses have no body to cache
+		if r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rec := &cacheRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if !rec.wroteHeader || rec.overflow {
+			return
+		}
+
+		ttl, cacheable := service.ResponseTTL(r, rec.status, w.Header(), *config.Cache)
+		if !cacheable {
+			return
+		}
+		header := w.Header().Clone()
+		header.Del("X-Cache")
+		header.Del(service.RequestIdHeader)
+		now := time.Now()
+		cmw.cache.Put(functionId, key, &service.CachedResponse{
+			Status:  rec.status,
+			Header:  header,
+			Body:    bytes.Clone(rec.body.Bytes()),
+			Stored:  now,
+			Expires: now.Add(ttl),
+		})
+	})
+}
+
+func writeCachedResponse(w http.ResponseWriter, r *http.Request, cached *service.CachedResponse) {
+	header := w.Header()
+	for name, values := range cached.Header {
+		header[name] = append([]string(nil), values...)
+	}
+	header.Set("Age", strconv.Itoa(int(time.Since(cached.Stored).Seconds())))
+	header.Set("X-Cache", "HIT")
+	w.WriteHeader(cached.Status)
+	if r.Method != http.MethodHead {
+		w.Write(cached.Body)
+	}
+}
+
+// cacheRecorder copies the response written through it, until it's larger than can be cached
+type cacheRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+	overflow    bool
+}
+
+func (cr *cacheRecorder) WriteHeader(status int) {
+	// Informational responses come before the final one
+	if !cr.wroteHeader && status >= http.StatusOK {
+		cr.status = status
+		cr.wroteHeader = true
+	}
+	cr.ResponseWriter.WriteHeader(status)
+}
+
+func (cr *cacheRecorder) Write(p []byte) (int, error) {
+	if !cr.wroteHeader {
+		cr.WriteHeader(http.StatusOK)
+	}
+	if !cr.overflow {
+		if cr.body.Len()+len(p) > service.MaxCachedResponse {
+			cr.overflow = true
+			cr.body = bytes.Buffer{}
+		} else {
+			cr.body.Write(p)
+		}
+	}
+	return cr.ResponseWriter.Write(p)
+}
+
+// Flush keeps streamed responses streaming through the recorder
+func (cr *cacheRecorder) Flush() {
+	if flusher, ok := cr.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (cr *cacheRecorder) Unwrap() http.ResponseWriter {
+	return cr.ResponseWriter
+}
@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/jwtly10/jambda/api/data"
+	"github.com/jwtly10/jambda/internal/logging"
+	"github.com/jwtly10/jambda/internal/service"
+	"github.com/jwtly10/jambda/internal/utils"
+)
+
+// CircuitBreakerMiddleware rejects requests with a 503 while the function's circuit is open.
+// It runs before the usage and docker middlewares, so rejected requests fail fast without waiting on an instance.
+type CircuitBreakerMiddleware struct {
+	log logging.Logger
+	ds  service.DockerService
+	cb  *service.CircuitBreakerService
+}
+
+func NewCircuitBreakerMiddleware(log logging.Logger, ds service.DockerService, cb *service.CircuitBreakerService) *CircuitBreakerMiddleware {
+	return &CircuitBreakerMiddleware{
+		log: log,
+		ds:  ds,
+		cb:  cb,
+	}
+}
+
+func (cbmw *CircuitBreakerMiddleware) BeforeNext(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log := logging.FromContext(r.Context(), cbmw.log)
+		functionId := utils.GetFunctionIdFromExecutePath(r)
+		config, ok := r.Context().Value("functionConfig").(*data.FunctionConfig)
+		if !ok {
+			var err error
+			config, err = cbmw.ds.GetFunctionConfiguration(r.Context(), functionId)
+			if err != nil {
+				log.Errorf("Failed to get function config for id: %s %v", functionId, err)
+				utils.HandleCustomErrors(w, err)
+				return
+			}
+			r = r.WithContext(context.WithValue(r.Context(), "functionConfig", config))
+		}
+
+		if config.CircuitBreaker != nil {
+			if err := cbmw.cb.Allow(functionId, *config.CircuitBreaker, time.Now()); err != nil {
+				log.Warn("Request rejected by open circuit breaker", "function", functionId)
+				utils.HandleCustomErrors(w, err)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jwtly10/jambda/internal/logging"
+	"github.com/jwtly10/jambda/internal/service"
+)
+
+// validRequestId limits the X-Request-Id values reused from clients, so they're safe to log and pass on
+var validRequestId = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// InvocationMiddleware gives every request to a function an invocation id, reusing the client's X-Request-Id when it has a valid one.
+// The id is passed on to the function and returned in X-Request-Id, and added to every line logged for the request.
+type InvocationMiddleware struct {
+	log logging.Logger
+}
+
+func NewInvocationMiddleware(log logging.Logger) *InvocationMiddleware {
+	return &InvocationMiddleware{
+		log: log,
+	}
+}
+
+func (imw *InvocationMiddleware) BeforeNext(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/api/execute/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		invocationId := r.Header.Get(service.RequestIdHeader)
+		if !validRequestId.MatchString(invocationId) {
+			invocationId = uuid.NewString()
+		}
+		r.Header.Set(service.RequestIdHeader, invocationId)
+		w.Header().Set(service.RequestIdHeader, invocationId)
+
+		ctx := context.WithValue(r.Context(), "invocationId", invocationId)
+		ctx = logging.NewContext(ctx, imw.log.With("invocation_id", invocationId))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/jwtly10/jambda/api/data"
+	"github.com/jwtly10/jambda/internal/logging"
+	"github.com/jwtly10/jambda/internal/service"
+	"github.com/jwtly10/jambda/internal/utils"
+)
+
+// RateLimitMiddleware rejects requests over a function's rate limit or daily quota with a 429.
+// It runs before the usage and docker middlewares, so rejected requests never start or keep an instance warm.
+type RateLimitMiddleware struct {
+	log logging.Logger
+	ds  service.DockerService
+	rl  *service.RateLimitService
+}
+
+func NewRateLimitMiddleware(log logging.Logger, ds service.DockerService, rl *service.RateLimitService) *RateLimitMiddleware {
+	return &RateLimitMiddleware{
+		log: log,
+		ds:  ds,
+		rl:  rl,
+	}
+}
+
+func (rmw *RateLimitMiddleware) BeforeNext(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log := logging.FromContext(r.Context(), rmw.log)
+		functionId := utils.GetFunctionIdFromExecutePath(r)
+
+		config, err := rmw.ds.GetFunctionConfiguration(r.Context(), functionId)
+		if err != nil {
+			log.Errorf("Failed to get function config for id: %s %v", functionId, err)
+			utils.HandleCustomErrors(w, err)
+			return
+		}
+
+		if config.RateLimit != nil {
+			key := rateLimitKey(r, *config.RateLimit)
+			if err := rmw.rl.Allow(functionId, key, *config.RateLimit, time.Now()); err != nil {
+				log.Warn("Request rate limited", "function", functionId, "key", key, "error", err)
+				utils.HandleCustomErrors(w, err)
+				return
+			}
+		}
+
+		// Pass the config on, so it isn't read from the db again
+		r = r.WithContext(context.WithValue(r.Context(), "functionConfig", config))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rateLimitKey returns what the request is counted against, for the key type of the rate limit.
+// Only the configured api keys get their own limit, so clients can't dodge limits by sending new keys.
+// Keys are hashed so they aren't logged.
+func rateLimitKey(r *http.Request, config data.RateLimitConfig) string {
+	switch config.Key {
+	case data.RateLimitKeyAPIKey:
+		if apiKey := r.Header.Get("X-Api-Key"); slices.Contains(config.APIKeys, apiKey) {
+			sum := sha256.Sum256([]byte(apiKey))
+			return "key:" + hex.EncodeToString(sum[:8])
+		}
+		return "ip:" + clientIP(r)
+	case data.RateLimitKeyIP:
+		return "ip:" + clientIP(r)
+	default:
+		return ""
+	}
+}
+
+// clientIP is the address the request came from. Forwarded headers aren't trusted, as clients could set them to dodge limits.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -17,6 +17,6 @@ func (rmw *RequestLoggerMiddleware) BeforeNext(next http.Handler) http.Handler {
 		start := time.Now()
 		next.ServeHTTP(w, r)
 		duration := time.Since(start)
-		rmw.Log.Infof("Method: %s, Path: %s, Duration: %s", r.Method, r.URL.Path, duration)
+		logging.FromContext(r.Context(), rmw.Log).Infof("Method: %s, Path: %s, Duration: %s", r.Method, r.URL.Path, duration)
 	})
 }
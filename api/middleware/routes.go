@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/jwtly10/jambda/internal/logging"
+	"github.com/jwtly10/jambda/internal/service"
+	"github.com/jwtly10/jambda/internal/utils"
+)
+
+// RoutesMiddleware sends requests matching a custom domain or path route to the execute path of its function.
+// It wraps the whole router, so routes are matched before anything else.
+type RoutesMiddleware struct {
+	log logging.Logger
+	rs  *service.RouteService
+}
+
+func NewRoutesMiddleware(log logging.Logger, rs *service.RouteService) *RoutesMiddleware {
+	return &RoutesMiddleware{
+		log: log,
+		rs:  rs,
+	}
+}
+
+func (rmw *RoutesMiddleware) BeforeNext(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		match, ok, err := rmw.rs.Match(r.Host, r.URL.Path)
+		if err != nil {
+			logging.FromContext(r.Context(), rmw.log).Errorf("Failed to route '%s%s': %v", r.Host, r.URL.Path, err)
+			utils.HandleCustomErrors(w, err)
+			return
+		}
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rmw.log.Infof("Routing '%s%s' to function '%s'", r.Host, r.URL.Path, match.FunctionId)
+		routed := r.Clone(r.Context())
+		routed.URL.Path = "/v1/api/execute/" + match.FunctionId + match.Path
+		routed.URL.RawPath = ""
+		routed.RequestURI = routed.URL.RequestURI()
+		next.ServeHTTP(w, routed)
+	})
+}
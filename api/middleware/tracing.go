@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/jwtly10/jambda/internal/logging"
+	"github.com/jwtly10/jambda/internal/tracing"
+	"github.com/jwtly10/jambda/internal/utils"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracingMiddleware starts the gateway span of requests to functions, continuing the client's trace when it sends a traceparent.
+// It runs first of the gateway middlewares, so the config lookup, cold start and upstream call are all part of the span.
+type TracingMiddleware struct {
+	log logging.Logger
+}
+
+func NewTracingMiddleware(log logging.Logger) *TracingMiddleware {
+	return &TracingMiddleware{
+		log: log,
+	}
+}
+
+func (tmw *TracingMiddleware) BeforeNext(next http.Handler) http.Handler {
+	return otelhttp.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		span := trace.SpanFromContext(ctx)
+		span.SetAttributes(tracing.FunctionIdKey.String(utils.GetFunctionIdFromExecutePath(r)))
+		if invocationId, ok := ctx.Value("invocationId").(string); ok {
+			span.SetAttributes(tracing.InvocationIdKey.String(invocationId))
+		}
+
+		// Log lines of the request can be found from its trace
+		if sc := span.SpanContext(); sc.IsValid() {
+			ctx = logging.NewContext(ctx, logging.FromContext(ctx, tmw.log).With("trace_id", sc.TraceID().String()))
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}), "gateway", otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+		return "gateway " + r.Method
+	}))
+}
@@ -31,6 +31,7 @@ func (umw *UsageMiddleware) BeforeNext(next http.Handler) http.Handler {
 
 		umw.log.Infof("Incrementing request count for %s", functionId)
 		umw.rs.IncrementRequestCount(functionId)
+		defer umw.rs.CompleteRequest(functionId)
 
 		next.ServeHTTP(w, r)
 	})
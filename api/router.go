@@ -58,6 +58,16 @@ func (r *AppRouter) Update(pattern string, handler http.Handler) {
 	r.handle(fmt.Sprintf("UPDATE %s", pattern), handler)
 }
 
+func (r *AppRouter) Patch(pattern string, handler http.Handler) {
+	r.logger.Infof("Mapped [PATCH] %s", pattern)
+	r.handle(fmt.Sprintf("PATCH %s", pattern), handler)
+}
+
+func (r *AppRouter) Head(pattern string, handler http.Handler) {
+	r.logger.Infof("Mapped [HEAD] %s", pattern)
+	r.handle(fmt.Sprintf("HEAD %s", pattern), handler)
+}
+
 func (r *AppRouter) Put(pattern string, handler http.Handler) {
 	r.logger.Infof("Mapped [PUT] %s", pattern)
 	r.handle(fmt.Sprintf("PUT %s", pattern), handler)
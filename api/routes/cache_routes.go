@@ -0,0 +1,32 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/jwtly10/jambda/api"
+	"github.com/jwtly10/jambda/api/handlers"
+	"github.com/jwtly10/jambda/api/middleware"
+	"github.com/jwtly10/jambda/internal/logging"
+)
+
+type CacheRoutes struct {
+	log      logging.Logger
+	handlers handlers.CacheHandler
+}
+
+func NewCacheRoutes(router api.AppRouter, l logging.Logger, h handlers.CacheHandler, mws ...middleware.Middleware) CacheRoutes {
+	routes := CacheRoutes{
+		log:      l,
+		handlers: h,
+	}
+
+	BASE_PATH := "/v1/api"
+
+	purgeHandler := http.HandlerFunc(routes.handlers.PurgeCache)
+	router.Delete(
+		BASE_PATH+"/function/{id}/cache",
+		middleware.Chain(purgeHandler, mws...),
+	)
+
+	return routes
+}
@@ -0,0 +1,38 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/jwtly10/jambda/api"
+	"github.com/jwtly10/jambda/api/handlers"
+	"github.com/jwtly10/jambda/api/middleware"
+	"github.com/jwtly10/jambda/internal/logging"
+)
+
+type ContainerRoutes struct {
+	log      logging.Logger
+	handlers handlers.ContainerHandler
+}
+
+func NewContainerRoutes(router api.AppRouter, l logging.Logger, h handlers.ContainerHandler, mws ...middleware.Middleware) ContainerRoutes {
+	routes := ContainerRoutes{
+		log:      l,
+		handlers: h,
+	}
+
+	BASE_PATH := "/v1/api"
+
+	containersHandler := http.HandlerFunc(routes.handlers.GetFunctionContainers)
+	router.Get(
+		BASE_PATH+"/function/{id}/containers",
+		middleware.Chain(containersHandler, mws...),
+	)
+
+	logsHandler := http.HandlerFunc(routes.handlers.GetContainerLogs)
+	router.Get(
+		BASE_PATH+"/function/{id}/containers/{containerId}/logs",
+		middleware.Chain(logsHandler, mws...),
+	)
+
+	return routes
+}
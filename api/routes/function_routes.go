@@ -45,5 +45,11 @@ func NewFunctionRoutes(router api.AppRouter, l logging.Logger, h handlers.Functi
 		BASE_PATH+"/function/{id}",
 		middleware.Chain(deleteHandler, mws...),
 	)
+
+	artifactHandler := http.HandlerFunc(routes.handlers.GetArtifact)
+	router.Get(
+		BASE_PATH+"/function/{id}/artifact",
+		middleware.Chain(artifactHandler, mws...),
+	)
 	return routes
 }
@@ -22,23 +22,22 @@ func NewGatewayRoutes(router api.AppRouter, l logging.Logger, h handlers.Gateway
 
 	BASE_PATH := "/v1/api"
 
-	gatewayHandler := http.HandlerFunc(routes.handlers.ProxyToInstance)
-	router.Post(
-		BASE_PATH+"/execute/{id}/*",
-		middleware.Chain(gatewayHandler, mws...),
-	)
-	router.Get(
-		BASE_PATH+"/execute/{id}/*",
-		middleware.Chain(gatewayHandler, mws...),
-	)
-	router.Put(
-		BASE_PATH+"/execute/{id}/*",
-		middleware.Chain(gatewayHandler, mws...),
-	)
-	router.Delete(
-		BASE_PATH+"/execute/{id}/*",
-		middleware.Chain(gatewayHandler, mws...),
-	)
+	gatewayHandler := middleware.Chain(http.HandlerFunc(routes.handlers.ProxyToInstance), mws...)
+
+	// Every method is forwarded, both to the function root and any path below it
+	methods := []func(pattern string, handler http.Handler){
+		router.Get,
+		router.Head,
+		router.Post,
+		router.Put,
+		router.Patch,
+		router.Delete,
+		router.Options,
+	}
+	for _, method := range methods {
+		method(BASE_PATH+"/execute/{id}", gatewayHandler)
+		method(BASE_PATH+"/execute/{id}/{path...}", gatewayHandler)
+	}
 
 	return routes
 }
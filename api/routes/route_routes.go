@@ -0,0 +1,50 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/jwtly10/jambda/api"
+	"github.com/jwtly10/jambda/api/handlers"
+	"github.com/jwtly10/jambda/api/middleware"
+	"github.com/jwtly10/jambda/internal/logging"
+)
+
+type RouteRoutes struct {
+	log      logging.Logger
+	handlers handlers.RouteHandler
+}
+
+func NewRouteRoutes(router api.AppRouter, l logging.Logger, h handlers.RouteHandler, mws ...middleware.Middleware) RouteRoutes {
+	routes := RouteRoutes{
+		log:      l,
+		handlers: h,
+	}
+
+	BASE_PATH := "/v1/api"
+
+	listHandler := http.HandlerFunc(routes.handlers.ListRoutes)
+	router.Get(
+		BASE_PATH+"/routes",
+		middleware.Chain(listHandler, mws...),
+	)
+
+	createHandler := http.HandlerFunc(routes.handlers.CreateRoute)
+	router.Post(
+		BASE_PATH+"/routes",
+		middleware.Chain(createHandler, mws...),
+	)
+
+	updateHandler := http.HandlerFunc(routes.handlers.UpdateRoute)
+	router.Put(
+		BASE_PATH+"/routes/{id}",
+		middleware.Chain(updateHandler, mws...),
+	)
+
+	deleteHandler := http.HandlerFunc(routes.handlers.DeleteRoute)
+	router.Delete(
+		BASE_PATH+"/routes/{id}",
+		middleware.Chain(deleteHandler, mws...),
+	)
+
+	return routes
+}
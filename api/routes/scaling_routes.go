@@ -0,0 +1,38 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/jwtly10/jambda/api"
+	"github.com/jwtly10/jambda/api/handlers"
+	"github.com/jwtly10/jambda/api/middleware"
+	"github.com/jwtly10/jambda/internal/logging"
+)
+
+type ScalingRoutes struct {
+	log      logging.Logger
+	handlers handlers.ScalingHandler
+}
+
+func NewScalingRoutes(router api.AppRouter, l logging.Logger, h handlers.ScalingHandler, mws ...middleware.Middleware) ScalingRoutes {
+	routes := ScalingRoutes{
+		log:      l,
+		handlers: h,
+	}
+
+	BASE_PATH := "/v1/api"
+
+	statusHandler := http.HandlerFunc(routes.handlers.GetScalingStatus)
+	router.Get(
+		BASE_PATH+"/function/{id}/scaling",
+		middleware.Chain(statusHandler, mws...),
+	)
+
+	warmHandler := http.HandlerFunc(routes.handlers.WarmFunction)
+	router.Post(
+		BASE_PATH+"/function/{id}/warm",
+		middleware.Chain(warmHandler, mws...),
+	)
+
+	return routes
+}
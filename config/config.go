@@ -1,8 +1,11 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -13,6 +16,73 @@ type Config struct {
 	DBUser     string
 	DBPassword string
 	DBName     string
+
+	// DefaultIdleTimeout is used for functions that don't set their own idle_timeout
+	DefaultIdleTimeout time.Duration
+	// ReconcileInterval is how often containers are reconciled with the functions in the database
+	ReconcileInterval time.Duration
+	// DefaultFunctionTimeout bounds the wait for responses of functions that don't set their own timeout
+	DefaultFunctionTimeout time.Duration
+	// ResponseCacheSize is the most bytes of responses cached for functions with a cache, shared by every function
+	ResponseCacheSize int64
+
+	// ExecutionBackend is what function instances run on, either 'docker', 'process' or 'kubernetes'
+	ExecutionBackend string
+	// ContainerRuntime is what the docker backend talks to, either 'docker' or a rootless 'podman' socket
+	ContainerRuntime string
+	// ContainerHost is the host published container ports are reached on, defaults to localhost, or 127.0.0.1 under podman
+	ContainerHost string
+
+	// ProcessUser is the 'uid:gid' the process backend runs functions as when jambda runs as root
+	ProcessUser string
+	// ProcessMaxMemory and ProcessMaxProcesses opt in to limiting the address space and process count of the process backend's functions, 0 is unlimited
+	ProcessMaxMemory    int64
+	ProcessMaxProcesses int64
+
+	// KubernetesNamespace is where function Deployments and Services are created
+	KubernetesNamespace string
+	// KubernetesArtifactUrl is the base url pods download function binaries from, e.g 'http://jambda.jambda.svc:8080/v1/api/function'
+	KubernetesArtifactUrl string
+	// Kubeconfig is used when jambda isn't running in the cluster, defaults to ~/.kube/config
+	Kubeconfig string
+
+	// VMKernelImage and VMRootfsImage enable running functions with isolation 'vm' in firecracker microVMs
+	VMKernelImage string
+	VMRootfsImage string
+	// FirecrackerBinary is the firecracker executable, defaults to 'firecracker' on the PATH
+	FirecrackerBinary string
+
+	// HTTPAddr is the address of the plain HTTP listener, which also answers ACME http-01 challenges
+	HTTPAddr string
+	// ServerReadHeaderTimeout, ServerReadTimeout, ServerWriteTimeout and ServerIdleTimeout are set on the http.Server of each listener.
+	// Read and write timeouts are disabled by default, as they would cut off streamed and WebSocket requests that functions' timeouts allow.
+	ServerReadHeaderTimeout time.Duration
+	ServerReadTimeout       time.Duration
+	ServerWriteTimeout      time.Duration
+	ServerIdleTimeout       time.Duration
+	// HTTPSAddr enables a HTTPS listener when set, e.g ':8443'
+	HTTPSAddr string
+	// TLSCertFile and TLSKeyFile are served over HTTPS, and reloaded when they change
+	TLSCertFile string
+	TLSKeyFile  string
+	// AcmeDirectoryUrl enables issuing certificates for the hosts of routes and AcmeDomains from an ACME server
+	AcmeDirectoryUrl string
+	AcmeEmail        string
+	// AcmeDomains are issued certificates along with the hosts of routes
+	AcmeDomains []string
+	// AcmeCacheDir stores the ACME account key and issued certificates
+	AcmeCacheDir string
+	// AcmeCAFile is an extra root CA trusted for the ACME server, e.g Pebble's test CA
+	AcmeCAFile string
+
+	// TracingExporter is where OpenTelemetry spans are sent, either 'otlp', 'stdout' or 'file', tracing is disabled when unset
+	TracingExporter string
+	// TracingEndpoint is the OTLP/HTTP collector url, e.g 'http://localhost:4318', defaults to OTEL_EXPORTER_OTLP_ENDPOINT
+	TracingEndpoint string
+	// TracingFile is where spans are appended with the 'file' exporter
+	TracingFile string
+	// TracingSampleRatio is the fraction of traces sampled, between 0 and 1
+	TracingSampleRatio float64
 }
 
 func LoadConfig() (*Config, error) {
@@ -26,11 +96,168 @@ func LoadConfig() (*Config, error) {
 		return nil, err
 	}
 
+	defaultIdleTimeout, err := getEnvDuration("DEFAULT_IDLE_TIMEOUT", 30*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	reconcileInterval, err := getEnvDuration("RECONCILE_INTERVAL", 5*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	functionTimeout, err := getEnvDuration("DEFAULT_FUNCTION_TIMEOUT", time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	cacheSize, err := getEnvInt64("RESPONSE_CACHE_SIZE", 64<<20)
+	if err != nil {
+		return nil, err
+	}
+
+	readHeaderTimeout, err := getEnvDuration("SERVER_READ_HEADER_TIMEOUT", 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	readTimeout, err := getEnvDuration("SERVER_READ_TIMEOUT", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	writeTimeout, err := getEnvDuration("SERVER_WRITE_TIMEOUT", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	serverIdleTimeout, err := getEnvDuration("SERVER_IDLE_TIMEOUT", 2*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	processMaxMemory, err := getEnvInt64("PROCESS_MAX_MEMORY", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	processMaxProcesses, err := getEnvInt64("PROCESS_MAX_PROCESSES", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	sampleRatio, err := getEnvFloat("TRACING_SAMPLE_RATIO", 1)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Config{
 		DBHost:     os.Getenv("DB_HOST"),
 		DBPort:     port,
 		DBUser:     os.Getenv("DB_USER"),
 		DBPassword: os.Getenv("DB_PASSWORD"),
 		DBName:     os.Getenv("DB_NAME"),
+
+		DefaultIdleTimeout:     defaultIdleTimeout,
+		ReconcileInterval:      reconcileInterval,
+		DefaultFunctionTimeout: functionTimeout,
+		ResponseCacheSize:      cacheSize,
+
+		ExecutionBackend: getEnv("EXECUTION_BACKEND", "docker"),
+		ContainerRuntime: getEnv("CONTAINER_RUNTIME", "docker"),
+		ContainerHost:    os.Getenv("CONTAINER_PUBLISH_HOST"),
+
+		ProcessUser:         getEnv("PROCESS_USER", "65534:65534"),
+		ProcessMaxMemory:    processMaxMemory,
+		ProcessMaxProcesses: processMaxProcesses,
+
+		KubernetesNamespace:   getEnv("KUBERNETES_NAMESPACE", "default"),
+		KubernetesArtifactUrl: getEnv("KUBERNETES_ARTIFACT_URL", "http://jambda:8080/v1/api/function"),
+		Kubeconfig:            os.Getenv("KUBECONFIG"),
+
+		VMKernelImage:     os.Getenv("VM_KERNEL_IMAGE"),
+		VMRootfsImage:     os.Getenv("VM_ROOTFS_IMAGE"),
+		FirecrackerBinary: getEnv("FIRECRACKER_BIN", "firecracker"),
+
+		ServerReadHeaderTimeout: readHeaderTimeout,
+		ServerReadTimeout:       readTimeout,
+		ServerWriteTimeout:      writeTimeout,
+		ServerIdleTimeout:       serverIdleTimeout,
+
+		HTTPAddr:         getEnv("HTTP_ADDR", ":8080"),
+		HTTPSAddr:        os.Getenv("HTTPS_ADDR"),
+		TLSCertFile:      os.Getenv("TLS_CERT_FILE"),
+		TLSKeyFile:       os.Getenv("TLS_KEY_FILE"),
+		AcmeDirectoryUrl: os.Getenv("ACME_DIRECTORY_URL"),
+		AcmeEmail:        os.Getenv("ACME_EMAIL"),
+		AcmeDomains:      getEnvList("ACME_DOMAINS"),
+		AcmeCacheDir:     getEnv("ACME_CACHE_DIR", "./certs"),
+		AcmeCAFile:       os.Getenv("ACME_CA_FILE"),
+
+		TracingExporter:    os.Getenv("TRACING_EXPORTER"),
+		TracingEndpoint:    os.Getenv("TRACING_OTLP_ENDPOINT"),
+		TracingFile:        getEnv("TRACING_FILE", "./traces.json"),
+		TracingSampleRatio: sampleRatio,
 	}, nil
 }
+
+// getEnv returns the value of key from the environment, falling back to def when unset
+func getEnv(key string, def string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return def
+}
+
+// getEnvList splits a comma separated list from the environment, e.g "a.home.lan, b.home.lan"
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// getEnvDuration parses a duration like "30m" from the environment, falling back to def when unset
+func getEnvDuration(key string, def time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return def, nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration for %s: %v", key, err)
+	}
+	return d, nil
+}
+
+// getEnvInt64 parses a number from the environment, falling back to def when unset
+func getEnvInt64(key string, def int64) (int64, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return def, nil
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number for %s: %v", key, err)
+	}
+	return n, nil
+}
+
+// getEnvFloat parses a number like "0.25" from the environment, falling back to def when unset
+func getEnvFloat(key string, def float64) (float64, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return def, nil
+	}
+
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number for %s: %v", key, err)
+	}
+	return f, nil
+}
@@ -18,9 +18,9 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/execute/{id}/": {
+        "/execute/{id}/{path}": {
             "get": {
-                "description": "Proxies requests to docker instance running executable. Method passed to instance forwarded from req. Middleware figures out the instance URL to proxy the request to, based on ExternalId. Returns proxied response.",
+                "description": "Proxies requests to docker instance running executable. Method passed to instance forwarded from req. Middleware figures out the instance URL to proxy the request to, based on ExternalId. Returns proxied response. Server-sent events, streamed responses and WebSocket upgrades are passed through.",
                 "consumes": [
                     "text/plain"
                 ],
@@ -38,6 +38,13 @@ const docTemplate = `{
                         "name": "id",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Path forwarded to the function",
+                        "name": "path",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
@@ -53,16 +60,34 @@ const docTemplate = `{
                             "$ref": "#/definitions/utils.ErrorResponse"
                         }
                     },
+                    "413": {
+                        "description": "Request body larger than the function's max_request_body",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
                             "$ref": "#/definitions/utils.ErrorResponse"
                         }
+                    },
+                    "502": {
+                        "description": "Function instance unavailable, or its response is larger than max_response_body",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "504": {
+                        "description": "Function instance did not respond within the function's timeout",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
                     }
                 }
             },
             "put": {
-                "description": "Proxies requests to docker instance running executable. Method passed to instance forwarded from req. Middleware figures out the instance URL to proxy the request to, based on ExternalId. Returns proxied response.",
+                "description": "Proxies requests to docker instance running executable. Method passed to instance forwarded from req. Middleware figures out the instance URL to proxy the request to, based on ExternalId. Returns proxied response. Server-sent events, streamed responses and WebSocket upgrades are passed through.",
                 "consumes": [
                     "text/plain"
                 ],
@@ -80,6 +105,13 @@ const docTemplate = `{
                         "name": "id",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Path forwarded to the function",
+                        "name": "path",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
@@ -95,16 +127,34 @@ const docTemplate = `{
                             "$ref": "#/definitions/utils.ErrorResponse"
                         }
                     },
+                    "413": {
+                        "description": "Request body larger than the function's max_request_body",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
                             "$ref": "#/definitions/utils.ErrorResponse"
                         }
+                    },
+                    "502": {
+                        "description": "Function instance unavailable, or its response is larger than max_response_body",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "504": {
+                        "description": "Function instance did not respond within the function's timeout",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
                     }
                 }
             },
             "post": {
-                "description": "Proxies requests to docker instance running executable. Method passed to instance forwarded from req. Middleware figures out the instance URL to proxy the request to, based on ExternalId. Returns proxied response.",
+                "description": "Proxies requests to docker instance running executable. Method passed to instance forwarded from req. Middleware figures out the instance URL to proxy the request to, based on ExternalId. Returns proxied response. Server-sent events, streamed responses and WebSocket upgrades are passed through.",
                 "consumes": [
                     "text/plain"
                 ],
@@ -122,6 +172,13 @@ const docTemplate = `{
                         "name": "id",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Path forwarded to the function",
+                        "name": "path",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
@@ -137,16 +194,235 @@ const docTemplate = `{
                             "$ref": "#/definitions/utils.ErrorResponse"
                         }
                     },
+                    "413": {
+                        "description": "Request body larger than the function's max_request_body",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
                             "$ref": "#/definitions/utils.ErrorResponse"
                         }
+                    },
+                    "502": {
+                        "description": "Function instance unavailable, or its response is larger than max_response_body",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "504": {
+                        "description": "Function instance did not respond within the function's timeout",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
                     }
                 }
             },
             "delete": {
-                "description": "Proxies requests to docker instance running executable. Method passed to instance forwarded from req. Middleware figures out the instance URL to proxy the request to, based on ExternalId. Returns proxied response.",
+                "description": "Proxies requests to docker instance running executable. Method passed to instance forwarded from req. Middleware figures out the instance URL to proxy the request to, based on ExternalId. Returns proxied response. Server-sent events, streamed responses and WebSocket upgrades are passed through.",
+                "consumes": [
+                    "text/plain"
+                ],
+                "produces": [
+                    "*/*"
+                ],
+                "tags": [
+                    "Executions"
+                ],
+                "summary": "Make request to a REST function",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "External ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Path forwarded to the function",
+                        "name": "path",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Request successfully proxied and processed",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "413": {
+                        "description": "Request body larger than the function's max_request_body",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "502": {
+                        "description": "Function instance unavailable, or its response is larger than max_response_body",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "504": {
+                        "description": "Function instance did not respond within the function's timeout",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "options": {
+                "description": "Proxies requests to docker instance running executable. Method passed to instance forwarded from req. Middleware figures out the instance URL to proxy the request to, based on ExternalId. Returns proxied response. Server-sent events, streamed responses and WebSocket upgrades are passed through.",
+                "consumes": [
+                    "text/plain"
+                ],
+                "produces": [
+                    "*/*"
+                ],
+                "tags": [
+                    "Executions"
+                ],
+                "summary": "Make request to a REST function",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "External ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Path forwarded to the function",
+                        "name": "path",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Request successfully proxied and processed",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "413": {
+                        "description": "Request body larger than the function's max_request_body",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "502": {
+                        "description": "Function instance unavailable, or its response is larger than max_response_body",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "504": {
+                        "description": "Function instance did not respond within the function's timeout",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "head": {
+                "description": "Proxies requests to docker instance running executable. Method passed to instance forwarded from req. Middleware figures out the instance URL to proxy the request to, based on ExternalId. Returns proxied response. Server-sent events, streamed responses and WebSocket upgrades are passed through.",
+                "consumes": [
+                    "text/plain"
+                ],
+                "produces": [
+                    "*/*"
+                ],
+                "tags": [
+                    "Executions"
+                ],
+                "summary": "Make request to a REST function",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "External ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Path forwarded to the function",
+                        "name": "path",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Request successfully proxied and processed",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "413": {
+                        "description": "Request body larger than the function's max_request_body",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "502": {
+                        "description": "Function instance unavailable, or its response is larger than max_response_body",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "504": {
+                        "description": "Function instance did not respond within the function's timeout",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "description": "Proxies requests to docker instance running executable. Method passed to instance forwarded from req. Middleware figures out the instance URL to proxy the request to, based on ExternalId. Returns proxied response. Server-sent events, streamed responses and WebSocket upgrades are passed through.",
                 "consumes": [
                     "text/plain"
                 ],
@@ -164,6 +440,13 @@ const docTemplate = `{
                         "name": "id",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Path forwarded to the function",
+                        "name": "path",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
@@ -179,11 +462,29 @@ const docTemplate = `{
                             "$ref": "#/definitions/utils.ErrorResponse"
                         }
                     },
+                    "413": {
+                        "description": "Request body larger than the function's max_request_body",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
                             "$ref": "#/definitions/utils.ErrorResponse"
                         }
+                    },
+                    "502": {
+                        "description": "Function instance unavailable, or its response is larger than max_response_body",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "504": {
+                        "description": "Function instance did not respond within the function's timeout",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
                     }
                 }
             }
@@ -362,29 +663,612 @@ const docTemplate = `{
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "data.FunctionConfig": {
-            "type": "object",
-            "properties": {
-                "env_vars": {
-                    "type": "object",
-                    "additionalProperties": {
-                        "type": "string"
-                    }
-                },
-                "image": {
-                    "type": "string"
-                },
-                "port": {
-                    "type": "integer"
+        },
+        "/function/{id}/artifact": {
+            "get": {
+                "description": "Downloads the uploaded binary or jar of a function, used by the kubernetes backend to deliver it to pods.",
+                "produces": [
+                    "application/octet-stream"
+                ],
+                "tags": [
+                    "Functions"
+                ],
+                "summary": "Download a function's artifact",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Function ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Function artifact",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/function/{id}/cache": {
+            "delete": {
+                "description": "Removes every response of the function cached by the gateway, so the next requests reach the function. Responses are also purged when the function is updated or deleted.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Functions"
+                ],
+                "summary": "Purge the cached responses of a function",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Function ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Number of cached responses purged",
+                        "schema": {
+                            "$ref": "#/definitions/service.CachePurge"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/function/{id}/containers": {
+            "get": {
+                "description": "Returns the state, host ports and start time of every container of a function as last reported by docker, along with its most recent crashes and OOM kills.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Functions"
+                ],
+                "summary": "Get the containers of a function",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Function ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Containers and recent crashes of the function",
+                        "schema": {
+                            "$ref": "#/definitions/service.FunctionContainers"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/function/{id}/containers/{containerId}/logs": {
+            "get": {
+                "description": "Returns the stdout and stderr of a single container of a function, from whichever execution backend it runs on.",
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "Functions"
+                ],
+                "summary": "Get the logs of a container",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Function ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Container ID",
+                        "name": "containerId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of lines from the end of the logs to return, defaults to all",
+                        "name": "tail",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Container logs",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/function/{id}/scaling": {
+            "get": {
+                "description": "Returns the current instance count, load, and most recent autoscaler decisions for a function. Useful for debugging why a function did or did not scale.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Functions"
+                ],
+                "summary": "Get the scaling state of a function",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Function ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Scaling state of the function",
+                        "schema": {
+                            "$ref": "#/definitions/service.ScalingStatus"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/function/{id}/warm": {
+            "post": {
+                "description": "Starts instances of a REST function ahead of a known spike in traffic, and waits for them to become ready. Defaults to the function's warm_instances, or a single instance. The instances are kept running for the duration, even without requests.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Functions"
+                ],
+                "summary": "Pre-warm instances of a function",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Function ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of instances to keep warm",
+                        "name": "instances",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "How long to keep the instances warm, e.g 30m, defaults to 10m",
+                        "name": "duration",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Running instances of the function",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/service.Instance"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/routes": {
+            "get": {
+                "description": "Retrieves the custom domain and path routes that send requests to functions.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Routes"
+                ],
+                "summary": "List all routes",
+                "responses": {
+                    "200": {
+                        "description": "List of all routes",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/data.RouteEntity"
+                            }
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Sends requests for a host and/or path prefix to a function, by id or by name. Routes are matched before the execute path, and the path prefix is removed from the forwarded path unless keep_prefix is set.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Routes"
+                ],
+                "summary": "Create a route",
+                "parameters": [
+                    {
+                        "description": "Route to create",
+                        "name": "route",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/data.RouteEntity"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Route created successfully",
+                        "schema": {
+                            "$ref": "#/definitions/data.RouteEntity"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/routes/{id}": {
+            "put": {
+                "description": "Replaces an existing route.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Routes"
+                ],
+                "summary": "Update a route",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Route ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Updated route",
+                        "name": "route",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/data.RouteEntity"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Route updated successfully",
+                        "schema": {
+                            "$ref": "#/definitions/data.RouteEntity"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Deletes a route, requests for it are no longer sent to its function.",
+                "tags": [
+                    "Routes"
+                ],
+                "summary": "Delete a route",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Route ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "Route deleted successfully",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "data.AutoscalingConfig": {
+            "type": "object",
+            "properties": {
+                "scale_down_cooldown": {
+                    "type": "string",
+                    "example": "30s"
+                },
+                "scale_up_cooldown": {
+                    "type": "string",
+                    "example": "10s"
+                },
+                "stabilization_window": {
+                    "type": "string",
+                    "example": "1m"
+                },
+                "target_rps": {
+                    "description": "TargetRPS is the requests per second a single instance should serve, 0 scales on concurrency only",
+                    "type": "number"
+                }
+            }
+        },
+        "data.CacheConfig": {
+            "type": "object",
+            "properties": {
+                "ttl": {
+                    "description": "TTL is how long responses are cached, unless the function's Cache-Control max-age or s-maxage says otherwise",
+                    "type": "string",
+                    "example": "1h"
+                },
+                "vary": {
+                    "description": "Vary are the request headers that get their own cached responses, e.g \"Accept\"",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "Accept"
+                    ]
+                }
+            }
+        },
+        "data.CircuitBreakerConfig": {
+            "type": "object",
+            "properties": {
+                "failure_threshold": {
+                    "description": "FailureThreshold is the consecutive failed requests, after retries, that open the circuit",
+                    "type": "integer",
+                    "example": 5
+                },
+                "open_duration": {
+                    "description": "OpenDuration is how long requests are rejected before a trial request is let through, defaults to \"30s\"",
+                    "type": "string",
+                    "example": "30s"
+                }
+            }
+        },
+        "data.FunctionConfig": {
+            "type": "object",
+            "properties": {
+                "autoscaling": {
+                    "$ref": "#/definitions/data.AutoscalingConfig"
+                },
+                "cache": {
+                    "description": "Cache serves repeated GET and HEAD requests from responses cached at the gateway, without waking the function",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/data.CacheConfig"
+                        }
+                    ]
+                },
+                "circuit_breaker": {
+                    "description": "CircuitBreaker fails requests fast while the function's instances keep failing to respond",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/data.CircuitBreakerConfig"
+                        }
+                    ]
+                },
+                "concurrency_target": {
+                    "type": "integer"
+                },
+                "env_vars": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "health_check": {
+                    "$ref": "#/definitions/data.HealthCheckConfig"
+                },
+                "idle_timeout": {
+                    "description": "IdleTimeout is how long the function can go without requests before its instances are stopped,\ne.g \"2m\", or \"never\" to keep it warm. Empty uses the server default.",
+                    "type": "string",
+                    "example": "2m"
+                },
+                "image": {
+                    "type": "string"
+                },
+                "isolation": {
+                    "description": "Isolation is \"container\" by default, or \"vm\" to run the function's binary in its own microVM instead of sharing the host kernel",
+                    "type": "string",
+                    "example": "container"
+                },
+                "max_concurrency": {
+                    "description": "MaxConcurrency is the most requests a single instance serves at once, further requests wait in a queue. 0 is unlimited.",
+                    "type": "integer",
+                    "example": 2
+                },
+                "max_instances": {
+                    "type": "integer"
+                },
+                "max_request_body": {
+                    "description": "MaxRequestBody and MaxResponseBody limit the size of bodies in bytes, 0 is unlimited",
+                    "type": "integer",
+                    "example": 1048576
+                },
+                "max_response_body": {
+                    "type": "integer",
+                    "example": 10485760
+                },
+                "min_instances": {
+                    "description": "Scaling options, zero values fall back to the defaults of the instance pool",
+                    "type": "integer"
+                },
+                "port": {
+                    "type": "integer"
+                },
+                "queue": {
+                    "$ref": "#/definitions/data.QueueConfig"
+                },
+                "rate_limit": {
+                    "description": "RateLimit rejects requests over a rate or daily quota before they reach the function",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/data.RateLimitConfig"
+                        }
+                    ]
+                },
+                "retry": {
+                    "description": "Retry resends idempotent requests that failed to reach an instance",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/data.RetryConfig"
+                        }
+                    ]
+                },
+                "timeout": {
+                    "description": "Timeout bounds the wait for the function to start responding, e.g \"30s\". Streamed responses aren't cut off once started. Empty uses the server default.\nWebSocket connections are not bounded.",
+                    "type": "string",
+                    "example": "30s"
+                },
+                "transform": {
+                    "description": "Transform rewrites the headers and path of requests to the function, and the headers of its responses",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/data.TransformConfig"
+                        }
+                    ]
                 },
                 "trigger": {
                     "type": "string"
                 },
                 "type": {
                     "type": "string"
+                },
+                "version": {
+                    "description": "Version labels the deployed function, e.g \"1.4.2\", and is sent to it when transform.inject_headers is set",
+                    "type": "string",
+                    "example": "1.4.2"
+                },
+                "warm_instances": {
+                    "description": "WarmInstances are started when jambda boots and after every deploy, and are never stopped when idle",
+                    "type": "integer"
                 }
             }
         },
@@ -414,6 +1298,390 @@ const docTemplate = `{
                 }
             }
         },
+        "data.HeaderRules": {
+            "type": "object",
+            "properties": {
+                "add": {
+                    "description": "Add sets headers, replacing any values they have",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "remove": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "rename": {
+                    "description": "Rename moves the values of headers to new names, e.g {\"X-Api-Key\": \"X-Client-Key\"}",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "data.HealthCheckConfig": {
+            "type": "object",
+            "properties": {
+                "expected_status": {
+                    "description": "ExpectedStatus is the status code of a healthy response, defaults to 200",
+                    "type": "integer",
+                    "example": 200
+                },
+                "failure_threshold": {
+                    "description": "FailureThreshold is the consecutive failed liveness checks before an instance is restarted, defaults to 3",
+                    "type": "integer",
+                    "example": 3
+                },
+                "initial_delay": {
+                    "type": "string",
+                    "example": "0s"
+                },
+                "interval": {
+                    "type": "string",
+                    "example": "2s"
+                },
+                "liveness_interval": {
+                    "description": "LivenessInterval is how often running instances are checked, defaults to \"30s\"",
+                    "type": "string",
+                    "example": "30s"
+                },
+                "max_startup_time": {
+                    "type": "string",
+                    "example": "30s"
+                },
+                "path": {
+                    "description": "Path is requested on the instance, defaults to \"/health\"",
+                    "type": "string",
+                    "example": "/health"
+                },
+                "tcp_only": {
+                    "description": "TCPOnly only checks the function port accepts connections, for functions without a health route",
+                    "type": "boolean"
+                },
+                "timeout": {
+                    "type": "string",
+                    "example": "2s"
+                }
+            }
+        },
+        "data.PathRewrite": {
+            "type": "object",
+            "properties": {
+                "from": {
+                    "type": "string",
+                    "example": "/v1"
+                },
+                "to": {
+                    "type": "string",
+                    "example": "/api/v1"
+                }
+            }
+        },
+        "data.QueueConfig": {
+            "type": "object",
+            "properties": {
+                "max_size": {
+                    "description": "MaxSize is the most requests waiting at once, defaults to 100",
+                    "type": "integer",
+                    "example": 100
+                },
+                "max_wait": {
+                    "description": "MaxWait is how long a request waits before it gets a 503, defaults to \"30s\"",
+                    "type": "string",
+                    "example": "30s"
+                }
+            }
+        },
+        "data.RateLimitConfig": {
+            "type": "object",
+            "properties": {
+                "api_keys": {
+                    "description": "APIKeys are the X-Api-Key values limited separately with the \"api_key\" key, requests with any other key are limited by their ip",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "burst": {
+                    "description": "Burst is the requests allowed at once before RPS applies, defaults to RPS rounded up",
+                    "type": "integer",
+                    "example": 10
+                },
+                "daily_quota": {
+                    "description": "DailyQuota is the requests allowed for each key per UTC day, 0 is unlimited",
+                    "type": "integer",
+                    "example": 10000
+                },
+                "key": {
+                    "description": "Key is what requests are limited by, \"function\" for every client together (default), \"ip\" or \"api_key\"",
+                    "type": "string",
+                    "example": "ip"
+                },
+                "rps": {
+                    "description": "RPS is the sustained requests per second allowed for each key, 0 disables the rate limit",
+                    "type": "number",
+                    "example": 5
+                }
+            }
+        },
+        "data.RetryConfig": {
+            "type": "object",
+            "properties": {
+                "attempts": {
+                    "description": "Attempts is the number of retries after the first attempt",
+                    "type": "integer",
+                    "example": 2
+                },
+                "backoff": {
+                    "description": "Backoff is the wait before the first retry, doubling for each retry after it, defaults to \"100ms\". Waits are jittered.",
+                    "type": "string",
+                    "example": "100ms"
+                },
+                "max_backoff": {
+                    "description": "MaxBackoff caps the wait between retries, defaults to \"2s\"",
+                    "type": "string",
+                    "example": "2s"
+                }
+            }
+        },
+        "data.RouteEntity": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "function_id": {
+                    "description": "FunctionId is the function requests are sent to",
+                    "type": "string",
+                    "example": "ab12cd34"
+                },
+                "function_name": {
+                    "description": "FunctionName is an alias for the active function with this name, so the route keeps working when the function is recreated",
+                    "type": "string",
+                    "example": "weather"
+                },
+                "host": {
+                    "description": "Host matches the request's Host header, empty matches any host",
+                    "type": "string",
+                    "example": "api.home.lan"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "keep_prefix": {
+                    "description": "KeepPrefix forwards the full path to the function, by default the path prefix is removed",
+                    "type": "boolean"
+                },
+                "path_prefix": {
+                    "description": "PathPrefix matches the request path on segment boundaries, defaults to \"/\"",
+                    "type": "string",
+                    "example": "/weather"
+                },
+                "updated_at": {
+                    "type": "string"
+                }
+            }
+        },
+        "data.TransformConfig": {
+            "type": "object",
+            "properties": {
+                "inject_headers": {
+                    "description": "InjectHeaders sends the X-Jambda-Function-Id, X-Jambda-Function-Version and X-Jambda-Invocation-Id headers to the function",
+                    "type": "boolean"
+                },
+                "path_rewrites": {
+                    "description": "PathRewrites replace the prefix of the forwarded path with the first rewrite that matches",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/data.PathRewrite"
+                    }
+                },
+                "request": {
+                    "description": "Request rules apply after jambda sets the X-Forwarded-* and X-Real-IP headers, so they can be renamed or removed",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/data.HeaderRules"
+                        }
+                    ]
+                },
+                "response": {
+                    "description": "Response rules apply to the function's responses before they reach the client",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/data.HeaderRules"
+                        }
+                    ]
+                },
+                "strip_sensitive_headers": {
+                    "description": "StripSensitiveHeaders drops the client's credentials from requests, and headers revealing the function's server from responses",
+                    "type": "boolean"
+                }
+            }
+        },
+        "service.CachePurge": {
+            "type": "object",
+            "properties": {
+                "function_id": {
+                    "type": "string"
+                },
+                "purged": {
+                    "type": "integer"
+                }
+            }
+        },
+        "service.ContainerCrash": {
+            "type": "object",
+            "properties": {
+                "container_id": {
+                    "type": "string"
+                },
+                "exit_code": {
+                    "type": "integer"
+                },
+                "function_id": {
+                    "type": "string"
+                },
+                "oom_killed": {
+                    "type": "boolean"
+                },
+                "time": {
+                    "type": "string"
+                }
+            }
+        },
+        "service.ContainerRecord": {
+            "type": "object",
+            "properties": {
+                "container_id": {
+                    "type": "string"
+                },
+                "exit_code": {
+                    "type": "integer"
+                },
+                "finished_at": {
+                    "type": "string"
+                },
+                "function_id": {
+                    "type": "string"
+                },
+                "oom_killed": {
+                    "type": "boolean"
+                },
+                "ports": {
+                    "description": "Ports maps each exposed container port, e.g '8080/tcp', to its host port",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "started_at": {
+                    "type": "string"
+                },
+                "state": {
+                    "type": "string"
+                }
+            }
+        },
+        "service.FunctionContainers": {
+            "type": "object",
+            "properties": {
+                "containers": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/service.ContainerRecord"
+                    }
+                },
+                "crashes": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/service.ContainerCrash"
+                    }
+                },
+                "function_id": {
+                    "type": "string"
+                }
+            }
+        },
+        "service.Instance": {
+            "type": "object",
+            "properties": {
+                "container_id": {
+                    "type": "string"
+                },
+                "in_flight": {
+                    "type": "integer"
+                },
+                "started_at": {
+                    "type": "string"
+                },
+                "url": {
+                    "type": "string"
+                }
+            }
+        },
+        "service.ScalingDecision": {
+            "type": "object",
+            "properties": {
+                "action": {
+                    "type": "string"
+                },
+                "current_instances": {
+                    "type": "integer"
+                },
+                "desired_instances": {
+                    "type": "integer"
+                },
+                "in_flight": {
+                    "type": "integer"
+                },
+                "queued": {
+                    "type": "integer"
+                },
+                "reason": {
+                    "type": "string"
+                },
+                "rps": {
+                    "type": "number"
+                },
+                "time": {
+                    "type": "string"
+                }
+            }
+        },
+        "service.ScalingStatus": {
+            "type": "object",
+            "properties": {
+                "decisions": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/service.ScalingDecision"
+                    }
+                },
+                "function_id": {
+                    "type": "string"
+                },
+                "in_flight": {
+                    "type": "integer"
+                },
+                "instances": {
+                    "type": "integer"
+                },
+                "queued": {
+                    "type": "integer"
+                },
+                "rps": {
+                    "type": "number"
+                },
+                "timeouts": {
+                    "description": "Timeouts are the requests that the function didn't respond to within its timeout since jambda started",
+                    "type": "integer"
+                }
+            }
+        },
         "utils.ErrorResponse": {
             "type": "object",
             "properties": {
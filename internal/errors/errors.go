@@ -1,5 +1,7 @@
 package errors
 
+import "time"
+
 // NotFoundError represents a resource not found error
 type NotFoundError struct {
 	Message string
@@ -36,6 +38,27 @@ func (e *InternalError) Error() string {
 	return e.Message
 }
 
+// RateLimitError represents a request rejected by a rate limit or quota, which can be retried after RetryAfter
+type RateLimitError struct {
+	Message    string
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return e.Message
+}
+
+// UnavailableError represents a request that can't be served right now, e.g when a function's queue is full
+type UnavailableError struct {
+	Message string
+	// RetryAfter is when the request is expected to be served again, 0 if unknown
+	RetryAfter time.Duration
+}
+
+func (e *UnavailableError) Error() string {
+	return e.Message
+}
+
 func NewNotFoundError(message string) error {
 	return &NotFoundError{Message: message}
 }
@@ -51,3 +74,15 @@ func NewInternalError(message string) error {
 func NewDockerError(message string) error {
 	return &InternalError{Message: message}
 }
+
+func NewRateLimitError(message string, retryAfter time.Duration) error {
+	return &RateLimitError{Message: message, RetryAfter: retryAfter}
+}
+
+func NewUnavailableError(message string) error {
+	return &UnavailableError{Message: message}
+}
+
+func NewUnavailableErrorRetryAfter(message string, retryAfter time.Duration) error {
+	return &UnavailableError{Message: message, RetryAfter: retryAfter}
+}
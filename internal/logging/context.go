@@ -0,0 +1,18 @@
+package logging
+
+import "context"
+
+type loggerKey struct{}
+
+// NewContext returns a context carrying the logger, so request scoped fields like the invocation id reach every line logged for the request
+func NewContext(ctx context.Context, logger Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromContext returns the logger carried by the context, or fallback if it has none
+func FromContext(ctx context.Context, fallback Logger) Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(Logger); ok {
+		return logger
+	}
+	return fallback
+}
@@ -17,6 +17,8 @@ type Logger interface {
 	Errorf(format string, args ...interface{})
 	Fatal(msg string, args ...interface{})
 	Fatalf(format string, args ...interface{})
+	// With returns a logger adding the key value pairs to every line, e.g With("invocation_id", id)
+	With(args ...interface{}) Logger
 }
 
 // CustomLogger implements the Logger interface
@@ -90,6 +92,13 @@ func (l *CustomLogger) Fatalf(format string, args ...interface{}) {
 	l.slogger.Fatalf(format, args...)
 }
 
+// With returns a logger adding the key value pairs to every line
+func (l *CustomLogger) With(args ...interface{}) Logger {
+	return &CustomLogger{
+		slogger: l.slogger.With(args...),
+	}
+}
+
 // Global logger instance
 var (
 	globalLogger Logger
@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/jwtly10/jambda/api/data"
+)
+
+type IRouteRepository interface {
+	GetAllRoutes() ([]data.RouteEntity, error)
+	SaveRoute(route data.RouteEntity) (*data.RouteEntity, error)
+	UpdateRoute(id int, route data.RouteEntity) (*data.RouteEntity, error)
+	DeleteRoute(id int) error
+	GetActiveFunctionIdByName(name string) (string, error)
+}
+
+type RouteRepository struct {
+	Db *sql.DB
+}
+
+func NewRouteRepository(db *sql.DB) *RouteRepository {
+	return &RouteRepository{Db: db}
+}
+
+const routeColumns = `id, host, path_prefix, function_id, function_name, keep_prefix, created_at, updated_at`
+
+func (repo *RouteRepository) GetAllRoutes() ([]data.RouteEntity, error) {
+	rows, err := repo.Db.Query(`SELECT ` + routeColumns + ` FROM routes_tb ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("query execution failed: %w", err)
+	}
+	defer rows.Close()
+
+	var routes []data.RouteEntity
+	for rows.Next() {
+		route, err := scanRoute(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		routes = append(routes, *route)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return routes, nil
+}
+
+func (repo *RouteRepository) SaveRoute(route data.RouteEntity) (*data.RouteEntity, error) {
+	query := `
+    INSERT INTO routes_tb (host, path_prefix, function_id, function_name, keep_prefix)
+    VALUES ($1, $2, $3, $4, $5)
+    RETURNING ` + routeColumns + `;
+    `
+
+	row := repo.Db.QueryRow(query, route.Host, route.PathPrefix, route.FunctionId, route.FunctionName, route.KeepPrefix)
+	return scanRoute(row)
+}
+
+func (repo *RouteRepository) UpdateRoute(id int, route data.RouteEntity) (*data.RouteEntity, error) {
+	query := `
+    UPDATE routes_tb SET host = $2, path_prefix = $3, function_id = $4, function_name = $5, keep_prefix = $6, updated_at = NOW()
+    WHERE id = $1
+    RETURNING ` + routeColumns + `;
+    `
+
+	row := repo.Db.QueryRow(query, id, route.Host, route.PathPrefix, route.FunctionId, route.FunctionName, route.KeepPrefix)
+	updated, err := scanRoute(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return updated, err
+}
+
+func (repo *RouteRepository) DeleteRoute(id int) error {
+	result, err := repo.Db.Exec(`DELETE FROM routes_tb WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("error deleting route: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error retrieving affected rows: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// GetActiveFunctionIdByName returns the external id of the newest active function with the name, or "" if there is none
+func (repo *RouteRepository) GetActiveFunctionIdByName(name string) (string, error) {
+	query := `SELECT external_id FROM functions_tb WHERE name = $1 AND state = 'ACTIVE' ORDER BY created_at DESC LIMIT 1`
+
+	var externalId string
+	err := repo.Db.QueryRow(query, name).Scan(&externalId)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return externalId, err
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanRoute(row rowScanner) (*data.RouteEntity, error) {
+	var route data.RouteEntity
+	err := row.Scan(&route.ID, &route.Host, &route.PathPrefix, &route.FunctionId, &route.FunctionName, &route.KeepPrefix, &route.CreatedAt, &route.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &route, nil
+}
@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jwtly10/jambda/api/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var routeRowColumns = []string{"id", "host", "path_prefix", "function_id", "function_name", "keep_prefix", "created_at", "updated_at"}
+
+func TestGetAllRoutes(t *testing.T) {
+	db, mock, err := NewMock()
+	require.NoError(t, err)
+	defer db.Close()
+
+	rows := sqlmock.NewRows(routeRowColumns).
+		AddRow(1, "api.home.lan", "/weather", "ab12cd34", "", false, time.Now(), time.Now()).
+		AddRow(2, "", "/lights", "", "lights", true, time.Now(), time.Now())
+	mock.ExpectQuery(`SELECT id, host, path_prefix, function_id, function_name, keep_prefix, created_at, updated_at FROM routes_tb ORDER BY id`).
+		WillReturnRows(rows)
+
+	repo := NewRouteRepository(db)
+	routes, err := repo.GetAllRoutes()
+	require.NoError(t, err)
+	require.Len(t, routes, 2)
+	assert.Equal(t, "api.home.lan", routes[0].Host)
+	assert.Equal(t, "ab12cd34", routes[0].FunctionId)
+	assert.Equal(t, "lights", routes[1].FunctionName)
+	assert.True(t, routes[1].KeepPrefix)
+}
+
+func TestSaveRoute(t *testing.T) {
+	db, mock, err := NewMock()
+	require.NoError(t, err)
+	defer db.Close()
+
+	route := data.RouteEntity{Host: "api.home.lan", PathPrefix: "/weather", FunctionId: "ab12cd34"}
+	mock.ExpectQuery(`INSERT INTO routes_tb`).
+		WithArgs(route.Host, route.PathPrefix, route.FunctionId, route.FunctionName, route.KeepPrefix).
+		WillReturnRows(sqlmock.NewRows(routeRowColumns).AddRow(1, route.Host, route.PathPrefix, route.FunctionId, "", false, time.Now(), time.Now()))
+
+	repo := NewRouteRepository(db)
+	saved, err := repo.SaveRoute(route)
+	require.NoError(t, err)
+	assert.Equal(t, 1, saved.ID)
+	assert.Equal(t, "/weather", saved.PathPrefix)
+}
+
+func TestUpdateMissingRoute(t *testing.T) {
+	db, mock, err := NewMock()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery(`UPDATE routes_tb SET host = \$2`).
+		WithArgs(5, "", "/", "ab12cd34", "", false).
+		WillReturnError(sql.ErrNoRows)
+
+	repo := NewRouteRepository(db)
+	updated, err := repo.UpdateRoute(5, data.RouteEntity{PathPrefix: "/", FunctionId: "ab12cd34"})
+	assert.NoError(t, err)
+	assert.Nil(t, updated)
+}
+
+func TestGetActiveFunctionIdByName(t *testing.T) {
+	db, mock, err := NewMock()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery(`SELECT external_id FROM functions_tb WHERE name = \$1 AND state = 'ACTIVE' ORDER BY created_at DESC LIMIT 1`).
+		WithArgs("weather").
+		WillReturnRows(sqlmock.NewRows([]string{"external_id"}).AddRow("ef56ab78"))
+	mock.ExpectQuery(`SELECT external_id FROM functions_tb`).
+		WithArgs("missing").
+		WillReturnError(sql.ErrNoRows)
+
+	repo := NewRouteRepository(db)
+	id, err := repo.GetActiveFunctionIdByName("weather")
+	require.NoError(t, err)
+	assert.Equal(t, "ef56ab78", id)
+
+	id, err = repo.GetActiveFunctionIdByName("missing")
+	require.NoError(t, err)
+	assert.Equal(t, "", id)
+}
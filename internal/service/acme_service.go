@@ -0,0 +1,486 @@
+package service
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jwtly10/jambda/internal/logging"
+	"golang.org/x/crypto/acme"
+)
+
+const (
+	// acmeObtainTimeout bounds ordering a certificate, including solving its challenges
+	acmeObtainTimeout = 2 * time.Minute
+	// acmeRetryBackoff is how long a domain is left alone after failing to get a certificate for it
+	acmeRetryBackoff = time.Minute
+	// acmeRenewBefore is how long before expiry certificates are renewed
+	acmeRenewBefore    = 30 * 24 * time.Hour
+	acmeAccountKeyFile = "acme_account.key"
+)
+
+// ChallengeProvider proves control of a domain to the ACME server, e.g by serving a http-01 token or creating a dns-01 record
+type ChallengeProvider interface {
+	// Type is the ACME challenge type solved, e.g 'http-01'
+	Type() string
+	// Present makes the challenge response available, using the client to compute it
+	Present(ctx context.Context, client *acme.Client, domain string, chal *acme.Challenge) error
+	// CleanUp removes the challenge response once the challenge is finished
+	CleanUp(ctx context.Context, domain string, chal *acme.Challenge) error
+}
+
+// HTTP01Provider solves http-01 challenges, the responses are served on port 80 under /.well-known/acme-challenge/
+type HTTP01Provider struct {
+	mu        sync.RWMutex
+	responses map[string]string
+}
+
+func NewHTTP01Provider() *HTTP01Provider {
+	return &HTTP01Provider{
+		responses: make(map[string]string),
+	}
+}
+
+func (hp *HTTP01Provider) Type() string {
+	return "http-01"
+}
+
+func (hp *HTTP01Provider) Present(ctx context.Context, client *acme.Client, domain string, chal *acme.Challenge) error {
+	response, err := client.HTTP01ChallengeResponse(chal.Token)
+	if err != nil {
+		return err
+	}
+	hp.mu.Lock()
+	hp.responses[chal.Token] = response
+	hp.mu.Unlock()
+	return nil
+}
+
+func (hp *HTTP01Provider) CleanUp(ctx context.Context, domain string, chal *acme.Challenge) error {
+	hp.mu.Lock()
+	delete(hp.responses, chal.Token)
+	hp.mu.Unlock()
+	return nil
+}
+
+// Response returns the response to serve for a challenge token
+func (hp *HTTP01Provider) Response(token string) (string, bool) {
+	hp.mu.RLock()
+	defer hp.mu.RUnlock()
+	response, ok := hp.responses[token]
+	return response, ok
+}
+
+type AcmeConfig struct {
+	// DirectoryUrl is the ACME server, e.g 'https://acme-v02.api.letsencrypt.org/directory'
+	DirectoryUrl string
+	// Email is the contact of the ACME account, optional
+	Email string
+	// CacheDir is where the account key and certificates are stored, so they survive restarts
+	CacheDir string
+	// CAFile is an extra root CA trusted for the ACME server, e.g Pebble's test CA
+	CAFile string
+}
+
+// AcmeService issues certificates for the domains allowed by its host policy on their first TLS handshake,
+// and renews them before they expire
+type AcmeService struct {
+	log        logging.Logger
+	config     AcmeConfig
+	provider   ChallengeProvider
+	hostPolicy func(host string) bool
+	client     *acme.Client
+
+	mu         sync.Mutex
+	registered bool
+	certs      map[string]*tls.Certificate
+	// inflight is closed when the certificate being ordered for the domain is ready, or ordering it failed
+	inflight map[string]chan struct{}
+	failed   map[string]time.Time
+}
+
+func NewAcmeService(log logging.Logger, config AcmeConfig, provider ChallengeProvider, hostPolicy func(host string) bool) (*AcmeService, error) {
+	if err := os.MkdirAll(config.CacheDir, 0700); err != nil {
+		return nil, fmt.Errorf("error creating acme cache dir: %v", err)
+	}
+
+	key, err := loadOrCreateAccountKey(filepath.Join(config.CacheDir, acmeAccountKeyFile))
+	if err != nil {
+		return nil, err
+	}
+
+	httpClient := http.DefaultClient
+	if config.CAFile != "" {
+		httpClient, err = httpClientTrusting(config.CAFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &AcmeService{
+		log:        log,
+		config:     config,
+		provider:   provider,
+		hostPolicy: hostPolicy,
+		client: &acme.Client{
+			Key:          key,
+			DirectoryURL: config.DirectoryUrl,
+			HTTPClient:   httpClient,
+			UserAgent:    "jambda",
+		},
+		certs:    make(map[string]*tls.Certificate),
+		inflight: make(map[string]chan struct{}),
+		failed:   make(map[string]time.Time),
+	}, nil
+}
+
+// Manages returns whether certificates for the host are issued by ACME
+func (as *AcmeService) Manages(host string) bool {
+	return validCertDomain(host) && as.hostPolicy(host)
+}
+
+// GetCertificate returns the certificate for the server name of the handshake, ordering it if there isn't one yet
+func (as *AcmeService) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	domain := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	if !as.Manages(domain) {
+		return nil, fmt.Errorf("acme: host '%s' is not allowed", domain)
+	}
+
+	// Handshakes always have a context, hellos built by hand don't
+	parent := hello.Context()
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, cancel := context.WithTimeout(parent, acmeObtainTimeout)
+	defer cancel()
+	return as.Certificate(ctx, domain)
+}
+
+// Certificate returns the certificate for a domain, from memory, the cache dir, or by ordering a new one.
+// Concurrent calls for the same domain share one order.
+func (as *AcmeService) Certificate(ctx context.Context, domain string) (*tls.Certificate, error) {
+	for {
+		as.mu.Lock()
+		if cert, ok := as.certs[domain]; ok && time.Now().Before(cert.Leaf.NotAfter) {
+			as.mu.Unlock()
+			return cert, nil
+		}
+		if wait, busy := as.inflight[domain]; busy {
+			as.mu.Unlock()
+			select {
+			case <-wait:
+				continue
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		if failedAt, ok := as.failed[domain]; ok && time.Since(failedAt) < acmeRetryBackoff {
+			as.mu.Unlock()
+			return nil, fmt.Errorf("acme: getting a certificate for '%s' failed recently", domain)
+		}
+		done := make(chan struct{})
+		as.inflight[domain] = done
+		as.mu.Unlock()
+
+		cert, err := as.loadCert(domain)
+		if err != nil {
+			cert, err = as.obtain(ctx, domain)
+		}
+		as.finish(domain, done, cert, err)
+		return cert, err
+	}
+}
+
+// Run renews certificates close to expiry, checking every interval
+func (as *AcmeService) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		as.RenewExpiring()
+	}
+}
+
+// RenewExpiring orders new certificates for domains whose certificate expires within acmeRenewBefore.
+// The old certificate is served until the new one is ready.
+func (as *AcmeService) RenewExpiring() {
+	as.mu.Lock()
+	var expiring []string
+	for domain, cert := range as.certs {
+		if _, busy := as.inflight[domain]; !busy && time.Until(cert.Leaf.NotAfter) < acmeRenewBefore {
+			expiring = append(expiring, domain)
+		}
+	}
+	as.mu.Unlock()
+
+	for _, domain := range expiring {
+		as.mu.Lock()
+		if _, busy := as.inflight[domain]; busy {
+			as.mu.Unlock()
+			continue
+		}
+		done := make(chan struct{})
+		as.inflight[domain] = done
+		as.mu.Unlock()
+
+		as.log.Infof("Renewing certificate for '%s'", domain)
+		ctx, cancel := context.WithTimeout(context.Background(), acmeObtainTimeout)
+		cert, err := as.obtain(ctx, domain)
+		cancel()
+		as.finish(domain, done, cert, err)
+	}
+}
+
+func (as *AcmeService) finish(domain string, done chan struct{}, cert *tls.Certificate, err error) {
+	as.mu.Lock()
+	delete(as.inflight, domain)
+	if err != nil {
+		as.log.Errorf("Failed to get certificate for '%s': %v", domain, err)
+		as.failed[domain] = time.Now()
+	} else {
+		delete(as.failed, domain)
+		as.certs[domain] = cert
+	}
+	as.mu.Unlock()
+	close(done)
+}
+
+// obtain orders a certificate for the domain, solving its authorizations with the challenge provider
+func (as *AcmeService) obtain(ctx context.Context, domain string) (*tls.Certificate, error) {
+	if err := as.register(ctx); err != nil {
+		return nil, err
+	}
+
+	order, err := as.client.AuthorizeOrder(ctx, acme.DomainIDs(domain))
+	if err != nil {
+		return nil, fmt.Errorf("error creating order: %v", err)
+	}
+
+	for _, authzUrl := range order.AuthzURLs {
+		if err := as.authorize(ctx, domain, authzUrl); err != nil {
+			return nil, err
+		}
+	}
+
+	order, err = as.client.WaitOrder(ctx, order.URI)
+	if err != nil {
+		return nil, fmt.Errorf("error waiting for order: %v", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: domain},
+		DNSNames: []string{domain},
+	}, key)
+	if err != nil {
+		return nil, fmt.Errorf("error creating certificate request: %v", err)
+	}
+
+	der, _, err := as.client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return nil, fmt.Errorf("error finalizing order: %v", err)
+	}
+
+	cert, err := as.saveCert(domain, der, key)
+	if err != nil {
+		return nil, err
+	}
+	as.log.Infof("Issued certificate for '%s', valid until %s", domain, cert.Leaf.NotAfter.Format(time.RFC3339))
+	return cert, nil
+}
+
+func (as *AcmeService) authorize(ctx context.Context, domain string, authzUrl string) error {
+	authz, err := as.client.GetAuthorization(ctx, authzUrl)
+	if err != nil {
+		return fmt.Errorf("error getting authorization: %v", err)
+	}
+	if authz.Status == acme.StatusValid {
+		return nil
+	}
+
+	var chal *acme.Challenge
+	for _, c := range authz.Challenges {
+		if c.Type == as.provider.Type() {
+			chal = c
+			break
+		}
+	}
+	if chal == nil {
+		return fmt.Errorf("acme server offered no '%s' challenge for '%s'", as.provider.Type(), domain)
+	}
+
+	if err := as.provider.Present(ctx, as.client, domain, chal); err != nil {
+		return fmt.Errorf("error presenting '%s' challenge: %v", chal.Type, err)
+	}
+	defer func() {
+		if err := as.provider.CleanUp(context.Background(), domain, chal); err != nil {
+			as.log.Warn("Failed to clean up acme challenge", "domain", domain, "error", err)
+		}
+	}()
+
+	if _, err := as.client.Accept(ctx, chal); err != nil {
+		return fmt.Errorf("error accepting challenge: %v", err)
+	}
+	if _, err := as.client.WaitAuthorization(ctx, authz.URI); err != nil {
+		return fmt.Errorf("authorization for '%s' failed: %v", domain, err)
+	}
+	return nil
+}
+
+func (as *AcmeService) register(ctx context.Context) error {
+	as.mu.Lock()
+	registered := as.registered
+	as.mu.Unlock()
+	if registered {
+		return nil
+	}
+
+	account := &acme.Account{}
+	if as.config.Email != "" {
+		account.Contact = []string{"mailto:" + as.config.Email}
+	}
+	_, err := as.client.Register(ctx, account, acme.AcceptTOS)
+	if err != nil && !errors.Is(err, acme.ErrAccountAlreadyExists) {
+		return fmt.Errorf("error registering acme account: %v", err)
+	}
+
+	as.mu.Lock()
+	as.registered = true
+	as.mu.Unlock()
+	return nil
+}
+
+// saveCert writes the key and chain of a certificate to a single pem file in the cache dir
+func (as *AcmeService) saveCert(domain string, der [][]byte, key *ecdsa.PrivateKey) (*tls.Certificate, error) {
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	buf := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	for _, b := range der {
+		buf = append(buf, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: b})...)
+	}
+
+	if err := os.WriteFile(as.certPath(domain), buf, 0600); err != nil {
+		return nil, fmt.Errorf("error caching certificate: %v", err)
+	}
+	return parseCertPem(buf)
+}
+
+// loadCert returns the cached certificate of a domain, if it hasn't expired
+func (as *AcmeService) loadCert(domain string) (*tls.Certificate, error) {
+	buf, err := os.ReadFile(as.certPath(domain))
+	if err != nil {
+		return nil, err
+	}
+	cert, err := parseCertPem(buf)
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(cert.Leaf.NotAfter) {
+		return nil, fmt.Errorf("cached certificate for '%s' has expired", domain)
+	}
+	return cert, nil
+}
+
+func (as *AcmeService) certPath(domain string) string {
+	return filepath.Join(as.config.CacheDir, domain+".pem")
+}
+
+func parseCertPem(buf []byte) (*tls.Certificate, error) {
+	cert, err := tls.X509KeyPair(buf, buf)
+	if err != nil {
+		return nil, err
+	}
+	if cert.Leaf == nil {
+		cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &cert, nil
+}
+
+func loadOrCreateAccountKey(path string) (crypto.Signer, error) {
+	if buf, err := os.ReadFile(path); err == nil {
+		block, _ := pem.Decode(buf)
+		if block == nil {
+			return nil, fmt.Errorf("invalid acme account key '%s'", path)
+		}
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		return nil, fmt.Errorf("error saving acme account key: %v", err)
+	}
+	return key, nil
+}
+
+func httpClientTrusting(caFile string) (*http.Client, error) {
+	ca, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading acme ca file: %v", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificates found in acme ca file '%s'", caFile)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	return &http.Client{Transport: transport}, nil
+}
+
+// validCertDomain rejects server names that can't be a domain, as they're used in cache file names
+func validCertDomain(domain string) bool {
+	return domain != "" && !strings.ContainsAny(domain, `/\:`) && !strings.Contains(domain, "..")
+}
+
+// NewTLSConfig serves the file certificate for the names it covers, and ACME certificates for other managed hosts.
+// Either may be nil.
+func NewTLSConfig(file *FileCertificate, acmeService *AcmeService) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"h2", "http/1.1"},
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			if file != nil && (hello.ServerName == "" || file.Covers(hello.ServerName)) {
+				return file.GetCertificate(hello)
+			}
+			if acmeService != nil && acmeService.Manages(strings.ToLower(hello.ServerName)) {
+				return acmeService.GetCertificate(hello)
+			}
+			if file != nil {
+				return file.GetCertificate(hello)
+			}
+			return nil, fmt.Errorf("no certificate for '%s'", hello.ServerName)
+		},
+	}
+}
@@ -0,0 +1,157 @@
+package service
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jwtly10/jambda/internal/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zapcore"
+	"golang.org/x/crypto/acme"
+)
+
+func TestAcmeServiceUsesCachedCertificate(t *testing.T) {
+	logger := logging.NewLogger(false, zapcore.DebugLevel)
+	cacheDir := t.TempDir()
+	// Nothing listens here, so any attempt to order a certificate fails
+	config := AcmeConfig{DirectoryUrl: "http://127.0.0.1:1/directory", CacheDir: cacheDir}
+	policy := func(host string) bool { return strings.HasSuffix(host, ".home.lan") }
+
+	as, err := NewAcmeService(logger, config, NewHTTP01Provider(), policy)
+	require.NoError(t, err)
+	assert.FileExists(t, filepath.Join(cacheDir, acmeAccountKeyFile))
+
+	certPem, keyPem := selfSignedPem(t, "weather.home.lan", time.Now().Add(24*time.Hour))
+	require.NoError(t, os.WriteFile(filepath.Join(cacheDir, "weather.home.lan.pem"), append(keyPem, certPem...), 0600))
+
+	cert, err := as.Certificate(context.Background(), "weather.home.lan")
+	require.NoError(t, err)
+	assert.Equal(t, "weather.home.lan", cert.Leaf.Subject.CommonName)
+
+	assert.False(t, as.Manages("example.com"))
+	assert.False(t, as.Manages("../x.home.lan"))
+
+	// Failures aren't retried straight away
+	_, err = as.Certificate(context.Background(), "api.home.lan")
+	assert.Error(t, err)
+	_, err = as.Certificate(context.Background(), "api.home.lan")
+	assert.ErrorContains(t, err, "failed recently")
+
+	// The account key is reused after a restart
+	again, err := NewAcmeService(logger, config, NewHTTP01Provider(), policy)
+	require.NoError(t, err)
+	assert.Equal(t, as.client.Key.Public(), again.client.Key.Public())
+}
+
+func TestTLSConfigSelectsCertificate(t *testing.T) {
+	logger := logging.NewLogger(false, zapcore.DebugLevel)
+	certFile, keyFile := writeCertFiles(t, t.TempDir(), "jambda.home.lan", time.Now())
+	fc, err := NewFileCertificate(logger, certFile, keyFile)
+	require.NoError(t, err)
+
+	cacheDir := t.TempDir()
+	as, err := NewAcmeService(logger, AcmeConfig{DirectoryUrl: "http://127.0.0.1:1/directory", CacheDir: cacheDir}, NewHTTP01Provider(), func(host string) bool {
+		return host == "weather.home.lan"
+	})
+	require.NoError(t, err)
+	certPem, keyPem := selfSignedPem(t, "weather.home.lan", time.Now().Add(24*time.Hour))
+	require.NoError(t, os.WriteFile(filepath.Join(cacheDir, "weather.home.lan.pem"), append(keyPem, certPem...), 0600))
+
+	config := NewTLSConfig(fc, as)
+	for serverName, expected := range map[string]string{
+		"jambda.home.lan":  "jambda.home.lan",
+		"WEATHER.home.lan": "weather.home.lan",
+		"":                 "jambda.home.lan",
+		"unknown.home.lan": "jambda.home.lan",
+	} {
+		cert, err := config.GetCertificate(&tls.ClientHelloInfo{ServerName: serverName})
+		require.NoError(t, err)
+		assert.Equal(t, expected, cert.Leaf.Subject.CommonName, serverName)
+	}
+
+	_, err = NewTLSConfig(nil, as).GetCertificate(&tls.ClientHelloInfo{ServerName: "unknown.home.lan"})
+	assert.Error(t, err)
+}
+
+func TestHTTP01Provider(t *testing.T) {
+	key, err := loadOrCreateAccountKey(filepath.Join(t.TempDir(), acmeAccountKeyFile))
+	require.NoError(t, err)
+	client := &acme.Client{Key: key}
+	provider := NewHTTP01Provider()
+	chal := &acme.Challenge{Type: "http-01", Token: "token"}
+
+	require.NoError(t, provider.Present(context.Background(), client, "weather.home.lan", chal))
+	response, ok := provider.Response("token")
+	assert.True(t, ok)
+	expected, _ := client.HTTP01ChallengeResponse("token")
+	assert.Equal(t, expected, response)
+
+	require.NoError(t, provider.CleanUp(context.Background(), "weather.home.lan", chal))
+	_, ok = provider.Response("token")
+	assert.False(t, ok)
+}
+
+// TestAcmeServiceWithPebble orders a real certificate from a Pebble ACME test server. It runs when PEBBLE_DIRECTORY_URL is set,
+// e.g 'https://localhost:14000/dir', along with PEBBLE_CA_FILE for Pebble's CA. Pebble must be able to reach PEBBLE_HTTP_ADDR
+// (default ':5002') for PEBBLE_DOMAIN, or run with PEBBLE_VA_ALWAYS_VALID=1.
+func TestAcmeServiceWithPebble(t *testing.T) {
+	directoryUrl := os.Getenv("PEBBLE_DIRECTORY_URL")
+	if directoryUrl == "" {
+		t.Skip("PEBBLE_DIRECTORY_URL is not set")
+	}
+	domain := os.Getenv("PEBBLE_DOMAIN")
+	if domain == "" {
+		domain = "jambda.localhost"
+	}
+	httpAddr := os.Getenv("PEBBLE_HTTP_ADDR")
+	if httpAddr == "" {
+		httpAddr = ":5002"
+	}
+
+	logger := logging.NewLogger(false, zapcore.DebugLevel)
+	provider := NewHTTP01Provider()
+	as, err := NewAcmeService(logger, AcmeConfig{
+		DirectoryUrl: directoryUrl,
+		CacheDir:     t.TempDir(),
+		CAFile:       os.Getenv("PEBBLE_CA_FILE"),
+	}, provider, func(host string) bool { return host == domain })
+	require.NoError(t, err)
+
+	listener, err := net.Listen("tcp", httpAddr)
+	require.NoError(t, err)
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response, ok := provider.Response(strings.TrimPrefix(r.URL.Path, "/.well-known/acme-challenge/"))
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(response))
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), acmeObtainTimeout)
+	defer cancel()
+	cert, err := as.Certificate(ctx, domain)
+	require.NoError(t, err)
+	assert.NoError(t, cert.Leaf.VerifyHostname(domain))
+	assert.FileExists(t, as.certPath(domain))
+
+	// Renewing replaces the certificate
+	as.mu.Lock()
+	as.certs[domain].Leaf = &x509.Certificate{NotAfter: time.Now().Add(time.Hour)}
+	as.mu.Unlock()
+	as.RenewExpiring()
+	renewed, err := as.Certificate(ctx, domain)
+	require.NoError(t, err)
+	assert.NotEqual(t, cert.Certificate[0], renewed.Certificate[0])
+}
@@ -0,0 +1,300 @@
+package service
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/jwtly10/jambda/api/data"
+	"github.com/jwtly10/jambda/internal/logging"
+)
+
+const (
+	defaultScaleUpCooldown     = 10 * time.Second
+	defaultScaleDownCooldown   = 30 * time.Second
+	defaultStabilizationWindow = time.Minute
+
+	// maxScalingDecisions is the number of decisions kept per function for debugging
+	maxScalingDecisions = 50
+)
+
+const (
+	ScaleActionNone = "none"
+	ScaleActionUp   = "scale_up"
+	ScaleActionDown = "scale_down"
+)
+
+// ScalingDecision is a single evaluation of the autoscaler that changed, or wanted to change, the instance count of a function
+type ScalingDecision struct {
+	Time             time.Time `json:"time"`
+	Action           string    `json:"action"`
+	Reason           string    `json:"reason"`
+	CurrentInstances int       `json:"current_instances"`
+	DesiredInstances int       `json:"desired_instances"`
+	InFlight         int       `json:"in_flight"`
+	Queued           int       `json:"queued"`
+	RPS              float64   `json:"rps"`
+}
+
+// ScalingStatus is the current scaling state of a function, with its most recent decisions first
+type ScalingStatus struct {
+	FunctionId string  `json:"function_id"`
+	Instances  int     `json:"instances"`
+	InFlight   int     `json:"in_flight"`
+	Queued     int     `json:"queued"`
+	RPS        float64 `json:"rps"`
+	// Timeouts are the requests that the function didn't respond to within its timeout since jambda started
+	Timeouts  int               `json:"timeouts"`
+	Decisions []ScalingDecision `json:"decisions"`
+}
+
+type recommendation struct {
+	time    time.Time
+	desired int
+}
+
+type scalingState struct {
+	recommendations []recommendation
+	lastScaleUp     time.Time
+	lastScaleDown   time.Time
+	decisions       []ScalingDecision
+}
+
+// AutoscalerService periodically scales the instances of every warm function,
+// based on the in flight requests and requests per second tracked by the RequestStatsService.
+// Scaling a function down to zero is left to the idle check.
+type AutoscalerService struct {
+	log    logging.Logger
+	ps     *InstancePoolService
+	rs     *RequestStatsService
+	mu     sync.Mutex
+	states map[string]*scalingState
+}
+
+func NewAutoscalerService(log logging.Logger, ps *InstancePoolService, rs *RequestStatsService) *AutoscalerService {
+	return &AutoscalerService{
+		log:    log,
+		ps:     ps,
+		rs:     rs,
+		states: make(map[string]*scalingState),
+	}
+}
+
+// Run evaluates all warm functions every interval, it never returns
+func (as *AutoscalerService) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		as.Evaluate()
+	}
+}
+
+// Evaluate runs a single autoscaling pass over all warm functions
+func (as *AutoscalerService) Evaluate() {
+	now := time.Now()
+	for functionId, config := range as.ps.GetPooledFunctions() {
+		as.evaluateFunction(functionId, config, now)
+	}
+}
+
+func (as *AutoscalerService) evaluateFunction(functionId string, config data.FunctionConfig, now time.Time) {
+	current := as.ps.GetInstanceCount(functionId)
+	inFlight, rps := as.rs.GetLoad(functionId)
+	queued := as.ps.GetQueueDepth(functionId)
+	warmFloor, _ := as.ps.WarmFloor(functionId, now)
+	desired := desiredInstances(config, inFlight, rps, warmFloor)
+	if byQueue := queuedInstances(config, current, queued); byQueue > desired {
+		desired = byQueue
+	}
+
+	as.mu.Lock()
+	state := as.getState(functionId)
+	decision := state.decide(config, current, desired, now)
+	decision.InFlight = inFlight
+	decision.Queued = queued
+	decision.RPS = rps
+	if decision.Reason != "" {
+		state.record(decision)
+	}
+	as.mu.Unlock()
+
+	switch decision.Action {
+	case ScaleActionUp:
+		as.log.Infof("Autoscaler scaling function '%s' up from %d to %d instances: %s", functionId, current, decision.DesiredInstances, decision.Reason)
+		as.ps.ScaleUp(functionId, decision.DesiredInstances-current)
+	case ScaleActionDown:
+		as.log.Infof("Autoscaler scaling function '%s' down from %d to %d instances: %s", functionId, current, decision.DesiredInstances, decision.Reason)
+		stopped := as.ps.ScaleDown(functionId, current-decision.DesiredInstances)
+		if stopped < current-decision.DesiredInstances {
+			as.log.Infof("Only %d idle instances of function '%s' could be stopped", stopped, functionId)
+		}
+	}
+}
+
+// GetScalingStatus returns the current load and recent scaling decisions of a function
+func (as *AutoscalerService) GetScalingStatus(functionId string) ScalingStatus {
+	inFlight, rps := as.rs.GetLoad(functionId)
+	status := ScalingStatus{
+		FunctionId: functionId,
+		Instances:  as.ps.GetInstanceCount(functionId),
+		InFlight:   inFlight,
+		Queued:     as.ps.GetQueueDepth(functionId),
+		RPS:        rps,
+		Timeouts:   as.rs.GetTimeouts(functionId),
+		Decisions:  []ScalingDecision{},
+	}
+
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	if state, exists := as.states[functionId]; exists {
+		for i := len(state.decisions) - 1; i >= 0; i-- {
+			status.Decisions = append(status.Decisions, state.decisions[i])
+		}
+	}
+	return status
+}
+
+// getState must be called with the lock held
+func (as *AutoscalerService) getState(functionId string) *scalingState {
+	state, exists := as.states[functionId]
+	if !exists {
+		state = &scalingState{}
+		as.states[functionId] = state
+	}
+	return state
+}
+
+// decide works out the scaling action for a function given the current and desired instance counts.
+// Scale ups are applied immediately unless in cooldown, scale downs use the highest recommendation
+// within the stabilization window so short dips in traffic don't cause flapping.
+// A decision with an empty reason means nothing happened worth recording.
+func (s *scalingState) decide(config data.FunctionConfig, current, desired int, now time.Time) ScalingDecision {
+	upCooldown, downCooldown, window := scalingTimings(config)
+
+	s.recommendations = append(s.recommendations, recommendation{time: now, desired: desired})
+	kept := s.recommendations[:0]
+	for _, rec := range s.recommendations {
+		if now.Sub(rec.time) <= window {
+			kept = append(kept, rec)
+		}
+	}
+	s.recommendations = kept
+
+	decision := ScalingDecision{
+		Time:             now,
+		Action:           ScaleActionNone,
+		CurrentInstances: current,
+		DesiredInstances: desired,
+	}
+
+	switch {
+	case desired > current:
+		if now.Sub(s.lastScaleUp) < upCooldown {
+			decision.Reason = "scale up blocked by cooldown"
+			return decision
+		}
+		s.lastScaleUp = now
+		decision.Action = ScaleActionUp
+		decision.Reason = "load above target"
+	case desired < current:
+		stabilized := desired
+		for _, rec := range s.recommendations {
+			if rec.desired > stabilized {
+				stabilized = rec.desired
+			}
+		}
+		if stabilized >= current {
+			decision.DesiredInstances = current
+			decision.Reason = "scale down held by stabilization window"
+			return decision
+		}
+
+		decision.DesiredInstances = stabilized
+		lastScale := s.lastScaleUp
+		if s.lastScaleDown.After(lastScale) {
+			lastScale = s.lastScaleDown
+		}
+		if now.Sub(lastScale) < downCooldown {
+			decision.Reason = "scale down blocked by cooldown"
+			return decision
+		}
+		s.lastScaleDown = now
+		decision.Action = ScaleActionDown
+		decision.Reason = "load below target"
+	}
+
+	return decision
+}
+
+// record keeps a decision, skipping repeats of the previous decision so a held scale down isn't logged every pass
+func (s *scalingState) record(decision ScalingDecision) {
+	if n := len(s.decisions); n > 0 && decision.Action == ScaleActionNone {
+		last := s.decisions[n-1]
+		if last.Action == decision.Action && last.Reason == decision.Reason &&
+			last.CurrentInstances == decision.CurrentInstances && last.DesiredInstances == decision.DesiredInstances {
+			return
+		}
+	}
+
+	s.decisions = append(s.decisions, decision)
+	if len(s.decisions) > maxScalingDecisions {
+		s.decisions = s.decisions[len(s.decisions)-maxScalingDecisions:]
+	}
+}
+
+// desiredInstances is the instance count needed to keep both the concurrency and rps per instance under target.
+// A warm function always keeps at least one instance, and never drops below its min or warm instances,
+// or the warm floor of instances warmed ahead of a spike.
+func desiredInstances(config data.FunctionConfig, inFlight int, rps float64, warmFloor int) int {
+	desired := int(math.Ceil(float64(inFlight) / float64(concurrencyTarget(config))))
+	if config.Autoscaling != nil && config.Autoscaling.TargetRPS > 0 {
+		byRPS := int(math.Ceil(rps / config.Autoscaling.TargetRPS))
+		if byRPS > desired {
+			desired = byRPS
+		}
+	}
+
+	minimum := minInstances(config)
+	if minimum < 1 {
+		minimum = 1
+	}
+	if warmFloor > minimum {
+		minimum = warmFloor
+	}
+	if desired < minimum {
+		desired = minimum
+	}
+	if maximum := maxInstances(config); desired > maximum {
+		desired = maximum
+	}
+	return desired
+}
+
+// queuedInstances is the instance count needed to serve the queued requests of a function, on top of its current instances,
+// as requests are only queued once every instance is at max_concurrency
+func queuedInstances(config data.FunctionConfig, current int, queued int) int {
+	if queued == 0 || config.MaxConcurrency == 0 {
+		return 0
+	}
+	desired := current + int(math.Ceil(float64(queued)/float64(config.MaxConcurrency)))
+	if maximum := maxInstances(config); desired > maximum {
+		desired = maximum
+	}
+	return desired
+}
+
+func scalingTimings(config data.FunctionConfig) (time.Duration, time.Duration, time.Duration) {
+	upCooldown, downCooldown, window := defaultScaleUpCooldown, defaultScaleDownCooldown, defaultStabilizationWindow
+	if as := config.Autoscaling; as != nil {
+		if as.ScaleUpCooldown > 0 {
+			upCooldown = as.ScaleUpCooldown.Std()
+		}
+		if as.ScaleDownCooldown > 0 {
+			downCooldown = as.ScaleDownCooldown.Std()
+		}
+		if as.StabilizationWindow > 0 {
+			window = as.StabilizationWindow.Std()
+		}
+	}
+	return upCooldown, downCooldown, window
+}
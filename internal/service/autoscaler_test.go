@@ -0,0 +1,163 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jwtly10/jambda/api/data"
+	"github.com/jwtly10/jambda/internal/logging"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestDesiredInstances(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    data.FunctionConfig
+		inFlight  int
+		rps       float64
+		warmFloor int
+		expected  int
+	}{
+		{
+			name:     "idle function keeps one instance",
+			config:   data.FunctionConfig{MaxInstances: 5},
+			expected: 1,
+		},
+		{
+			name:     "idle function keeps min instances",
+			config:   data.FunctionConfig{MinInstances: 2, MaxInstances: 5},
+			expected: 2,
+		},
+		{
+			name:     "scales on concurrency",
+			config:   data.FunctionConfig{MaxInstances: 5, ConcurrencyTarget: 4},
+			inFlight: 9,
+			expected: 3,
+		},
+		{
+			name: "scales on rps",
+			config: data.FunctionConfig{
+				MaxInstances: 5,
+				Autoscaling:  &data.AutoscalingConfig{TargetRPS: 10},
+			},
+			inFlight: 1,
+			rps:      35,
+			expected: 4,
+		},
+		{
+			name:     "capped at max instances",
+			config:   data.FunctionConfig{MaxInstances: 3, ConcurrencyTarget: 1},
+			inFlight: 20,
+			expected: 3,
+		},
+		{
+			name:      "idle function keeps its warm floor",
+			config:    data.FunctionConfig{MaxInstances: 5},
+			warmFloor: 4,
+			expected:  4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, desiredInstances(tt.config, tt.inFlight, tt.rps, tt.warmFloor))
+		})
+	}
+}
+
+func TestQueuedInstances(t *testing.T) {
+	config := data.FunctionConfig{MaxInstances: 4, MaxConcurrency: 2}
+
+	assert.Equal(t, 0, queuedInstances(config, 1, 0))
+	assert.Equal(t, 2, queuedInstances(config, 1, 1))
+	assert.Equal(t, 3, queuedInstances(config, 1, 3))
+	assert.Equal(t, 4, queuedInstances(config, 2, 20))
+	assert.Equal(t, 0, queuedInstances(data.FunctionConfig{MaxInstances: 4}, 1, 3))
+
+	// The concurrency target is capped at max_concurrency
+	assert.Equal(t, 2, desiredInstances(config, 3, 0, 0))
+}
+
+func TestScalingDecisions(t *testing.T) {
+	config := data.FunctionConfig{
+		MaxInstances: 5,
+		Autoscaling: &data.AutoscalingConfig{
+			ScaleUpCooldown:     data.Duration(10 * time.Second),
+			ScaleDownCooldown:   data.Duration(30 * time.Second),
+			StabilizationWindow: data.Duration(time.Minute),
+		},
+	}
+	start := time.Now()
+	state := &scalingState{}
+
+	// Scale up straight away
+	decision := state.decide(config, 1, 3, start)
+	assert.Equal(t, ScaleActionUp, decision.Action)
+	assert.Equal(t, 3, decision.DesiredInstances)
+
+	// A further scale up inside the cooldown is blocked
+	decision = state.decide(config, 3, 4, start.Add(5*time.Second))
+	assert.Equal(t, ScaleActionNone, decision.Action)
+	assert.Equal(t, "scale up blocked by cooldown", decision.Reason)
+
+	// Load drops, but the higher recommendations are still within the stabilization window
+	decision = state.decide(config, 3, 1, start.Add(40*time.Second))
+	assert.Equal(t, ScaleActionNone, decision.Action)
+	assert.Equal(t, "scale down held by stabilization window", decision.Reason)
+
+	// Once the window has passed the scale down goes ahead
+	decision = state.decide(config, 3, 1, start.Add(70*time.Second))
+	assert.Equal(t, ScaleActionDown, decision.Action)
+	assert.Equal(t, 1, decision.DesiredInstances)
+
+	// Another scale down inside the cooldown is blocked
+	decision = state.decide(config, 2, 1, start.Add(90*time.Second))
+	assert.Equal(t, ScaleActionNone, decision.Action)
+	assert.Equal(t, "scale down blocked by cooldown", decision.Reason)
+
+	// Steady load records nothing
+	decision = state.decide(config, 1, 1, start.Add(100*time.Second))
+	assert.Equal(t, ScaleActionNone, decision.Action)
+	assert.Empty(t, decision.Reason)
+}
+
+func TestRecordSkipsRepeatedDecisions(t *testing.T) {
+	state := &scalingState{}
+	held := ScalingDecision{Action: ScaleActionNone, Reason: "scale down held by stabilization window", CurrentInstances: 2, DesiredInstances: 2}
+
+	state.record(held)
+	state.record(held)
+	state.record(ScalingDecision{Action: ScaleActionDown, Reason: "load below target", CurrentInstances: 2, DesiredInstances: 1})
+
+	assert.Len(t, state.decisions, 2)
+}
+
+func TestEvaluateKeepsWarmedInstances(t *testing.T) {
+	logger := logging.NewLogger(false, zapcore.DebugLevel)
+	ps := NewInstancePoolService(logger, NewProcessBackend(logger, NewContainerRegistry(logger), t.TempDir(), ProcessSandbox{}))
+	rs := NewRequestStatsService(logger)
+	as := NewAutoscalerService(logger, ps, rs)
+
+	now := time.Now()
+	ps.pools["abc"] = &functionPool{
+		instances: []*Instance{{ContainerId: "c1", StartedAt: now}, {ContainerId: "c2", StartedAt: now}, {ContainerId: "c3", StartedAt: now}},
+		config:    data.FunctionConfig{MaxInstances: 5},
+	}
+	ps.HoldWarm("abc", 3, now.Add(time.Hour))
+
+	// Without load the function would scale down to a single instance
+	as.Evaluate()
+	assert.Equal(t, 3, ps.GetInstanceCount("abc"))
+
+	// The idle scheduler holds them too, waking once the hold expires
+	scheduler := NewIdleScheduler(logger, ps, rs, time.Minute)
+	next, ok := scheduler.StopIdleFunctions(now.Add(30 * time.Minute))
+	assert.True(t, ok)
+	assert.Equal(t, now.Add(time.Hour), next)
+	assert.Equal(t, 3, ps.GetInstanceCount("abc"))
+
+	// Once expired, the hold no longer counts
+	floor, _ := ps.WarmFloor("abc", now.Add(2*time.Hour))
+	assert.Equal(t, 0, floor)
+}
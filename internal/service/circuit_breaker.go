@@ -0,0 +1,137 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jwtly10/jambda/api/data"
+	"github.com/jwtly10/jambda/internal/errors"
+	"github.com/jwtly10/jambda/internal/logging"
+)
+
+const defaultCircuitOpenDuration = 30 * time.Second
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	// circuitHalfOpen lets a single trial request through, which closes the circuit if it succeeds
+	circuitHalfOpen
+)
+
+type circuit struct {
+	state    circuitState
+	failures int
+	// since is when the circuit opened, or when the trial request was let through
+	since time.Time
+	// failing are the containers requests failed to reach since the last success
+	failing map[string]bool
+}
+
+// CircuitBreakerService tracks consecutive connection failures of functions, opening their circuit at the function's failure_threshold
+type CircuitBreakerService struct {
+	log      logging.Logger
+	mu       sync.Mutex
+	circuits map[string]*circuit
+	// onOpen is called when a circuit opens, with the containers that failed, so they can be recreated
+	onOpen func(functionId string, containerIds []string)
+}
+
+func NewCircuitBreakerService(log logging.Logger) *CircuitBreakerService {
+	return &CircuitBreakerService{
+		log:      log,
+		circuits: make(map[string]*circuit),
+	}
+}
+
+// OnOpen registers a callback run when a function's circuit opens
+func (cb *CircuitBreakerService) OnOpen(fn func(functionId string, containerIds []string)) {
+	cb.onOpen = fn
+}
+
+// Allow returns an UnavailableError while the function's circuit is open.
+// Once the open duration has passed, one trial request is let through at a time until one succeeds.
+func (cb *CircuitBreakerService) Allow(functionId string, config data.CircuitBreakerConfig, now time.Time) error {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	c, exists := cb.circuits[functionId]
+	if !exists || c.state == circuitClosed {
+		return nil
+	}
+
+	openDuration := circuitOpenDuration(config)
+	if wait := openDuration - now.Sub(c.since); wait > 0 {
+		return errors.NewUnavailableErrorRetryAfter(fmt.Sprintf("circuit breaker of function '%s' is open after %d consecutive failed requests", functionId, config.FailureThreshold), wait)
+	}
+	if c.state == circuitOpen {
+		cb.log.Infof("Letting a trial request through the circuit breaker of function '%s'", functionId)
+	}
+	c.state = circuitHalfOpen
+	c.since = now
+	return nil
+}
+
+// Success closes the function's circuit, as a request reached one of its instances
+func (cb *CircuitBreakerService) Success(functionId string) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	c, exists := cb.circuits[functionId]
+	if !exists {
+		return
+	}
+	if c.state != circuitClosed {
+		cb.log.Infof("Circuit breaker of function '%s' closed", functionId)
+	}
+	delete(cb.circuits, functionId)
+}
+
+// Failure counts a request that failed to reach the container, opening the circuit at the threshold, or when a trial request fails
+func (cb *CircuitBreakerService) Failure(functionId string, containerId string, config data.CircuitBreakerConfig, now time.Time) {
+	cb.mu.Lock()
+	c, exists := cb.circuits[functionId]
+	if !exists {
+		c = &circuit{failing: make(map[string]bool)}
+		cb.circuits[functionId] = c
+	}
+	// Requests sent before the circuit opened don't count again
+	if c.state == circuitOpen {
+		cb.mu.Unlock()
+		return
+	}
+	if containerId != "" {
+		c.failing[containerId] = true
+	}
+	c.failures++
+	if c.state == circuitClosed && c.failures < config.FailureThreshold {
+		cb.mu.Unlock()
+		return
+	}
+
+	c.state = circuitOpen
+	c.since = now
+	c.failures = 0
+	containerIds := make([]string, 0, len(c.failing))
+	for containerId := range c.failing {
+		containerIds = append(containerIds, containerId)
+	}
+	sort.Strings(containerIds)
+	c.failing = make(map[string]bool)
+	cb.mu.Unlock()
+
+	cb.log.Warn("Circuit breaker opened", "function", functionId, "containers", containerIds, "open_duration", circuitOpenDuration(config))
+	if cb.onOpen != nil && len(containerIds) > 0 {
+		cb.onOpen(functionId, containerIds)
+	}
+}
+
+func circuitOpenDuration(config data.CircuitBreakerConfig) time.Duration {
+	if config.OpenDuration > 0 {
+		return config.OpenDuration.Std()
+	}
+	return defaultCircuitOpenDuration
+}
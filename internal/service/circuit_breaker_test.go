@@ -0,0 +1,69 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jwtly10/jambda/api/data"
+	"github.com/jwtly10/jambda/internal/errors"
+	"github.com/jwtly10/jambda/internal/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestCircuitBreakerOpensAfterConsecutiveFailures(t *testing.T) {
+	cb := NewCircuitBreakerService(logging.NewLogger(false, zapcore.DebugLevel))
+	var recreated [][]string
+	cb.OnOpen(func(functionId string, containerIds []string) {
+		recreated = append(recreated, containerIds)
+	})
+	config := data.CircuitBreakerConfig{FailureThreshold: 3, OpenDuration: data.Duration(30 * time.Second)}
+	now := time.Now()
+
+	cb.Failure("fn", "a", config, now)
+	cb.Failure("fn", "b", config, now)
+	// A success resets the count
+	cb.Success("fn")
+	cb.Failure("fn", "a", config, now)
+	cb.Failure("fn", "b", config, now)
+	assert.NoError(t, cb.Allow("fn", config, now))
+	assert.Empty(t, recreated)
+
+	cb.Failure("fn", "b", config, now)
+	assert.Equal(t, [][]string{{"a", "b"}}, recreated)
+
+	err := cb.Allow("fn", config, now.Add(10*time.Second))
+	var unavailable *errors.UnavailableError
+	require.ErrorAs(t, err, &unavailable)
+	assert.Equal(t, 20*time.Second, unavailable.RetryAfter)
+	assert.NoError(t, cb.Allow("other", config, now))
+}
+
+func TestCircuitBreakerTrialRequest(t *testing.T) {
+	cb := NewCircuitBreakerService(logging.NewLogger(false, zapcore.DebugLevel))
+	var recreated [][]string
+	cb.OnOpen(func(functionId string, containerIds []string) {
+		recreated = append(recreated, containerIds)
+	})
+	config := data.CircuitBreakerConfig{FailureThreshold: 1, OpenDuration: data.Duration(30 * time.Second)}
+	now := time.Now()
+
+	cb.Failure("fn", "a", config, now)
+
+	// Only one trial request is let through once the circuit has been open for its duration
+	now = now.Add(30 * time.Second)
+	assert.NoError(t, cb.Allow("fn", config, now))
+	assert.Error(t, cb.Allow("fn", config, now))
+
+	// A failed trial opens the circuit again, recreating the new container
+	cb.Failure("fn", "c", config, now)
+	assert.Equal(t, [][]string{{"a"}, {"c"}}, recreated)
+	assert.Error(t, cb.Allow("fn", config, now.Add(time.Second)))
+
+	now = now.Add(30 * time.Second)
+	assert.NoError(t, cb.Allow("fn", config, now))
+	cb.Success("fn")
+	assert.NoError(t, cb.Allow("fn", config, now))
+	assert.NoError(t, cb.Allow("fn", config, now))
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/jwtly10/jambda/api/data"
 	"github.com/jwtly10/jambda/internal/logging"
@@ -43,5 +44,170 @@ func (cv *ConfigValidator) ValidateConfig(config *data.FunctionConfig) error {
 
 	// TODO: Validate env vars
 
+	// Validate scaling options
+	if config.MinInstances < 0 || config.MaxInstances < 0 || config.WarmInstances < 0 {
+		return fmt.Errorf("min_instances, max_instances and warm_instances must not be negative")
+	}
+	if config.MaxInstances > 0 && config.MinInstances > config.MaxInstances {
+		return fmt.Errorf("min_instances (%d) must not be greater than max_instances (%d)", config.MinInstances, config.MaxInstances)
+	}
+	if config.MaxInstances > 0 && config.WarmInstances > config.MaxInstances {
+		return fmt.Errorf("warm_instances (%d) must not be greater than max_instances (%d)", config.WarmInstances, config.MaxInstances)
+	}
+	if config.WarmInstances > 0 && config.Type != "REST" {
+		return fmt.Errorf("warm_instances is only supported for 'REST' functions")
+	}
+	if config.ConcurrencyTarget < 0 {
+		return fmt.Errorf("concurrency_target must not be negative; got %d", config.ConcurrencyTarget)
+	}
+	if config.MaxConcurrency < 0 {
+		return fmt.Errorf("max_concurrency must not be negative; got %d", config.MaxConcurrency)
+	}
+	if q := config.Queue; q != nil {
+		if config.MaxConcurrency == 0 {
+			return fmt.Errorf("queue requires max_concurrency to be set")
+		}
+		if q.MaxSize < 0 || q.MaxWait < 0 {
+			return fmt.Errorf("queue max_size and max_wait must not be negative")
+		}
+	}
+	if as := config.Autoscaling; as != nil {
+		if as.TargetRPS < 0 {
+			return fmt.Errorf("autoscaling target_rps must not be negative; got %v", as.TargetRPS)
+		}
+		if as.ScaleUpCooldown < 0 || as.ScaleDownCooldown < 0 || as.StabilizationWindow < 0 {
+			return fmt.Errorf("autoscaling cooldowns and stabilization_window must not be negative")
+		}
+	}
+
+	// Validate idle timeout
+	if config.IdleTimeout < 0 && config.IdleTimeout != data.Never {
+		return fmt.Errorf("invalid idle_timeout '%s'; must be a positive duration like '2m' or 'never'", config.IdleTimeout.Std())
+	}
+
+	// Validate health check
+	if hc := config.HealthCheck; hc != nil {
+		if hc.Path != "" && !strings.HasPrefix(hc.Path, "/") {
+			return fmt.Errorf("health_check path '%s' must start with '/'", hc.Path)
+		}
+		if hc.ExpectedStatus != 0 && (hc.ExpectedStatus < 100 || hc.ExpectedStatus > 599) {
+			return fmt.Errorf("health_check expected_status must be a valid http status; got %d", hc.ExpectedStatus)
+		}
+		if hc.InitialDelay < 0 || hc.Interval < 0 || hc.Timeout < 0 || hc.MaxStartupTime < 0 || hc.LivenessInterval < 0 {
+			return fmt.Errorf("health_check durations must not be negative")
+		}
+		if hc.FailureThreshold < 0 {
+			return fmt.Errorf("health_check failure_threshold must not be negative; got %d", hc.FailureThreshold)
+		}
+	}
+
+	// Validate isolation
+	switch config.Isolation {
+	case "", data.IsolationContainer:
+	case data.IsolationVM:
+		if !strings.Contains(config.Image, "golang") {
+			return fmt.Errorf("isolation 'vm' is only supported for 'golang' images")
+		}
+		if config.Port == nil {
+			return fmt.Errorf("isolation 'vm' requires a port")
+		}
+	default:
+		return fmt.Errorf("invalid isolation '%s'; must be 'container' or 'vm'", config.Isolation)
+	}
+
+	// Validate request limits
+	if config.Timeout < 0 {
+		return fmt.Errorf("timeout must not be negative")
+	}
+	if config.MaxRequestBody < 0 || config.MaxResponseBody < 0 {
+		return fmt.Errorf("max_request_body and max_response_body must not be negative")
+	}
+
+	// Validate cache
+	if config.Cache != nil {
+		if config.Cache.TTL <= 0 {
+			return fmt.Errorf("cache ttl must be positive")
+		}
+		for _, name := range config.Cache.Vary {
+			if strings.TrimSpace(name) == "" {
+				return fmt.Errorf("cache vary headers must not be empty")
+			}
+		}
+	}
+
+	// Validate retries and circuit breaker
+	if config.Retry != nil {
+		if config.Retry.Attempts < 1 {
+			return fmt.Errorf("retry attempts must be at least 1")
+		}
+		if config.Retry.Backoff < 0 || config.Retry.MaxBackoff < 0 {
+			return fmt.Errorf("retry backoff and max_backoff must not be negative")
+		}
+	}
+	if config.CircuitBreaker != nil {
+		if config.CircuitBreaker.FailureThreshold < 1 {
+			return fmt.Errorf("circuit_breaker failure_threshold must be at least 1")
+		}
+		if config.CircuitBreaker.OpenDuration < 0 {
+			return fmt.Errorf("circuit_breaker open_duration must not be negative")
+		}
+	}
+
+	// Validate transform
+	if config.Transform != nil {
+		for _, rules := range []data.HeaderRules{config.Transform.Request, config.Transform.Response} {
+			names := append([]string(nil), rules.Remove...)
+			for from, to := range rules.Rename {
+				names = append(names, from, to)
+			}
+			for name := range rules.Add {
+				names = append(names, name)
+			}
+			for _, name := range names {
+				if !validHeaderName(name) {
+					return fmt.Errorf("invalid header name '%s' in transform", name)
+				}
+			}
+		}
+		for _, rewrite := range config.Transform.PathRewrites {
+			if !strings.HasPrefix(rewrite.From, "/") || !strings.HasPrefix(rewrite.To, "/") {
+				return fmt.Errorf("transform path_rewrites must start with '/'")
+			}
+		}
+	}
+
+	// Validate rate limit
+	if rl := config.RateLimit; rl != nil {
+		if rl.RPS < 0 || rl.Burst < 0 || rl.DailyQuota < 0 {
+			return fmt.Errorf("rate_limit rps, burst and daily_quota must not be negative")
+		}
+		switch rl.Key {
+		case "", data.RateLimitKeyFunction, data.RateLimitKeyIP, data.RateLimitKeyAPIKey:
+		default:
+			return fmt.Errorf("invalid rate_limit key '%s'; must be 'function', 'ip' or 'api_key'", rl.Key)
+		}
+		if rl.Key == data.RateLimitKeyAPIKey && len(rl.APIKeys) == 0 {
+			return fmt.Errorf("rate_limit key 'api_key' needs the api_keys to limit")
+		}
+		for _, key := range rl.APIKeys {
+			if key == "" {
+				return fmt.Errorf("rate_limit api_keys must not be empty")
+			}
+		}
+	}
+
 	return nil
 }
+
+// validHeaderName checks the name is a http token, e.g "X-Api-Key"
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if c <= ' ' || c >= 0x7f || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, c) {
+			return false
+		}
+	}
+	return true
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"testing"
+	"time"
 
 	"github.com/jwtly10/jambda/api/data"
 	"github.com/jwtly10/jambda/internal/logging"
@@ -91,6 +92,317 @@ func TestValidateConfig(t *testing.T) {
 			wantErr: true,
 			errMsg:  "port must be between 1024 and 65535; got 70000",
 		},
+		{
+			name: "valid scaling options",
+			config: &data.FunctionConfig{
+				Type:              "REST",
+				Trigger:           "http",
+				Image:             "golang:1.22",
+				MinInstances:      1,
+				MaxInstances:      3,
+				ConcurrencyTarget: 5,
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid min instances greater than max",
+			config: &data.FunctionConfig{
+				Type:         "REST",
+				Trigger:      "http",
+				Image:        "golang:1.22",
+				MinInstances: 4,
+				MaxInstances: 2,
+			},
+			wantErr: true,
+			errMsg:  "min_instances (4) must not be greater than max_instances (2)",
+		},
+		{
+			name: "invalid negative concurrency target",
+			config: &data.FunctionConfig{
+				Type:              "REST",
+				Trigger:           "http",
+				Image:             "golang:1.22",
+				ConcurrencyTarget: -1,
+			},
+			wantErr: true,
+			errMsg:  "concurrency_target must not be negative; got -1",
+		},
+		{
+			name: "invalid negative autoscaling target rps",
+			config: &data.FunctionConfig{
+				Type:        "REST",
+				Trigger:     "http",
+				Image:       "golang:1.22",
+				Autoscaling: &data.AutoscalingConfig{TargetRPS: -5},
+			},
+			wantErr: true,
+			errMsg:  "autoscaling target_rps must not be negative; got -5",
+		},
+		{
+			name: "valid idle timeout never",
+			config: &data.FunctionConfig{
+				Type:        "REST",
+				Trigger:     "http",
+				Image:       "golang:1.22",
+				IdleTimeout: data.Never,
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid idle timeout",
+			config: &data.FunctionConfig{
+				Type:        "REST",
+				Trigger:     "http",
+				Image:       "golang:1.22",
+				IdleTimeout: data.Duration(-time.Minute),
+			},
+			wantErr: true,
+			errMsg:  "invalid idle_timeout '-1m0s'; must be a positive duration like '2m' or 'never'",
+		},
+		{
+			name: "invalid warm instances greater than max",
+			config: &data.FunctionConfig{
+				Type:          "REST",
+				Trigger:       "http",
+				Image:         "golang:1.22",
+				WarmInstances: 3,
+				MaxInstances:  2,
+			},
+			wantErr: true,
+			errMsg:  "warm_instances (3) must not be greater than max_instances (2)",
+		},
+		{
+			name: "valid tcp health check",
+			config: &data.FunctionConfig{
+				Type:        "REST",
+				Trigger:     "http",
+				Image:       "golang:1.22",
+				HealthCheck: &data.HealthCheckConfig{TCPOnly: true},
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid health check path",
+			config: &data.FunctionConfig{
+				Type:        "REST",
+				Trigger:     "http",
+				Image:       "golang:1.22",
+				HealthCheck: &data.HealthCheckConfig{Path: "ready"},
+			},
+			wantErr: true,
+			errMsg:  "health_check path 'ready' must start with '/'",
+		},
+		{
+			name: "invalid health check status",
+			config: &data.FunctionConfig{
+				Type:        "REST",
+				Trigger:     "http",
+				Image:       "golang:1.22",
+				HealthCheck: &data.HealthCheckConfig{ExpectedStatus: 42},
+			},
+			wantErr: true,
+			errMsg:  "health_check expected_status must be a valid http status; got 42",
+		},
+		{
+			name: "valid vm isolation",
+			config: &data.FunctionConfig{
+				Type:      "REST",
+				Trigger:   "http",
+				Image:     "golang:1.22",
+				Port:      new(int),
+				Isolation: data.IsolationVM,
+			},
+			wantErr: false,
+		},
+		{
+			name: "vm isolation with java",
+			config: &data.FunctionConfig{
+				Type:      "REST",
+				Trigger:   "http",
+				Image:     "openjdk:21-jdk",
+				Port:      new(int),
+				Isolation: data.IsolationVM,
+			},
+			wantErr: true,
+			errMsg:  "isolation 'vm' is only supported for 'golang' images",
+		},
+		{
+			name: "invalid isolation",
+			config: &data.FunctionConfig{
+				Type:      "REST",
+				Trigger:   "http",
+				Image:     "golang:1.22",
+				Isolation: "gvisor",
+			},
+			wantErr: true,
+			errMsg:  "invalid isolation 'gvisor'; must be 'container' or 'vm'",
+		},
+		{
+			name: "valid max concurrency with queue",
+			config: &data.FunctionConfig{
+				Type:           "REST",
+				Trigger:        "http",
+				Image:          "openjdk:17-jdk",
+				MaxConcurrency: 2,
+				Queue:          &data.QueueConfig{MaxSize: 20, MaxWait: data.Duration(10 * time.Second)},
+			},
+			wantErr: false,
+		},
+		{
+			name: "queue without max concurrency",
+			config: &data.FunctionConfig{
+				Type:    "REST",
+				Trigger: "http",
+				Image:   "golang:1.22",
+				Queue:   &data.QueueConfig{MaxSize: 20},
+			},
+			wantErr: true,
+			errMsg:  "queue requires max_concurrency to be set",
+		},
+		{
+			name: "valid cache",
+			config: &data.FunctionConfig{
+				Type:    "REST",
+				Trigger: "http",
+				Image:   "golang:1.22",
+				Cache:   &data.CacheConfig{TTL: data.Duration(time.Hour), Vary: []string{"Accept"}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "cache without ttl",
+			config: &data.FunctionConfig{
+				Type:    "REST",
+				Trigger: "http",
+				Image:   "golang:1.22",
+				Cache:   &data.CacheConfig{Vary: []string{"Accept"}},
+			},
+			wantErr: true,
+			errMsg:  "cache ttl must be positive",
+		},
+		{
+			name: "valid retry and circuit breaker",
+			config: &data.FunctionConfig{
+				Type:           "REST",
+				Trigger:        "http",
+				Image:          "golang:1.22",
+				Retry:          &data.RetryConfig{Attempts: 2, Backoff: data.Duration(50 * time.Millisecond)},
+				CircuitBreaker: &data.CircuitBreakerConfig{FailureThreshold: 5, OpenDuration: data.Duration(time.Minute)},
+			},
+			wantErr: false,
+		},
+		{
+			name: "circuit breaker without threshold",
+			config: &data.FunctionConfig{
+				Type:           "REST",
+				Trigger:        "http",
+				Image:          "golang:1.22",
+				CircuitBreaker: &data.CircuitBreakerConfig{},
+			},
+			wantErr: true,
+			errMsg:  "circuit_breaker failure_threshold must be at least 1",
+		},
+		{
+			name: "valid transform",
+			config: &data.FunctionConfig{
+				Type:    "REST",
+				Trigger: "http",
+				Image:   "golang:1.22",
+				Transform: &data.TransformConfig{
+					Request:      data.HeaderRules{Rename: map[string]string{"X-Api-Key": "X-Client-Key"}, Remove: []string{"Cookie"}},
+					Response:     data.HeaderRules{Add: map[string]string{"X-Served-By": "jambda"}},
+					PathRewrites: []data.PathRewrite{{From: "/v1", To: "/api/v1"}},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid transform header name",
+			config: &data.FunctionConfig{
+				Type:      "REST",
+				Trigger:   "http",
+				Image:     "golang:1.22",
+				Transform: &data.TransformConfig{Request: data.HeaderRules{Add: map[string]string{"X Bad": "1"}}},
+			},
+			wantErr: true,
+			errMsg:  "invalid header name 'X Bad' in transform",
+		},
+		{
+			name: "valid request limits",
+			config: &data.FunctionConfig{
+				Type:            "REST",
+				Trigger:         "http",
+				Image:           "golang:1.22",
+				Timeout:         data.Duration(5 * time.Second),
+				MaxRequestBody:  1 << 20,
+				MaxResponseBody: 10 << 20,
+			},
+			wantErr: false,
+		},
+		{
+			name: "negative max request body",
+			config: &data.FunctionConfig{
+				Type:           "REST",
+				Trigger:        "http",
+				Image:          "golang:1.22",
+				MaxRequestBody: -1,
+			},
+			wantErr: true,
+			errMsg:  "max_request_body and max_response_body must not be negative",
+		},
+		{
+			name: "valid rate limit",
+			config: &data.FunctionConfig{
+				Type:      "REST",
+				Trigger:   "http",
+				Image:     "golang:1.22",
+				RateLimit: &data.RateLimitConfig{RPS: 5, Burst: 10, Key: data.RateLimitKeyIP, DailyQuota: 1000},
+			},
+			wantErr: false,
+		},
+		{
+			name: "negative rate limit",
+			config: &data.FunctionConfig{
+				Type:      "REST",
+				Trigger:   "http",
+				Image:     "golang:1.22",
+				RateLimit: &data.RateLimitConfig{RPS: -1},
+			},
+			wantErr: true,
+			errMsg:  "rate_limit rps, burst and daily_quota must not be negative",
+		},
+		{
+			name: "invalid rate limit key",
+			config: &data.FunctionConfig{
+				Type:      "REST",
+				Trigger:   "http",
+				Image:     "golang:1.22",
+				RateLimit: &data.RateLimitConfig{RPS: 5, Key: "user"},
+			},
+			wantErr: true,
+			errMsg:  "invalid rate_limit key 'user'; must be 'function', 'ip' or 'api_key'",
+		},
+		{
+			name: "api key rate limit without keys",
+			config: &data.FunctionConfig{
+				Type:      "REST",
+				Trigger:   "http",
+				Image:     "golang:1.22",
+				RateLimit: &data.RateLimitConfig{RPS: 5, Key: "api_key"},
+			},
+			wantErr: true,
+			errMsg:  "rate_limit key 'api_key' needs the api_keys to limit",
+		},
+		{
+			name: "api key rate limit",
+			config: &data.FunctionConfig{
+				Type:      "REST",
+				Trigger:   "http",
+				Image:     "golang:1.22",
+				RateLimit: &data.RateLimitConfig{RPS: 5, Key: "api_key", APIKeys: []string{"team-a", "team-b"}},
+			},
+			wantErr: false,
+		},
 	}
 
 	for _, tt := range tests {
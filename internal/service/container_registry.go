@@ -0,0 +1,305 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jwtly10/jambda/internal/errors"
+	"github.com/jwtly10/jambda/internal/logging"
+)
+
+const (
+	ContainerStateCreated = "created"
+	// ContainerStateStarting is a container jambda has started, that docker hasn't yet reported as running
+	ContainerStateStarting = "starting"
+	ContainerStateRunning  = "running"
+	ContainerStateExited   = "exited"
+
+	// maxContainerCrashes is the number of crashes kept per function
+	maxContainerCrashes = 20
+)
+
+// ContainerRecord is the last known state of a function's container, as reported by docker
+type ContainerRecord struct {
+	ContainerId string `json:"container_id"`
+	FunctionId  string `json:"function_id"`
+	State       string `json:"state"`
+	// Ports maps each exposed container port, e.g '8080/tcp', to its host port
+	Ports      map[string]string `json:"ports,omitempty"`
+	StartedAt  time.Time         `json:"started_at"`
+	FinishedAt time.Time         `json:"finished_at"`
+	ExitCode   int               `json:"exit_code"`
+	OOMKilled  bool              `json:"oom_killed"`
+}
+
+// ContainerCrash is a container that exited without jambda asking it to, or was killed for running out of memory
+type ContainerCrash struct {
+	ContainerId string    `json:"container_id"`
+	FunctionId  string    `json:"function_id"`
+	Time        time.Time `json:"time"`
+	ExitCode    int       `json:"exit_code"`
+	OOMKilled   bool      `json:"oom_killed"`
+}
+
+// FunctionContainers is every container docker has for a function, with its most recent crashes first
+type FunctionContainers struct {
+	FunctionId string            `json:"function_id"`
+	Containers []ContainerRecord `json:"containers"`
+	Crashes    []ContainerCrash  `json:"crashes"`
+}
+
+// ContainerRegistry is an in memory view of every function container, kept in sync with docker by the ContainerWatcherService.
+// While the watcher is connected, the DockerService reads container state from here rather than querying docker.
+type ContainerRegistry struct {
+	log        logging.Logger
+	mu         sync.Mutex
+	containers map[string]*ContainerRecord
+	crashes    map[string][]ContainerCrash
+	// expectedStops are containers jambda is stopping itself, so their exit isn't recorded as a crash
+	expectedStops map[string]bool
+	// oomKilled are containers with an oom event, waiting on the die event that follows
+	oomKilled map[string]bool
+	// waiters are notified of every event for the container they are waiting on
+	waiters  map[string][]chan string
+	watching bool
+	// onContainerExit is called whenever a container stops running or is removed
+	onContainerExit func(functionId string, containerId string, at time.Time)
+}
+
+func NewContainerRegistry(log logging.Logger) *ContainerRegistry {
+	return &ContainerRegistry{
+		log:           log,
+		containers:    make(map[string]*ContainerRecord),
+		crashes:       make(map[string][]ContainerCrash),
+		expectedStops: make(map[string]bool),
+		oomKilled:     make(map[string]bool),
+		waiters:       make(map[string][]chan string),
+	}
+}
+
+// OnContainerExit registers a callback run whenever a function's container stops running or is removed
+func (cr *ContainerRegistry) OnContainerExit(fn func(functionId string, containerId string, at time.Time)) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	cr.onContainerExit = fn
+}
+
+// Watching reports whether the registry is currently in sync with docker
+func (cr *ContainerRegistry) Watching() bool {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	return cr.watching
+}
+
+// Sync replaces every record with a fresh listing from docker, and marks the registry as in sync
+func (cr *ContainerRegistry) Sync(records []ContainerRecord) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	cr.containers = make(map[string]*ContainerRecord, len(records))
+	for i := range records {
+		record := records[i]
+		cr.containers[record.ContainerId] = &record
+	}
+	cr.watching = true
+}
+
+// SetDisconnected marks the registry as out of sync, e.g when the events stream drops
+func (cr *ContainerRegistry) SetDisconnected() {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	cr.watching = false
+}
+
+// ExpectStop marks a container as being stopped by jambda, so its exit isn't recorded as a crash
+func (cr *ContainerRegistry) ExpectStop(containerId string) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	cr.expectedStops[containerId] = true
+}
+
+// ContainerStarting marks a stopped container as being started, until its start event arrives
+func (cr *ContainerRegistry) ContainerStarting(containerId string) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	if record, exists := cr.containers[containerId]; exists && record.State != ContainerStateRunning {
+		record.State = ContainerStateStarting
+	}
+}
+
+// ContainerStarted records a container as running
+func (cr *ContainerRegistry) ContainerStarted(record ContainerRecord) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	record.State = ContainerStateRunning
+	cr.containers[record.ContainerId] = &record
+	delete(cr.expectedStops, record.ContainerId)
+	delete(cr.oomKilled, record.ContainerId)
+	cr.notify(record.ContainerId, ContainerStateRunning)
+}
+
+// ContainerOOMKilled records that a container ran out of memory, the die event that follows records the crash
+func (cr *ContainerRegistry) ContainerOOMKilled(containerId string) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	cr.oomKilled[containerId] = true
+	if record, exists := cr.containers[containerId]; exists {
+		record.OOMKilled = true
+	}
+}
+
+// ContainerDied records a container as exited, and records a crash if jambda didn't stop it
+func (cr *ContainerRegistry) ContainerDied(functionId string, containerId string, exitCode int, at time.Time) {
+	cr.mu.Lock()
+	record, exists := cr.containers[containerId]
+	if !exists {
+		record = &ContainerRecord{ContainerId: containerId, FunctionId: functionId}
+		cr.containers[containerId] = record
+	}
+	record.State = ContainerStateExited
+	record.FinishedAt = at
+	record.ExitCode = exitCode
+
+	oomKilled := cr.oomKilled[containerId]
+	record.OOMKilled = oomKilled
+	delete(cr.oomKilled, containerId)
+
+	if !cr.expectedStops[containerId] || oomKilled {
+		cr.log.Errorf("Container '%s' for function '%s' crashed with exit code %d, oom killed: %v", containerId, functionId, exitCode, oomKilled)
+		crashes := append(cr.crashes[functionId], ContainerCrash{
+			ContainerId: containerId,
+			FunctionId:  functionId,
+			Time:        at,
+			ExitCode:    exitCode,
+			OOMKilled:   oomKilled,
+		})
+		if len(crashes) > maxContainerCrashes {
+			crashes = crashes[len(crashes)-maxContainerCrashes:]
+		}
+		cr.crashes[functionId] = crashes
+	}
+	delete(cr.expectedStops, containerId)
+
+	cr.notify(containerId, ContainerStateExited)
+	hook := cr.onContainerExit
+	cr.mu.Unlock()
+
+	if hook != nil {
+		hook(functionId, containerId, at)
+	}
+}
+
+// ContainerDestroyed removes a container from the registry
+func (cr *ContainerRegistry) ContainerDestroyed(functionId string, containerId string, at time.Time) {
+	cr.mu.Lock()
+	delete(cr.containers, containerId)
+	delete(cr.expectedStops, containerId)
+	delete(cr.oomKilled, containerId)
+	cr.notify(containerId, "destroyed")
+	hook := cr.onContainerExit
+	cr.mu.Unlock()
+
+	if hook != nil {
+		hook(functionId, containerId, at)
+	}
+}
+
+// GetContainer returns the last known state of a container
+func (cr *ContainerRegistry) GetContainer(containerId string) (ContainerRecord, bool) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	record, exists := cr.containers[containerId]
+	if !exists {
+		return ContainerRecord{}, false
+	}
+	return *record, true
+}
+
+// GetContainers returns every known container of a function, oldest first
+func (cr *ContainerRegistry) GetContainers(functionId string) []ContainerRecord {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	records := []ContainerRecord{}
+	for _, record := range cr.containers {
+		if record.FunctionId == functionId {
+			records = append(records, *record)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].StartedAt.Before(records[j].StartedAt)
+	})
+	return records
+}
+
+// GetFunctionContainers returns the containers and most recent crashes of a function
+func (cr *ContainerRegistry) GetFunctionContainers(functionId string) FunctionContainers {
+	containers := cr.GetContainers(functionId)
+
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	crashes := []ContainerCrash{}
+	for i := len(cr.crashes[functionId]) - 1; i >= 0; i-- {
+		crashes = append(crashes, cr.crashes[functionId][i])
+	}
+	return FunctionContainers{
+		FunctionId: functionId,
+		Containers: containers,
+		Crashes:    crashes,
+	}
+}
+
+// WaitForRunning blocks until the registry sees the container running.
+// It returns an error if the container exits or is removed first, or the context is done.
+func (cr *ContainerRegistry) WaitForRunning(ctx context.Context, containerId string) error {
+	// Check and subscribe under the same lock, so a start between the two can't be missed
+	cr.mu.Lock()
+	if record, exists := cr.containers[containerId]; exists && record.State == ContainerStateRunning {
+		cr.mu.Unlock()
+		return nil
+	}
+	ch := make(chan string, 4)
+	cr.waiters[containerId] = append(cr.waiters[containerId], ch)
+	cr.mu.Unlock()
+	defer cr.removeWaiter(containerId, ch)
+
+	for {
+		select {
+		case state := <-ch:
+			if state == ContainerStateRunning {
+				return nil
+			}
+			return errors.NewDockerError(fmt.Sprintf("container '%s' stopped before it was ready: %s", containerId, state))
+		case <-ctx.Done():
+			return errors.NewDockerError(fmt.Sprintf("container '%s' was not running in time: %v", containerId, ctx.Err()))
+		}
+	}
+}
+
+// notify must be called with the lock held, it never blocks
+func (cr *ContainerRegistry) notify(containerId string, state string) {
+	for _, ch := range cr.waiters[containerId] {
+		select {
+		case ch <- state:
+		default:
+		}
+	}
+}
+
+func (cr *ContainerRegistry) removeWaiter(containerId string, ch chan string) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	waiters := cr.waiters[containerId]
+	for i, waiter := range waiters {
+		if waiter == ch {
+			waiters = append(waiters[:i], waiters[i+1:]...)
+			break
+		}
+	}
+	if len(waiters) == 0 {
+		delete(cr.waiters, containerId)
+	} else {
+		cr.waiters[containerId] = waiters
+	}
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jwtly10/jambda/internal/logging"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestContainerDiedRecordsCrashes(t *testing.T) {
+	tests := []struct {
+		name          string
+		expectStop    bool
+		oomKilled     bool
+		expectedCrash bool
+	}{
+		{
+			name:          "unexpected exit is a crash",
+			expectedCrash: true,
+		},
+		{
+			name:       "stop requested by jambda is not a crash",
+			expectStop: true,
+		},
+		{
+			name:          "oom kill is always a crash",
+			expectStop:    true,
+			oomKilled:     true,
+			expectedCrash: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := NewContainerRegistry(logging.NewLogger(false, zapcore.DebugLevel))
+			registry.ContainerStarted(ContainerRecord{ContainerId: "c1", FunctionId: "fn"})
+
+			var exited []string
+			registry.OnContainerExit(func(functionId string, containerId string, at time.Time) {
+				exited = append(exited, containerId)
+			})
+
+			if tt.expectStop {
+				registry.ExpectStop("c1")
+			}
+			if tt.oomKilled {
+				registry.ContainerOOMKilled("c1")
+			}
+			registry.ContainerDied("fn", "c1", 137, time.Now())
+
+			record, found := registry.GetContainer("c1")
+			assert.True(t, found)
+			assert.Equal(t, ContainerStateExited, record.State)
+			assert.Equal(t, tt.oomKilled, record.OOMKilled)
+			assert.Equal(t, []string{"c1"}, exited)
+
+			crashes := registry.GetFunctionContainers("fn").Crashes
+			if tt.expectedCrash {
+				assert.Len(t, crashes, 1)
+				assert.Equal(t, 137, crashes[0].ExitCode)
+				assert.Equal(t, tt.oomKilled, crashes[0].OOMKilled)
+			} else {
+				assert.Empty(t, crashes)
+			}
+		})
+	}
+}
+
+func TestWaitForRunning(t *testing.T) {
+	registry := NewContainerRegistry(logging.NewLogger(false, zapcore.DebugLevel))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// Already running containers return straight away
+	registry.ContainerStarted(ContainerRecord{ContainerId: "running", FunctionId: "fn"})
+	assert.NoError(t, registry.WaitForRunning(ctx, "running"))
+
+	// Containers starting later are picked up from their start event
+	started := make(chan error)
+	go func() {
+		started <- registry.WaitForRunning(ctx, "starting")
+	}()
+	time.Sleep(10 * time.Millisecond)
+	registry.ContainerStarted(ContainerRecord{ContainerId: "starting", FunctionId: "fn"})
+	assert.NoError(t, <-started)
+
+	// Containers dying before they are running fail the wait
+	died := make(chan error)
+	go func() {
+		died <- registry.WaitForRunning(ctx, "dying")
+	}()
+	time.Sleep(10 * time.Millisecond)
+	registry.ContainerDied("fn", "dying", 1, time.Now())
+	assert.Error(t, <-died)
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+)
+
+const (
+	RuntimeDocker = "docker"
+	// RuntimePodman talks to a rootless podman socket through its docker compatible API
+	RuntimePodman = "podman"
+)
+
+// ContainerRuntime holds what differs between running function containers on docker and on rootless podman
+type ContainerRuntime struct {
+	// Name is either 'docker' or 'podman'
+	Name string
+	// Host is the address published container ports are reached on, defaults to localhost for docker and 127.0.0.1 for podman
+	Host string
+}
+
+func NewContainerRuntime(name string, host string) (ContainerRuntime, error) {
+	if name == "" {
+		name = RuntimeDocker
+	}
+	if name != RuntimeDocker && name != RuntimePodman {
+		return ContainerRuntime{}, fmt.Errorf("unknown container runtime '%s', must be 'docker' or 'podman'", name)
+	}
+	return ContainerRuntime{Name: name, Host: host}, nil
+}
+
+func (cr ContainerRuntime) rootless() bool {
+	return cr.Name == RuntimePodman
+}
+
+// clientOpts points the client at the rootless podman socket, unless DOCKER_HOST says otherwise
+func (cr ContainerRuntime) clientOpts() []client.Opt {
+	opts := []client.Opt{client.FromEnv, client.WithAPIVersionNegotiation()}
+	if cr.rootless() && os.Getenv("DOCKER_HOST") == "" {
+		opts = append(opts, client.WithHost("unix://"+podmanSocket()))
+	}
+	return opts
+}
+
+// endpointHost is the host function urls are built with.
+// Rootless port forwarding only listens on IPv4, so podman avoids localhost which may resolve to ::1.
+func (cr ContainerRuntime) endpointHost() string {
+	if cr.Host != "" {
+		return cr.Host
+	}
+	if cr.rootless() {
+		return "127.0.0.1"
+	}
+	return "localhost"
+}
+
+// publishHostIP is the host address container ports are published on.
+// Rootless ports are only published on loopback when that's where they're reached, as they aren't firewalled like docker's.
+func (cr ContainerRuntime) publishHostIP() string {
+	if !cr.rootless() {
+		return "0.0.0.0"
+	}
+	host := cr.endpointHost()
+	if ip := net.ParseIP(host); host == "localhost" || (ip != nil && ip.IsLoopback()) {
+		return "127.0.0.1"
+	}
+	return "0.0.0.0"
+}
+
+// bindMount returns the bind of a function's binary into its container.
+// Under podman the file is relabelled for SELinux, as rootless containers can't read host files labelled otherwise.
+func (cr ContainerRuntime) bindMount(hostPath string, containerPath string) string {
+	if cr.rootless() {
+		return fmt.Sprintf("%s:%s:ro,z", hostPath, containerPath)
+	}
+	return fmt.Sprintf("%s:%s:ro", hostPath, containerPath)
+}
+
+// usernsMode keeps the host user's id inside rootless containers, so the function can still run
+// binaries owned by the user who uploaded them rather than them being mapped to an unknown subuid
+func (cr ContainerRuntime) usernsMode() container.UsernsMode {
+	if cr.rootless() {
+		return "keep-id"
+	}
+	return ""
+}
+
+// podmanSocket is the default rootless podman socket of the current user
+func podmanSocket() string {
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if runtimeDir == "" {
+		runtimeDir = fmt.Sprintf("/run/user/%d", os.Getuid())
+	}
+	return filepath.Join(runtimeDir, "podman", "podman.sock")
+}
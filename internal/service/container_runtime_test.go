@@ -0,0 +1,67 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContainerRuntime(t *testing.T) {
+	tests := []struct {
+		name         string
+		runtime      string
+		host         string
+		endpointHost string
+		publishIP    string
+		bind         string
+		usernsMode   container.UsernsMode
+	}{
+		{
+			name:         "docker",
+			runtime:      "",
+			endpointHost: "localhost",
+			publishIP:    "0.0.0.0",
+			bind:         "/binaries/fn/bootstrap:/bootstrap:ro",
+		},
+		{
+			name:         "docker with custom host",
+			runtime:      RuntimeDocker,
+			host:         "docker.internal",
+			endpointHost: "docker.internal",
+			publishIP:    "0.0.0.0",
+			bind:         "/binaries/fn/bootstrap:/bootstrap:ro",
+		},
+		{
+			name:         "podman",
+			runtime:      RuntimePodman,
+			endpointHost: "127.0.0.1",
+			publishIP:    "127.0.0.1",
+			bind:         "/binaries/fn/bootstrap:/bootstrap:ro,z",
+			usernsMode:   "keep-id",
+		},
+		{
+			name:         "podman reached from another host",
+			runtime:      RuntimePodman,
+			host:         "10.0.0.5",
+			endpointHost: "10.0.0.5",
+			publishIP:    "0.0.0.0",
+			bind:         "/binaries/fn/bootstrap:/bootstrap:ro,z",
+			usernsMode:   "keep-id",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cr, err := NewContainerRuntime(tt.runtime, tt.host)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.endpointHost, cr.endpointHost())
+			assert.Equal(t, tt.publishIP, cr.publishHostIP())
+			assert.Equal(t, tt.bind, cr.bindMount("/binaries/fn/bootstrap", "/bootstrap"))
+			assert.Equal(t, tt.usernsMode, cr.usernsMode())
+		})
+	}
+
+	_, err := NewContainerRuntime("containerd", "")
+	assert.Error(t, err)
+}
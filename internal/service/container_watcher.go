@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/jwtly10/jambda/internal/logging"
+)
+
+const (
+	initialWatchBackoff = time.Second
+	maxWatchBackoff     = 30 * time.Second
+)
+
+// ContainerWatcherService keeps the ContainerRegistry in sync with docker, by following the events of every function container.
+// Crashes are recorded as they happen, rather than being discovered by the next request.
+type ContainerWatcherService struct {
+	log      logging.Logger
+	ds       DockerService
+	registry *ContainerRegistry
+}
+
+func NewContainerWatcherService(log logging.Logger, ds DockerService, registry *ContainerRegistry) *ContainerWatcherService {
+	return &ContainerWatcherService{
+		log:      log,
+		ds:       ds,
+		registry: registry,
+	}
+}
+
+// Run follows the docker events stream, reconnecting with a backoff whenever it drops. It never returns.
+func (cw *ContainerWatcherService) Run() {
+	delay := initialWatchBackoff
+	for {
+		started := time.Now()
+		err := cw.watch()
+		cw.registry.SetDisconnected()
+
+		// Only back off when the stream keeps failing straight away
+		if time.Since(started) > maxWatchBackoff {
+			delay = initialWatchBackoff
+		}
+		cw.log.Errorf("Lost docker events stream, reconnecting in %s: %v", delay, err)
+		time.Sleep(delay)
+		delay = nextBackoff(delay, maxWatchBackoff)
+	}
+}
+
+// watch subscribes to the events stream and syncs the registry, then applies events until the stream fails
+func (cw *ContainerWatcherService) watch() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Subscribe before listing, so no event between the two can be missed
+	messages, errs := cw.ds.FunctionEvents(ctx)
+
+	records, err := cw.ds.ListInstances(ctx)
+	if err != nil {
+		return err
+	}
+	cw.registry.Sync(records)
+	cw.log.Infof("Watching docker events, tracking %d function containers", len(records))
+
+	for {
+		select {
+		case msg := <-messages:
+			cw.handleEvent(ctx, msg)
+		case err := <-errs:
+			return fmt.Errorf("error reading docker events: %v", err)
+		}
+	}
+}
+
+func (cw *ContainerWatcherService) handleEvent(ctx context.Context, msg events.Message) {
+	containerId := msg.Actor.ID
+	functionId := msg.Actor.Attributes["function_id"]
+	at := time.Unix(0, msg.TimeNano)
+
+	switch msg.Action {
+	case events.ActionStart, events.ActionRestart:
+		record, err := cw.ds.InspectContainer(ctx, containerId)
+		if err != nil {
+			cw.log.Errorf("Failed to inspect started container '%s': %v", containerId, err)
+			return
+		}
+		cw.registry.ContainerStarted(record)
+	case events.ActionOOM:
+		cw.log.Errorf("Container '%s' for function '%s' ran out of memory", containerId, functionId)
+		cw.registry.ContainerOOMKilled(containerId)
+	case events.ActionDie:
+		// A stop is always preceded by a die, so this records every exit
+		exitCode, _ := strconv.Atoi(msg.Actor.Attributes["exitCode"])
+		cw.registry.ContainerDied(functionId, containerId, exitCode, at)
+	case events.ActionDestroy:
+		cw.registry.ContainerDestroyed(functionId, containerId, at)
+	}
+}
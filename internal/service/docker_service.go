@@ -1,43 +1,55 @@
 package service
 
 import (
+	"bytes"
 	"context"
 	"fmt"
-	"net/http"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
 	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/docker/go-connections/nat"
 	"github.com/jwtly10/jambda/api/data"
 	"github.com/jwtly10/jambda/internal/errors"
 	"github.com/jwtly10/jambda/internal/logging"
 	"github.com/jwtly10/jambda/internal/repository"
+	"github.com/jwtly10/jambda/internal/tracing"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type DockerService struct {
-	log logging.Logger
-	fr  repository.FunctionRepository
-	cli *client.Client
+	log      logging.Logger
+	fr       repository.FunctionRepository
+	cli      *client.Client
+	registry *ContainerRegistry
+	runtime  ContainerRuntime
 }
 
-func NewDockerService(log logging.Logger, fr repository.FunctionRepository) *DockerService {
-	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+func NewDockerService(log logging.Logger, fr repository.FunctionRepository, registry *ContainerRegistry, runtime ContainerRuntime) *DockerService {
+	cli, err := client.NewClientWithOpts(runtime.clientOpts()...)
 	if err != nil {
 		log.Fatalf("failed to create docker client", err)
 	}
 
 	return &DockerService{
-		log: log,
-		cli: cli,
-		fr:  fr,
+		log:      log,
+		cli:      cli,
+		fr:       fr,
+		registry: registry,
+		runtime:  runtime,
 	}
 }
 
-func (ds *DockerService) GetFunctionConfiguration(externalId string) (*data.FunctionConfig, error) {
+func (ds *DockerService) GetFunctionConfiguration(ctx context.Context, externalId string) (*data.FunctionConfig, error) {
+	_, span := tracing.Tracer().Start(ctx, "function.config_lookup", trace.WithAttributes(tracing.FunctionIdKey.String(externalId)))
 	config, err := ds.fr.GetConfigurationFromExternalId(externalId)
+	tracing.End(span, err)
 	if err != nil {
 		ds.log.Error("Failed to retrieve config from function '%s': ", externalId, err)
 		return nil, errors.NewInternalError(fmt.Sprintf("error retrieving function config from db: %v", err))
@@ -46,59 +58,59 @@ func (ds *DockerService) GetFunctionConfiguration(externalId string) (*data.Func
 	return config, nil
 }
 
-func (ds *DockerService) StartContainer(ctx context.Context, r *http.Request, functionId string, config data.FunctionConfig) (string, error) {
-	// get list of all containers
-	containers, err := ds.cli.ContainerList(ctx, container.ListOptions{All: true})
+// StartInstance starts a new container instance for the function.
+// A stopped container previously created for the function is reused when available, otherwise a new one is created.
+func (ds *DockerService) StartInstance(ctx context.Context, functionId string, config data.FunctionConfig) (string, error) {
+	containers, err := ds.listContainers(ctx, functionId)
 	if err != nil {
-		ds.log.Error("Failed to list Docker containers: ", err)
-		return "", errors.NewDockerError(fmt.Sprintf("error retrieving containers from docker: %v", err))
+		return "", err
 	}
 
-	// get the containerId for either the running container, or the created container
+	// get the containerId for either a stopped container, or the created container
 	var containerId string
 	containerFound := false
 	for _, inContainer := range containers {
-		if inContainer.Labels["function_id"] == functionId {
-			containerId = inContainer.ID
-			containerFound = true
-			if inContainer.State == "running" {
-				ds.log.Infof("Container for function '%s' is already running", functionId)
-			} else {
-				ds.log.Infof("Container for function '%s' exists but is not running. Starting it now.", functionId)
-				// Start the container
-				if err := ds.cli.ContainerStart(ctx, containerId, container.StartOptions{}); err != nil {
-					ds.log.Error("Failed to start container '%s': ", containerId, err)
-					return "", errors.NewDockerError(fmt.Sprintf("error starting docker container: %v", err))
-				}
-			}
-			break
+		// Running containers are already tracked by the instance pool
+		if inContainer.State == ContainerStateRunning || inContainer.State == ContainerStateStarting {
+			continue
 		}
+		containerId = inContainer.ContainerId
+		containerFound = true
+		ds.log.Infof("Container '%s' for function '%s' exists but is not running. Starting it now.", containerId, functionId)
+		if err := ds.cli.ContainerStart(ctx, containerId, container.StartOptions{}); err != nil {
+			ds.log.Errorf("Failed to start container '%s': %v", containerId, err)
+			return "", errors.NewDockerError(fmt.Sprintf("error starting docker container: %v", err))
+		}
+		if ds.registry != nil {
+			// The start event may not have arrived yet, so make sure the next start doesn't claim this container too
+			ds.registry.ContainerStarting(containerId)
+		}
+		break
 	}
 
 	if !containerFound {
-		ds.log.Infof("No container found for id '%s'. Creating one now.", functionId)
-		// TODO dont hard code path
+		ds.log.Infof("No stopped container found for id '%s'. Creating one now.", functionId)
+		binariesDir, err := filepath.Abs(BinariesDir)
+		if err != nil {
+			return "", errors.NewInternalError(fmt.Sprintf("error resolving binaries directory: %v", err))
+		}
+
 		var runCmd []string
-		var mountCmd string
-		var binaryPath string
+		var bind string
 		if strings.Contains(config.Image, "golang") {
 			// This is a golang binary
-			// runCmd = "/bootstrap"
 			runCmd = []string{"/bootstrap"}
-			mountCmd = ":/bootstrap:ro"
-			binaryPath = fmt.Sprintf("%s/binaries/%s/bootstrap", "/Users/personal/Projects/jambda", functionId)
+			bind = ds.runtime.bindMount(filepath.Join(binariesDir, functionId, "bootstrap"), "/bootstrap")
 		}
 
 		if strings.Contains(config.Image, "jdk") {
 			// This is a java binary
 			runCmd = []string{"/bin/sh", "-c", "java -jar /bootstrap.jar"}
-			mountCmd = ":/bootstrap.jar:ro"
-			binaryPath = fmt.Sprintf("%s/binaries/%s/bootstrap.jar", "/Users/personal/Projects/jambda", functionId)
+			bind = ds.runtime.bindMount(filepath.Join(binariesDir, functionId, "bootstrap.jar"), "/bootstrap.jar")
 		}
 
 		ds.log.Infof("Running command on container : '%s'", runCmd)
-		ds.log.Infof("Mounting command on container : '%s'", mountCmd)
-		ds.log.Infof("Binary Path is : '%s'", binaryPath)
+		ds.log.Infof("Mounting binary on container : '%s'", bind)
 
 		// Create and start the container
 		cInstance, err := ds.cli.ContainerCreate(ctx, &container.Config{
@@ -113,12 +125,13 @@ func (ds *DockerService) StartContainer(ctx context.Context, r *http.Request, fu
 			},
 		}, &container.HostConfig{
 			Binds: []string{
-				binaryPath + mountCmd,
+				bind,
 			},
+			UsernsMode: ds.runtime.usernsMode(),
 			PortBindings: nat.PortMap{
 				nat.Port(fmt.Sprintf("%d/tcp", *config.Port)): []nat.PortBinding{
 					{
-						HostIP:   "0.0.0.0",
+						HostIP:   ds.runtime.publishHostIP(),
 						HostPort: "",
 					},
 				},
@@ -142,54 +155,141 @@ func (ds *DockerService) StartContainer(ctx context.Context, r *http.Request, fu
 	return containerId, nil
 }
 
-func (ds *DockerService) HealthCheckContainer(ctx context.Context, containerId string, config data.FunctionConfig) error {
-	timeout := time.Now().Add(30 * time.Second) // Wait up to 30 seconds
-
-	url, err := ds.GetContainerUrl(ctx, containerId, config)
+// HealthCheck waits for a started container to pass its health check,
+// retrying until the function's max startup time has passed or the context is done
+func (ds *DockerService) HealthCheck(ctx context.Context, containerId string, config data.FunctionConfig) error {
+	url, err := ds.GetEndpoint(ctx, containerId, config)
 	if err != nil {
 		return errors.NewDockerError(fmt.Sprintf("error inspecting container: %v", err))
 	}
 
-	for time.Now().Before(timeout) {
-		resp, err := http.Get(fmt.Sprintf("%s/health", url))
-		if err == nil && resp.StatusCode == http.StatusOK {
-			return nil // Container is ready
-		}
+	return waitUntilHealthy(ctx, ds.log, containerId, url, config)
+}
 
-		// Wait a bit before checking again
-		ds.log.Warn("Health check failed. Retrying.")
-		time.Sleep(2 * time.Second)
+// WaitForRunning blocks until the container is running, driven by the docker events stream rather than polling.
+// It returns an error if the container dies first, or the context is done.
+func (ds *DockerService) WaitForRunning(ctx context.Context, containerId string) error {
+	if ds.watching() {
+		return ds.registry.WaitForRunning(ctx, containerId)
 	}
 
-	return errors.NewDockerError(fmt.Sprintf("container did not become ready within the expected time"))
-}
+	// Without the registry, watch the events of this container directly
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Subscribe before inspecting, so a start between the two can't be missed
+	filterArgs := filters.NewArgs()
+	filterArgs.Add("type", string(events.ContainerEventType))
+	filterArgs.Add("container", containerId)
+	messages, errs := ds.cli.Events(ctx, events.ListOptions{Filters: filterArgs})
 
-func (ds *DockerService) GetContainerUrl(ctx context.Context, containerId string, config data.FunctionConfig) (string, error) {
 	inspectData, err := ds.cli.ContainerInspect(ctx, containerId)
 	if err != nil {
-		ds.log.Error("Error inspecting container: ", err)
-		return "", err
+		return errors.NewDockerError(fmt.Sprintf("error inspecting container: %v", err))
+	}
+	if inspectData.State != nil {
+		if inspectData.State.Running {
+			return nil
+		}
+		if inspectData.State.Status == "exited" || inspectData.State.Status == "dead" {
+			return errors.NewDockerError(fmt.Sprintf("container '%s' exited with code %d", containerId, inspectData.State.ExitCode))
+		}
+	}
+
+	for {
+		select {
+		case msg := <-messages:
+			switch msg.Action {
+			case events.ActionStart, events.ActionRestart:
+				return nil
+			case events.ActionDie, events.ActionOOM, events.ActionDestroy:
+				return errors.NewDockerError(fmt.Sprintf("container '%s' stopped before it was ready: %s", containerId, msg.Action))
+			}
+		case err := <-errs:
+			return errors.NewDockerError(fmt.Sprintf("error watching docker events: %v", err))
+		case <-ctx.Done():
+			return errors.NewDockerError(fmt.Sprintf("container '%s' was not running in time: %v", containerId, ctx.Err()))
+		}
+	}
+}
+
+// Restart restarts a single container instance
+func (ds *DockerService) Restart(ctx context.Context, containerId string) error {
+	ds.expectStop(containerId)
+	if err := ds.cli.ContainerRestart(ctx, containerId, container.StopOptions{}); err != nil {
+		ds.log.Errorf("Failed to restart container %s: %s", containerId, err)
+		return errors.NewDockerError(fmt.Sprintf("error restarting docker container: %v", err))
 	}
+	ds.log.Infof("Restarted container %s", containerId)
+	return nil
+}
 
-	portKey := nat.Port(fmt.Sprintf("%d/tcp", *config.Port))
+// GetEndpoint returns the url the container is published on
+func (ds *DockerService) GetEndpoint(ctx context.Context, containerId string, config data.FunctionConfig) (string, error) {
+	portKey := fmt.Sprintf("%d/tcp", *config.Port)
+
+	// Read the host port from the registry when it's in sync, falling back to inspecting the container
+	record, found := ContainerRecord{}, false
+	if ds.watching() {
+		record, found = ds.registry.GetContainer(containerId)
+	}
+	if !found || record.State != ContainerStateRunning {
+		var err error
+		record, err = ds.InspectContainer(ctx, containerId)
+		if err != nil {
+			ds.log.Error("Error inspecting container: ", err)
+			return "", err
+		}
+	}
 
 	// Force safe access to port bindings
-	portBindings, ok := inspectData.NetworkSettings.Ports[portKey]
-	if !ok || len(portBindings) == 0 {
+	assignedPort, ok := record.Ports[portKey]
+	if !ok {
 		ds.log.Errorf("No port bindings are available for port %s", portKey)
 		return "", fmt.Errorf("no port bindings are available for port %s", portKey)
 	}
 
-	assignedPort := portBindings[0].HostPort
 	if assignedPort == "" {
 		ds.log.Error("Assigned host port is empty")
 		return "", fmt.Errorf("assigned host port is empty for port '%s'", portKey)
 	}
 
-	return fmt.Sprintf("http://%s:%s", "localhost", assignedPort), nil
+	return fmt.Sprintf("http://%s:%s", ds.runtime.endpointHost(), assignedPort), nil
+}
+
+// ListRunning returns the ids of all running containers for the function
+func (ds *DockerService) ListRunning(ctx context.Context, functionId string) ([]string, error) {
+	containers, err := ds.listContainers(ctx, functionId)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(containers))
+	for _, inContainer := range containers {
+		if inContainer.State == ContainerStateRunning {
+			ids = append(ids, inContainer.ContainerId)
+		}
+	}
+	return ids, nil
+}
+
+// Stop stops a single container instance
+func (ds *DockerService) Stop(containerId string) error {
+	// Max wait for container stop is 10 seconds
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	ds.expectStop(containerId)
+	if err := ds.cli.ContainerStop(ctx, containerId, container.StopOptions{}); err != nil {
+		ds.log.Errorf("Failed to stop container %s: %s", containerId, err)
+		return errors.NewDockerError(fmt.Sprintf("error stopping docker container: %v", err))
+	}
+	ds.log.Infof("Stopped container %s", containerId)
+	return nil
 }
 
-func (ds *DockerService) StopContainerForFunction(functionID string) {
+// StopFunction stops every container of the function
+func (ds *DockerService) StopFunction(functionID string) {
 	ds.log.Infof("Stopping idle container for function '%s' ", functionID)
 
 	// Max wait for container stop is 10 seconds
@@ -213,6 +313,7 @@ func (ds *DockerService) StopContainerForFunction(functionID string) {
 		opts := container.StopOptions{
 			Timeout: nil,
 		}
+		ds.expectStop(inContainer.ID)
 		if err := ds.cli.ContainerStop(ctx, inContainer.ID, opts); err != nil {
 			ds.log.Errorf("Failed to stop container %s: %s", inContainer.ID, err)
 		} else {
@@ -220,3 +321,142 @@ func (ds *DockerService) StopContainerForFunction(functionID string) {
 		}
 	}
 }
+
+// Remove removes a container, killing it first if it's still running
+func (ds *DockerService) Remove(ctx context.Context, containerId string) error {
+	ds.expectStop(containerId)
+	if err := ds.cli.ContainerRemove(ctx, containerId, container.RemoveOptions{Force: true}); err != nil {
+		ds.log.Errorf("Failed to remove container %s: %s", containerId, err)
+		return errors.NewDockerError(fmt.Sprintf("error removing docker container: %v", err))
+	}
+	ds.log.Infof("Removed container %s", containerId)
+	return nil
+}
+
+// InspectContainer returns the current state of a single container straight from docker
+func (ds *DockerService) InspectContainer(ctx context.Context, containerId string) (ContainerRecord, error) {
+	inspectData, err := ds.cli.ContainerInspect(ctx, containerId)
+	if err != nil {
+		return ContainerRecord{}, errors.NewDockerError(fmt.Sprintf("error inspecting container: %v", err))
+	}
+
+	record := ContainerRecord{
+		ContainerId: inspectData.ID,
+		Ports:       make(map[string]string),
+	}
+	if inspectData.Config != nil {
+		record.FunctionId = inspectData.Config.Labels["function_id"]
+	}
+	if state := inspectData.State; state != nil {
+		record.State = state.Status
+		record.ExitCode = state.ExitCode
+		record.OOMKilled = state.OOMKilled
+		record.StartedAt, _ = time.Parse(time.RFC3339Nano, state.StartedAt)
+		record.FinishedAt, _ = time.Parse(time.RFC3339Nano, state.FinishedAt)
+	}
+	if inspectData.NetworkSettings != nil {
+		for port, bindings := range inspectData.NetworkSettings.Ports {
+			if len(bindings) > 0 {
+				record.Ports[string(port)] = bindings[0].HostPort
+			}
+		}
+	}
+	return record, nil
+}
+
+// ListInstances returns the state of every container created for any function, running or not
+func (ds *DockerService) ListInstances(ctx context.Context) ([]ContainerRecord, error) {
+	filterArgs := filters.NewArgs()
+	filterArgs.Add("label", "function_id")
+	containers, err := ds.cli.ContainerList(ctx, container.ListOptions{
+		All:     true,
+		Filters: filterArgs,
+	})
+	if err != nil {
+		ds.log.Error("Failed to list Docker containers: ", err)
+		return nil, errors.NewDockerError(fmt.Sprintf("error retrieving containers from docker: %v", err))
+	}
+
+	records := make([]ContainerRecord, 0, len(containers))
+	for _, inContainer := range containers {
+		record, err := ds.InspectContainer(ctx, inContainer.ID)
+		if err != nil {
+			// The container may have been removed since it was listed
+			ds.log.Errorf("Failed to inspect container '%s': %v", inContainer.ID, err)
+			continue
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// Logs returns up to the last tail lines of the container's stdout and stderr, or all output if tail is 0
+func (ds *DockerService) Logs(ctx context.Context, containerId string, tail int) (string, error) {
+	tailOpt := "all"
+	if tail > 0 {
+		tailOpt = strconv.Itoa(tail)
+	}
+
+	reader, err := ds.cli.ContainerLogs(ctx, containerId, container.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Tail:       tailOpt,
+	})
+	if err != nil {
+		return "", errors.NewDockerError(fmt.Sprintf("error retrieving container logs: %v", err))
+	}
+	defer reader.Close()
+
+	// Containers run without a tty, so stdout and stderr are multiplexed in the stream
+	var output bytes.Buffer
+	if _, err := stdcopy.StdCopy(&output, &output, reader); err != nil {
+		return "", errors.NewDockerError(fmt.Sprintf("error reading container logs: %v", err))
+	}
+	return output.String(), nil
+}
+
+// FunctionEvents subscribes to the docker events of every function container
+func (ds *DockerService) FunctionEvents(ctx context.Context) (<-chan events.Message, <-chan error) {
+	filterArgs := filters.NewArgs()
+	filterArgs.Add("type", string(events.ContainerEventType))
+	filterArgs.Add("label", "function_id")
+	return ds.cli.Events(ctx, events.ListOptions{Filters: filterArgs})
+}
+
+// listContainers returns every container of a function, read from the registry when it's in sync with docker
+func (ds *DockerService) listContainers(ctx context.Context, functionId string) ([]ContainerRecord, error) {
+	if ds.watching() {
+		return ds.registry.GetContainers(functionId), nil
+	}
+
+	filterArgs := filters.NewArgs()
+	filterArgs.Add("label", fmt.Sprintf("function_id=%s", functionId))
+	containers, err := ds.cli.ContainerList(ctx, container.ListOptions{
+		All:     true,
+		Filters: filterArgs,
+	})
+	if err != nil {
+		ds.log.Error("Failed to list Docker containers: ", err)
+		return nil, errors.NewDockerError(fmt.Sprintf("error retrieving containers from docker: %v", err))
+	}
+
+	records := make([]ContainerRecord, 0, len(containers))
+	for _, inContainer := range containers {
+		records = append(records, ContainerRecord{
+			ContainerId: inContainer.ID,
+			FunctionId:  functionId,
+			State:       inContainer.State,
+		})
+	}
+	return records, nil
+}
+
+func (ds *DockerService) watching() bool {
+	return ds.registry != nil && ds.registry.Watching()
+}
+
+func (ds *DockerService) expectStop(containerId string) {
+	if ds.registry != nil {
+		ds.registry.ExpectStop(containerId)
+	}
+}
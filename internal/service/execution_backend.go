@@ -0,0 +1,43 @@
+package service
+
+import (
+	"context"
+
+	"github.com/jwtly10/jambda/api/data"
+)
+
+const (
+	BackendDocker     = "docker"
+	BackendProcess    = "process"
+	BackendKubernetes = "kubernetes"
+)
+
+// BinariesDir is where uploaded function binaries are extracted to, relative to the working directory
+const BinariesDir = "binaries"
+
+// ExecutionBackend runs the instances of functions, e.g as docker containers or local processes.
+// Instances are identified by an id unique to the backend, which is used as the container id throughout jambda.
+type ExecutionBackend interface {
+	// StartInstance starts a new instance of the function, reusing a stopped one where possible, and returns its id
+	StartInstance(ctx context.Context, functionId string, config data.FunctionConfig) (string, error)
+	// WaitForRunning blocks until the instance is running, or returns an error if it exits first
+	WaitForRunning(ctx context.Context, instanceId string) error
+	// GetEndpoint returns the base url requests for the instance are proxied to
+	GetEndpoint(ctx context.Context, instanceId string, config data.FunctionConfig) (string, error)
+	// HealthCheck waits for a running instance to pass the function's health check
+	HealthCheck(ctx context.Context, instanceId string, config data.FunctionConfig) error
+	// Restart restarts a single instance
+	Restart(ctx context.Context, instanceId string) error
+	// Stop stops a single instance, leaving it to be started again later
+	Stop(instanceId string) error
+	// StopFunction stops every instance of the function
+	StopFunction(functionId string)
+	// Remove stops an instance if needed, and removes it entirely
+	Remove(ctx context.Context, instanceId string) error
+	// ListRunning returns the ids of the running instances of the function
+	ListRunning(ctx context.Context, functionId string) ([]string, error)
+	// ListInstances returns the state of every instance of every function, running or not
+	ListInstances(ctx context.Context) ([]ContainerRecord, error)
+	// Logs returns up to the last tail lines of output from the instance, or all output if tail is 0
+	Logs(ctx context.Context, instanceId string, tail int) (string, error)
+}
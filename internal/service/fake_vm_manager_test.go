@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/jwtly10/jambda/internal/errors"
+)
+
+// fakeVMManager boots pretend VMs that never run anything, for testing the vm isolation tier on machines without KVM
+type fakeVMManager struct {
+	mu  sync.Mutex
+	vms map[string]*VM
+	// Booted is every spec booted, in order
+	Booted []VMSpec
+	// BootErr is returned from Boot when set
+	BootErr error
+}
+
+func newFakeVMManager() *fakeVMManager {
+	return &fakeVMManager{
+		vms: make(map[string]*VM),
+	}
+}
+
+func (fm *fakeVMManager) Boot(ctx context.Context, spec VMSpec) (*VM, error) {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	if fm.BootErr != nil {
+		return nil, fm.BootErr
+	}
+
+	fm.Booted = append(fm.Booted, spec)
+	vm := newVM(spec.Id, "127.0.0.1")
+	fmt.Fprintf(vm.console, "booted %s\n", spec.Binary)
+	fm.vms[spec.Id] = vm
+	return vm, nil
+}
+
+func (fm *fakeVMManager) Shutdown(ctx context.Context, id string) error {
+	return fm.Crash(id, 0)
+}
+
+// Crash exits a VM as if the guest had stopped by itself
+func (fm *fakeVMManager) Crash(id string, exitCode int) error {
+	fm.mu.Lock()
+	vm, exists := fm.vms[id]
+	fm.mu.Unlock()
+	if !exists {
+		return errors.NewNotFoundError(fmt.Sprintf("vm '%s' not found", id))
+	}
+	vm.exited(exitCode)
+	return nil
+}
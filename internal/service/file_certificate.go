@@ -0,0 +1,109 @@
+package service
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jwtly10/jambda/internal/logging"
+)
+
+// FileCertificate serves a certificate and key loaded from files, reloading them when either file changes,
+// so renewed certificates are picked up without restarting jambda
+type FileCertificate struct {
+	log      logging.Logger
+	certFile string
+	keyFile  string
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	// modTimes are the modification times of the files the current certificate was loaded from
+	modTimes [2]time.Time
+}
+
+func NewFileCertificate(log logging.Logger, certFile string, keyFile string) (*FileCertificate, error) {
+	fc := &FileCertificate{
+		log:      log,
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+	if _, err := fc.Reload(); err != nil {
+		return nil, err
+	}
+	return fc, nil
+}
+
+// GetCertificate returns the current certificate, for use as tls.Config.GetCertificate
+func (fc *FileCertificate) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	fc.mu.RLock()
+	defer fc.mu.RUnlock()
+	return fc.cert, nil
+}
+
+// Covers returns whether the certificate is valid for the host name
+func (fc *FileCertificate) Covers(host string) bool {
+	fc.mu.RLock()
+	defer fc.mu.RUnlock()
+	return fc.cert.Leaf.VerifyHostname(host) == nil
+}
+
+// Reload loads the files again if they have changed since they were last loaded, returning whether they were.
+// The current certificate is kept if the new files can't be loaded, e.g when only one of them has been written yet.
+func (fc *FileCertificate) Reload() (bool, error) {
+	modTimes, err := fc.fileModTimes()
+	if err != nil {
+		return false, err
+	}
+
+	fc.mu.RLock()
+	unchanged := fc.cert != nil && modTimes == fc.modTimes
+	fc.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(fc.certFile, fc.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("error loading certificate '%s' and key '%s': %v", fc.certFile, fc.keyFile, err)
+	}
+	if cert.Leaf == nil {
+		cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return false, fmt.Errorf("error parsing certificate '%s': %v", fc.certFile, err)
+		}
+	}
+
+	fc.mu.Lock()
+	fc.cert = &cert
+	fc.modTimes = modTimes
+	fc.mu.Unlock()
+
+	fc.log.Infof("Loaded TLS certificate for %v, valid until %s", cert.Leaf.DNSNames, cert.Leaf.NotAfter.Format(time.RFC3339))
+	return true, nil
+}
+
+// Run checks the files for changes every interval
+func (fc *FileCertificate) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if _, err := fc.Reload(); err != nil {
+			fc.log.Errorf("Failed to reload TLS certificate, keeping the current one: %v", err)
+		}
+	}
+}
+
+func (fc *FileCertificate) fileModTimes() ([2]time.Time, error) {
+	var modTimes [2]time.Time
+	for i, file := range []string{fc.certFile, fc.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return modTimes, fmt.Errorf("error reading '%s': %v", file, err)
+		}
+		modTimes[i] = info.ModTime()
+	}
+	return modTimes, nil
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jwtly10/jambda/internal/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zapcore"
+)
+
+// selfSignedPem returns a certificate and key for the domain in pem format
+func selfSignedPem(t *testing.T, domain string, notAfter time.Time) ([]byte, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: domain},
+		DNSNames:     []string{domain},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+}
+
+func writeCertFiles(t *testing.T, dir string, domain string, modTime time.Time) (string, string) {
+	t.Helper()
+	certPem, keyPem := selfSignedPem(t, domain, time.Now().Add(24*time.Hour))
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	require.NoError(t, os.WriteFile(certFile, certPem, 0600))
+	require.NoError(t, os.WriteFile(keyFile, keyPem, 0600))
+	require.NoError(t, os.Chtimes(certFile, modTime, modTime))
+	require.NoError(t, os.Chtimes(keyFile, modTime, modTime))
+	return certFile, keyFile
+}
+
+func TestFileCertificateReload(t *testing.T) {
+	logger := logging.NewLogger(false, zapcore.DebugLevel)
+	dir := t.TempDir()
+	modTime := time.Now().Add(-time.Minute)
+	certFile, keyFile := writeCertFiles(t, dir, "old.home.lan", modTime)
+
+	fc, err := NewFileCertificate(logger, certFile, keyFile)
+	require.NoError(t, err)
+	assert.True(t, fc.Covers("old.home.lan"))
+
+	// Unchanged files aren't loaded again
+	reloaded, err := fc.Reload()
+	assert.NoError(t, err)
+	assert.False(t, reloaded)
+
+	// A half written update keeps the current certificate
+	require.NoError(t, os.WriteFile(keyFile, []byte("partial"), 0600))
+	_, err = fc.Reload()
+	assert.Error(t, err)
+	assert.True(t, fc.Covers("old.home.lan"))
+
+	writeCertFiles(t, dir, "new.home.lan", time.Now())
+	reloaded, err = fc.Reload()
+	assert.NoError(t, err)
+	assert.True(t, reloaded)
+	assert.True(t, fc.Covers("new.home.lan"))
+	assert.False(t, fc.Covers("old.home.lan"))
+
+	cert, err := fc.GetCertificate(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "new.home.lan", cert.Leaf.Subject.CommonName)
+}
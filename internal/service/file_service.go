@@ -144,7 +144,7 @@ func (fs *FileService) extractAndValidateZip(zipPath, genId string) error {
 		fs.log.Infof("Found file %s", f.Name)
 		// TODO: More file validation, support jars/python scripts
 		if (f.Name == "bootstrap" || f.Name == "bootstrap.jar") && f.FileInfo().Mode().IsRegular() {
-			extractPath := filepath.Join("binaries", genId, f.Name)
+			extractPath := filepath.Join(BinariesDir, genId, f.Name)
 			if err := fs.extractFile(f, extractPath); err != nil {
 				return err
 			}
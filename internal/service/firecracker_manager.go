@@ -0,0 +1,352 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jwtly10/jambda/internal/errors"
+	"github.com/jwtly10/jambda/internal/logging"
+)
+
+const (
+	// firecrackerShutdownTimeout is how long a guest has to shut down after ctrl+alt+del, before the VM is killed
+	firecrackerShutdownTimeout = 10 * time.Second
+
+	// vmSubnetBase is the start of the range VM networks are allocated from, a /30 per VM
+	vmSubnetBase = "172.16.0.0"
+	maxVMSubnets = 1 << 14
+)
+
+// FirecrackerConfig is the host setup shared by every VM
+type FirecrackerConfig struct {
+	// Binary is the firecracker executable, defaults to 'firecracker' on the PATH
+	Binary string
+	// KernelImage is an uncompressed linux kernel built for firecracker
+	KernelImage string
+	// RootfsImage is a read only ext4 root filesystem shared by every VM. Its init must mount the function
+	// drive /dev/vdb, and run /bootstrap from it with the KEY=VALUE lines of its env file as the environment.
+	RootfsImage string
+	// WorkDir holds the api socket, config and function drive of each VM
+	WorkDir  string
+	VCPUs    int
+	MemoryMB int
+}
+
+// firecrackerVM is a firecracker process and the host resources it uses
+type firecrackerVM struct {
+	vm     *VM
+	cmd    *exec.Cmd
+	dir    string
+	socket string
+	tap    string
+	subnet int
+}
+
+// FirecrackerManager boots each VM as a firecracker process, with its own tap device and /30 network.
+// It needs access to /dev/kvm and CAP_NET_ADMIN to create tap devices, along with mkfs.ext4 to build function drives.
+type FirecrackerManager struct {
+	log     logging.Logger
+	config  FirecrackerConfig
+	mu      sync.Mutex
+	vms     map[string]*firecrackerVM
+	subnets map[int]bool
+}
+
+func NewFirecrackerManager(log logging.Logger, config FirecrackerConfig) *FirecrackerManager {
+	if config.Binary == "" {
+		config.Binary = "firecracker"
+	}
+	if config.WorkDir == "" {
+		config.WorkDir = filepath.Join(os.TempDir(), "jambda-vms")
+	}
+	if config.VCPUs <= 0 {
+		config.VCPUs = 1
+	}
+	if config.MemoryMB <= 0 {
+		config.MemoryMB = 256
+	}
+	return &FirecrackerManager{
+		log:     log,
+		config:  config,
+		vms:     make(map[string]*firecrackerVM),
+		subnets: make(map[int]bool),
+	}
+}
+
+func (fm *FirecrackerManager) Boot(ctx context.Context, spec VMSpec) (*VM, error) {
+	subnet, err := fm.allocateSubnet()
+	if err != nil {
+		return nil, err
+	}
+	hostIP, guestIP := vmAddresses(subnet)
+
+	fvm := &firecrackerVM{
+		dir:    filepath.Join(fm.config.WorkDir, spec.Id),
+		tap:    fmt.Sprintf("jfc%d", subnet),
+		subnet: subnet,
+	}
+	fvm.socket = filepath.Join(fvm.dir, "firecracker.sock")
+
+	if err := fm.prepare(ctx, fvm, spec, hostIP, guestIP); err != nil {
+		fm.cleanup(fvm)
+		return nil, err
+	}
+
+	fvm.vm = newVM(spec.Id, guestIP.String())
+	fvm.cmd = exec.Command(fm.config.Binary, "--api-sock", fvm.socket, "--config-file", filepath.Join(fvm.dir, "config.json"))
+	fvm.cmd.Stdout = fvm.vm.console
+	fvm.cmd.Stderr = fvm.vm.console
+	fvm.cmd.SysProcAttr = sandboxAttributes()
+	if err := fvm.cmd.Start(); err != nil {
+		fm.cleanup(fvm)
+		return nil, fmt.Errorf("error starting firecracker: %v", err)
+	}
+
+	fm.mu.Lock()
+	fm.vms[spec.Id] = fvm
+	fm.mu.Unlock()
+
+	go fm.wait(fvm)
+	return fvm.vm, nil
+}
+
+// Shutdown sends ctrl+alt+del to the guest, which reboots and so exits firecracker, killing it if that takes too long
+func (fm *FirecrackerManager) Shutdown(ctx context.Context, id string) error {
+	fm.mu.Lock()
+	fvm, exists := fm.vms[id]
+	fm.mu.Unlock()
+	if !exists {
+		return errors.NewNotFoundError(fmt.Sprintf("vm '%s' not found", id))
+	}
+
+	if err := fm.action(ctx, fvm, "SendCtrlAltDel"); err != nil {
+		fm.log.Errorf("Failed to send ctrl+alt+del to vm %s: %v", id, err)
+	}
+
+	select {
+	case <-fvm.vm.Done():
+	case <-time.After(firecrackerShutdownTimeout):
+		fm.log.Errorf("VM %s did not shut down within %s, killing it", id, firecrackerShutdownTimeout)
+		if err := fvm.cmd.Process.Kill(); err != nil {
+			return fmt.Errorf("error killing firecracker: %v", err)
+		}
+		<-fvm.vm.Done()
+	}
+	return nil
+}
+
+// prepare builds the function drive, tap device and firecracker config of a VM
+func (fm *FirecrackerManager) prepare(ctx context.Context, fvm *firecrackerVM, spec VMSpec, hostIP net.IP, guestIP net.IP) error {
+	if err := os.MkdirAll(fvm.dir, 0700); err != nil {
+		return fmt.Errorf("error creating vm directory: %v", err)
+	}
+
+	drive := filepath.Join(fvm.dir, "function.ext4")
+	if err := buildFunctionDrive(ctx, fvm.dir, drive, spec); err != nil {
+		return err
+	}
+
+	for _, args := range [][]string{
+		{"tuntap", "add", "dev", fvm.tap, "mode", "tap"},
+		{"addr", "add", hostIP.String() + "/30", "dev", fvm.tap},
+		{"link", "set", "dev", fvm.tap, "up"},
+	} {
+		if output, err := exec.CommandContext(ctx, "ip", args...).CombinedOutput(); err != nil {
+			return fmt.Errorf("error setting up tap device '%s': %v: %s", fvm.tap, err, output)
+		}
+	}
+
+	config, err := json.MarshalIndent(firecrackerConfig(fm.config, drive, fvm.tap, hostIP, guestIP), "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshalling firecracker config: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(fvm.dir, "config.json"), config, 0600); err != nil {
+		return fmt.Errorf("error writing firecracker config: %v", err)
+	}
+	return nil
+}
+
+// wait frees the VM's resources once firecracker exits
+func (fm *FirecrackerManager) wait(fvm *firecrackerVM) {
+	fvm.cmd.Wait()
+	exitCode := fvm.cmd.ProcessState.ExitCode()
+
+	fm.mu.Lock()
+	if fm.vms[fvm.vm.Id] == fvm {
+		delete(fm.vms, fvm.vm.Id)
+	}
+	fm.mu.Unlock()
+
+	fm.cleanup(fvm)
+	fvm.vm.exited(exitCode)
+}
+
+func (fm *FirecrackerManager) cleanup(fvm *firecrackerVM) {
+	if output, err := exec.Command("ip", "link", "del", fvm.tap).CombinedOutput(); err != nil {
+		fm.log.Debugf("Failed to delete tap device '%s': %v: %s", fvm.tap, err, output)
+	}
+	os.RemoveAll(fvm.dir)
+
+	fm.mu.Lock()
+	delete(fm.subnets, fvm.subnet)
+	fm.mu.Unlock()
+}
+
+// action sends an action to the firecracker api over its unix socket
+func (fm *FirecrackerManager) action(ctx context.Context, fvm *firecrackerVM, actionType string) error {
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", fvm.socket)
+			},
+		},
+	}
+
+	body, _ := json.Marshal(map[string]string{"action_type": actionType})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, "http://localhost/actions", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("firecracker returned %d: %s", resp.StatusCode, msg)
+	}
+	return nil
+}
+
+func (fm *FirecrackerManager) allocateSubnet() (int, error) {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	for i := 0; i < maxVMSubnets; i++ {
+		if !fm.subnets[i] {
+			fm.subnets[i] = true
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("no free vm subnets")
+}
+
+// vmAddresses returns the host and guest addresses of the n'th /30 subnet
+func vmAddresses(subnet int) (net.IP, net.IP) {
+	base := net.ParseIP(vmSubnetBase).To4()
+	offset := subnet * 4
+	network := net.IPv4(base[0], base[1]+byte(offset>>16), base[2]+byte(offset>>8), base[3]+byte(offset)).To4()
+	host := net.IPv4(network[0], network[1], network[2], network[3]+1).To4()
+	guest := net.IPv4(network[0], network[1], network[2], network[3]+2).To4()
+	return host, guest
+}
+
+// buildFunctionDrive creates an ext4 image holding the function's binary and environment
+func buildFunctionDrive(ctx context.Context, dir string, drive string, spec VMSpec) error {
+	staging := filepath.Join(dir, "drive")
+	if err := os.MkdirAll(staging, 0755); err != nil {
+		return fmt.Errorf("error creating function drive: %v", err)
+	}
+	defer os.RemoveAll(staging)
+
+	binary, err := os.ReadFile(spec.Binary)
+	if err != nil {
+		return fmt.Errorf("error reading function binary: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(staging, "bootstrap"), binary, 0755); err != nil {
+		return fmt.Errorf("error copying function binary: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(staging, "env"), []byte(vmEnvFile(spec)), 0644); err != nil {
+		return fmt.Errorf("error writing function env: %v", err)
+	}
+
+	// Leave some headroom over the binary for the filesystem itself
+	sizeMB := len(binary)>>20 + 16
+	output, err := exec.CommandContext(ctx, "mkfs.ext4", "-q", "-F", "-d", staging, drive, fmt.Sprintf("%dM", sizeMB)).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("error building function drive: %v: %s", err, output)
+	}
+	return nil
+}
+
+// vmEnvFile is the environment of the function inside the guest, one KEY=VALUE per line
+func vmEnvFile(spec VMSpec) string {
+	var env bytes.Buffer
+	fmt.Fprintf(&env, "PORT=%d\n", spec.Port)
+	keys := make([]string, 0, len(spec.Env))
+	for key := range spec.Env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(&env, "%s=%s\n", key, spec.Env[key])
+	}
+	return env.String()
+}
+
+type firecrackerBootSource struct {
+	KernelImagePath string `json:"kernel_image_path"`
+	BootArgs        string `json:"boot_args"`
+}
+
+type firecrackerDrive struct {
+	DriveId      string `json:"drive_id"`
+	PathOnHost   string `json:"path_on_host"`
+	IsRootDevice bool   `json:"is_root_device"`
+	IsReadOnly   bool   `json:"is_read_only"`
+}
+
+type firecrackerNetworkInterface struct {
+	IfaceId     string `json:"iface_id"`
+	GuestMac    string `json:"guest_mac"`
+	HostDevName string `json:"host_dev_name"`
+}
+
+type firecrackerMachineConfig struct {
+	VCPUCount  int `json:"vcpu_count"`
+	MemSizeMib int `json:"mem_size_mib"`
+}
+
+type firecrackerVMConfig struct {
+	BootSource        firecrackerBootSource         `json:"boot-source"`
+	Drives            []firecrackerDrive            `json:"drives"`
+	NetworkInterfaces []firecrackerNetworkInterface `json:"network-interfaces"`
+	MachineConfig     firecrackerMachineConfig      `json:"machine-config"`
+}
+
+// firecrackerConfig is the --config-file of a VM. The guest's network is configured by the kernel from its boot args.
+func firecrackerConfig(config FirecrackerConfig, drive string, tap string, hostIP net.IP, guestIP net.IP) firecrackerVMConfig {
+	return firecrackerVMConfig{
+		BootSource: firecrackerBootSource{
+			KernelImagePath: config.KernelImage,
+			BootArgs:        fmt.Sprintf("console=ttyS0 reboot=k panic=1 pci=off ip=%s::%s:255.255.255.252::eth0:off", guestIP, hostIP),
+		},
+		Drives: []firecrackerDrive{
+			{DriveId: "rootfs", PathOnHost: config.RootfsImage, IsRootDevice: true, IsReadOnly: true},
+			{DriveId: "function", PathOnHost: drive, IsReadOnly: true},
+		},
+		NetworkInterfaces: []firecrackerNetworkInterface{{
+			IfaceId:     "eth0",
+			GuestMac:    fmt.Sprintf("06:00:%02x:%02x:%02x:%02x", guestIP[0], guestIP[1], guestIP[2], guestIP[3]),
+			HostDevName: tap,
+		}},
+		MachineConfig: firecrackerMachineConfig{
+			VCPUCount:  config.VCPUs,
+			MemSizeMib: config.MemoryMB,
+		},
+	}
+}
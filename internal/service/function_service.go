@@ -3,6 +3,8 @@ package service
 import (
 	"fmt"
 	"net/http"
+	"os"
+	"path/filepath"
 
 	"github.com/jwtly10/jambda/api/data"
 	"github.com/jwtly10/jambda/internal/errors"
@@ -15,6 +17,10 @@ type FunctionService struct {
 	log  logging.Logger
 	fs   FileService
 	cv   ConfigValidator
+	// onDeploy is called after a function is uploaded or its config is updated
+	onDeploy func(functionId string, config data.FunctionConfig)
+	// onDelete is called after a function is deleted
+	onDelete func(functionId string)
 }
 
 func NewFunctionService(repo repository.IFunctionRepository, log logging.Logger, fs FileService, cv ConfigValidator) *FunctionService {
@@ -26,9 +32,27 @@ func NewFunctionService(repo repository.IFunctionRepository, log logging.Logger,
 	}
 }
 
+// OnDeploy registers a callback run after a function is uploaded or its config is updated.
+// Must be called before the service is copied into handlers.
+func (fs *FunctionService) OnDeploy(fn func(functionId string, config data.FunctionConfig)) {
+	fs.onDeploy = fn
+}
+
+// OnDelete registers a callback run after a function is deleted.
+// Must be called before the service is copied into handlers.
+func (fs *FunctionService) OnDelete(fn func(functionId string)) {
+	fs.onDelete = fn
+}
+
 // UploadFunction uploads a new function by processing the binary and saving the file and configuration for function.
 func (fs *FunctionService) UploadFunction(r *http.Request) (*data.FunctionEntity, error) {
-	return fs.fs.ProcessNewFunction(r)
+	res, err := fs.fs.ProcessNewFunction(r)
+	if err != nil {
+		return nil, err
+	}
+
+	fs.deployed(res)
+	return res, nil
 }
 
 func (fs *FunctionService) UpdateConfig(externalId, name string, config *data.FunctionConfig) (*data.FunctionEntity, error) {
@@ -47,9 +71,16 @@ func (fs *FunctionService) UpdateConfig(externalId, name string, config *data.Fu
 		return nil, errors.NewInternalError(fmt.Sprintf("error updating new function config to db: %v", err))
 	}
 
+	fs.deployed(res)
 	return res, nil
 }
 
+func (fs *FunctionService) deployed(function *data.FunctionEntity) {
+	if fs.onDeploy != nil && function.Configuration != nil {
+		fs.onDeploy(function.ExternalId, *function.Configuration)
+	}
+}
+
 func (fs *FunctionService) GetAllActiveFunctions() ([]data.FunctionEntity, error) {
 	fs.log.Info("Getting all active functions")
 	functions, err := fs.repo.GetAllActiveFunctions()
@@ -72,6 +103,30 @@ func (fs *FunctionService) DeleteFunction(externalId string) error {
 		fs.log.Error("Failed to delete function: ", err)
 		return errors.NewInternalError(fmt.Sprintf("error deleting function from db: %v", err))
 	}
+
+	// Clean up the function's containers, so they don't keep running or sit stopped forever
+	if fs.onDelete != nil {
+		fs.onDelete(externalId)
+	}
 	// Now should also delete from the file system too TODO
 	return nil
 }
+
+// GetArtifactPath returns the path of the function's uploaded binary or jar
+func (fs *FunctionService) GetArtifactPath(externalId string) (string, error) {
+	function, err := fs.repo.GetFunctionEntityFromExternalId(externalId)
+	if err != nil {
+		return "", errors.NewInternalError(fmt.Sprintf("error getting function from db: %v", err))
+	}
+	if function == nil {
+		return "", errors.NewNotFoundError(fmt.Sprintf("function '%s' not found", externalId))
+	}
+
+	for _, name := range []string{"bootstrap", "bootstrap.jar"} {
+		path := filepath.Join(BinariesDir, externalId, name)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", errors.NewNotFoundError(fmt.Sprintf("artifact of function '%s' not found", externalId))
+}
@@ -1,16 +1,232 @@
 package service
 
-import "github.com/jwtly10/jambda/internal/logging"
+import (
+	"context"
+	stderrors "errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/jwtly10/jambda/api/data"
+	"github.com/jwtly10/jambda/internal/logging"
+	"github.com/jwtly10/jambda/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	proxyDialTimeout           = 5 * time.Second
+	proxyKeepAlive             = 30 * time.Second
+	proxyMaxIdleConns          = 64
+	proxyIdleConnTimeout       = 90 * time.Second
+	proxyExpectContinueTimeout = time.Second
+
+	defaultRetryBackoff    = 100 * time.Millisecond
+	defaultRetryMaxBackoff = 2 * time.Second
+)
+
+// Upstream is the function instance a proxied request is sent to, for applying the function's retry and circuit breaker policy
+type Upstream struct {
+	FunctionId  string
+	ContainerId string
+	Config      *data.FunctionConfig
+}
+
+type upstreamKey struct{}
+
+// WithUpstream returns a context for requests to the upstream, so they're sent with its function's policy
+func WithUpstream(ctx context.Context, upstream Upstream) context.Context {
+	return context.WithValue(ctx, upstreamKey{}, upstream)
+}
+
+type instanceTransport struct {
+	transport *http.Transport
+	lastUsed  time.Time
+}
+
+// GatewayService holds the connection pools used to proxy requests to function instances.
+// Every instance gets its own transport, so idle connections are reused between requests to it.
 type GatewayService struct {
-	log logging.Logger
+	log        logging.Logger
+	mu         sync.Mutex
+	transports map[string]*instanceTransport
+	// onUpstreamError is called when a request to an instance fails, so its health can be checked again
+	onUpstreamError func(functionId string, containerId string)
+	// defaultTimeout bounds requests to functions without a timeout of their own
+	defaultTimeout time.Duration
+	// onTimeout is called when a function doesn't respond to a request within its timeout
+	onTimeout func(functionId string)
+	breaker   *CircuitBreakerService
 }
 
-func NewGatewayService(log logging.Logger) *GatewayService {
+func NewGatewayService(log logging.Logger, defaultTimeout time.Duration, breaker *CircuitBreakerService) *GatewayService {
 	return &GatewayService{
-		log: log,
+		log:            log,
+		transports:     make(map[string]*instanceTransport),
+		defaultTimeout: defaultTimeout,
+		breaker:        breaker,
 	}
 }
 
-func (gs *GatewayService) DoSomething() {
+// FunctionTimeout returns how long the function is given to respond to a request, the config may be nil
+func (gs *GatewayService) FunctionTimeout(config *data.FunctionConfig) time.Duration {
+	if config != nil && config.Timeout > 0 {
+		return config.Timeout.Std()
+	}
+	return gs.defaultTimeout
+}
+
+// OnTimeout registers a callback run when a function doesn't respond to a request within its timeout
+func (gs *GatewayService) OnTimeout(fn func(functionId string)) {
+	gs.onTimeout = fn
+}
+
+// TimedOut reports a request its function didn't respond to within its timeout
+func (gs *GatewayService) TimedOut(functionId string, timeout time.Duration) {
+	gs.log.Warn("Proxied request timed out", "function", functionId, "timeout", timeout)
+	if gs.onTimeout != nil {
+		gs.onTimeout(functionId)
+	}
+}
+
+// OnUpstreamError registers a callback run when a proxied request fails to reach an instance
+func (gs *GatewayService) OnUpstreamError(fn func(functionId string, containerId string)) {
+	gs.onUpstreamError = fn
+}
+
+// UpstreamError reports a failed request to an instance
+func (gs *GatewayService) UpstreamError(functionId string, containerId string, err error) {
+	gs.log.Warn("Proxied request failed", "function", functionId, "container", containerId, "error", err)
+	if gs.onUpstreamError != nil && containerId != "" {
+		gs.onUpstreamError(functionId, containerId)
+	}
+}
+
+// RoundTrip sends the request with the transport of the instance it's addressed to.
+// Requests with an upstream in their context are retried, and counted by the circuit breaker, as their function's config says.
+func (gs *GatewayService) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport := gs.transport(req.URL.Scheme+"://"+req.URL.Host, time.Now())
+	upstream, ok := req.Context().Value(upstreamKey{}).(Upstream)
+	if !ok || upstream.Config == nil {
+		return transport.RoundTrip(req)
+	}
+
+	// The span of the upstream call, started by the tracing transport in front of this one
+	span := trace.SpanFromContext(req.Context())
+	span.SetAttributes(tracing.FunctionIdKey.String(upstream.FunctionId), tracing.ContainerIdKey.String(upstream.ContainerId))
+
+	retries := 0
+	if upstream.Config.Retry != nil && retryable(req) {
+		retries = upstream.Config.Retry.Attempts
+	}
+	for attempt := 0; ; attempt++ {
+		resp, err := transport.RoundTrip(req)
+		if err == nil {
+			gs.breaker.Success(upstream.FunctionId)
+			return resp, nil
+		}
+		if !isConnectionError(req, err) {
+			return nil, err
+		}
+		if attempt >= retries {
+			if upstream.Config.CircuitBreaker != nil {
+				gs.breaker.Failure(upstream.FunctionId, upstream.ContainerId, *upstream.Config.CircuitBreaker, time.Now())
+			}
+			return nil, err
+		}
+
+		wait := retryBackoff(*upstream.Config.Retry, attempt)
+		gs.log.Warn("Retrying proxied request", "function", upstream.FunctionId, "container", upstream.ContainerId, "retry", attempt+1, "wait", wait, "error", err)
+		span.AddEvent("retry", trace.WithAttributes(attribute.Int("retry", attempt+1), attribute.String("error", err.Error())))
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, err
+		}
+	}
+}
+
+// retryable returns whether sending the request again is safe, as its method is idempotent and it has no body that's already been read
+func retryable(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return req.Body == nil || req.Body == http.NoBody
+	default:
+		return false
+	}
+}
+
+// isConnectionError returns whether the request failed to get a response from the instance, e.g the connection was refused or reset.
+// Cancelled and timed out requests aren't, as there's no time left to retry them.
+func isConnectionError(req *http.Request, err error) bool {
+	if req.Context().Err() != nil {
+		return false
+	}
+	var netErr net.Error
+	if stderrors.As(err, &netErr) && netErr.Timeout() {
+		return false
+	}
+	var opErr *net.OpError
+	return stderrors.As(err, &opErr) || stderrors.Is(err, io.EOF) || stderrors.Is(err, io.ErrUnexpectedEOF) || stderrors.Is(err, syscall.ECONNRESET)
+}
+
+// retryBackoff doubles the wait for each retry up to the max, half of it random so clients retrying together spread out
+func retryBackoff(config data.RetryConfig, attempt int) time.Duration {
+	backoff := defaultRetryBackoff
+	if config.Backoff > 0 {
+		backoff = config.Backoff.Std()
+	}
+	maxBackoff := defaultRetryMaxBackoff
+	if config.MaxBackoff > 0 {
+		maxBackoff = config.MaxBackoff.Std()
+	}
+
+	wait := backoff << attempt
+	if wait > maxBackoff || wait <= 0 {
+		wait = maxBackoff
+	}
+	return wait/2 + rand.N(wait/2+1)
+}
+
+// transport returns the transport of an instance, creating it on first use.
+// Transports of instances that haven't been used for a while are closed, as the instance is likely gone.
+func (gs *GatewayService) transport(instanceUrl string, now time.Time) *http.Transport {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+
+	if it, exists := gs.transports[instanceUrl]; exists {
+		it.lastUsed = now
+		return it.transport
+	}
+
+	for url, it := range gs.transports {
+		if now.Sub(it.lastUsed) > proxyIdleConnTimeout {
+			it.transport.CloseIdleConnections()
+			delete(gs.transports, url)
+		}
+	}
+
+	it := &instanceTransport{transport: newInstanceTransport(), lastUsed: now}
+	gs.transports[instanceUrl] = it
+	return it.transport
+}
+
+func newInstanceTransport() *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   proxyDialTimeout,
+		KeepAlive: proxyKeepAlive,
+	}
+	return &http.Transport{
+		DialContext:           dialer.DialContext,
+		MaxIdleConns:          proxyMaxIdleConns,
+		MaxIdleConnsPerHost:   proxyMaxIdleConns,
+		IdleConnTimeout:       proxyIdleConnTimeout,
+		ExpectContinueTimeout: proxyExpectContinueTimeout,
+	}
 }
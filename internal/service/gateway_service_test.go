@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jwtly10/jambda/api/data"
+	"github.com/jwtly10/jambda/internal/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestGatewayTransportPerInstance(t *testing.T) {
+	logger := logging.NewLogger(false, zapcore.DebugLevel)
+	gs := NewGatewayService(logger, time.Minute, NewCircuitBreakerService(logger))
+	now := time.Now()
+
+	first := gs.transport("http://localhost:8001", now)
+	assert.Same(t, first, gs.transport("http://localhost:8001", now.Add(time.Second)))
+	assert.NotSame(t, first, gs.transport("http://localhost:8002", now.Add(time.Second)))
+	assert.Equal(t, proxyIdleConnTimeout, first.IdleConnTimeout)
+
+	// Transports of instances that haven't been used in a while are dropped when a new instance is seen
+	gs.transport("http://localhost:8003", now.Add(proxyIdleConnTimeout+2*time.Second))
+	assert.Len(t, gs.transports, 1)
+	assert.NotSame(t, first, gs.transport("http://localhost:8001", now.Add(proxyIdleConnTimeout+3*time.Second)))
+}
+
+func TestUpstreamErrorTriggersRecheck(t *testing.T) {
+	logger := logging.NewLogger(false, zapcore.DebugLevel)
+	gs := NewGatewayService(logger, time.Minute, NewCircuitBreakerService(logger))
+	var rechecked []string
+	gs.OnUpstreamError(func(functionId string, containerId string) {
+		rechecked = append(rechecked, functionId+"/"+containerId)
+	})
+
+	gs.UpstreamError("fn", "abc", assert.AnError)
+	// Without a container there is nothing to check
+	gs.UpstreamError("fn", "", assert.AnError)
+	assert.Equal(t, []string{"fn/abc"}, rechecked)
+}
+
+func TestFunctionTimeout(t *testing.T) {
+	logger := logging.NewLogger(false, zapcore.DebugLevel)
+	gs := NewGatewayService(logger, time.Minute, NewCircuitBreakerService(logger))
+	var timedOut []string
+	gs.OnTimeout(func(functionId string) { timedOut = append(timedOut, functionId) })
+
+	assert.Equal(t, time.Minute, gs.FunctionTimeout(nil))
+	assert.Equal(t, time.Minute, gs.FunctionTimeout(&data.FunctionConfig{}))
+	assert.Equal(t, 5*time.Second, gs.FunctionTimeout(&data.FunctionConfig{Timeout: data.Duration(5 * time.Second)}))
+
+	gs.TimedOut("fn", time.Minute)
+	assert.Equal(t, []string{"fn"}, timedOut)
+}
+
+// flakyInstance closes the connection of the first failures requests without responding
+func flakyInstance(t *testing.T, failures int) (*httptest.Server, *atomic.Int32) {
+	var requests atomic.Int32
+	instance := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if int(requests.Add(1)) <= failures {
+			conn, _, err := w.(http.Hijacker).Hijack()
+			require.NoError(t, err)
+			conn.Close()
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(instance.Close)
+	return instance, &requests
+}
+
+func TestRoundTripRetriesConnectionErrors(t *testing.T) {
+	logger := logging.NewLogger(false, zapcore.DebugLevel)
+	gs := NewGatewayService(logger, time.Minute, NewCircuitBreakerService(logger))
+	config := &data.FunctionConfig{Retry: &data.RetryConfig{Attempts: 2, Backoff: data.Duration(time.Millisecond)}}
+
+	t.Run("idempotent requests are retried", func(t *testing.T) {
+		instance, requests := flakyInstance(t, 2)
+		req := httptest.NewRequest(http.MethodGet, instance.URL, nil).WithContext(WithUpstream(context.Background(), Upstream{FunctionId: "fn", Config: config}))
+		req.RequestURI = ""
+
+		resp, err := gs.RoundTrip(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, int32(3), requests.Load())
+	})
+
+	t.Run("requests with a body are not", func(t *testing.T) {
+		instance, requests := flakyInstance(t, 1)
+		req := httptest.NewRequest(http.MethodPut, instance.URL, strings.NewReader("body")).WithContext(WithUpstream(context.Background(), Upstream{FunctionId: "fn", Config: config}))
+		req.RequestURI = ""
+
+		_, err := gs.RoundTrip(req)
+		assert.Error(t, err)
+		assert.Equal(t, int32(1), requests.Load())
+	})
+}
+
+func TestRoundTripOpensCircuitBreaker(t *testing.T) {
+	logger := logging.NewLogger(false, zapcore.DebugLevel)
+	cb := NewCircuitBreakerService(logger)
+	opened := make(chan []string, 1)
+	cb.OnOpen(func(functionId string, containerIds []string) { opened <- containerIds })
+	gs := NewGatewayService(logger, time.Minute, cb)
+	config := &data.FunctionConfig{
+		Retry:          &data.RetryConfig{Attempts: 1, Backoff: data.Duration(time.Millisecond)},
+		CircuitBreaker: &data.CircuitBreakerConfig{FailureThreshold: 2},
+	}
+
+	instance, requests := flakyInstance(t, 100)
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodGet, instance.URL, nil).WithContext(WithUpstream(context.Background(), Upstream{FunctionId: "fn", ContainerId: "abc", Config: config}))
+		req.RequestURI = ""
+		_, err := gs.RoundTrip(req)
+		assert.Error(t, err)
+	}
+
+	// Retries of a request count as one failure
+	assert.Equal(t, int32(4), requests.Load())
+	assert.Equal(t, []string{"abc"}, <-opened)
+	assert.Error(t, cb.Allow("fn", *config.CircuitBreaker, time.Now()))
+}
+
+func TestRetryBackoff(t *testing.T) {
+	config := data.RetryConfig{Attempts: 5, Backoff: data.Duration(100 * time.Millisecond), MaxBackoff: data.Duration(300 * time.Millisecond)}
+	for i := 0; i < 20; i++ {
+		first := retryBackoff(config, 0)
+		assert.True(t, first >= 50*time.Millisecond && first <= 100*time.Millisecond, first)
+		capped := retryBackoff(config, 4)
+		assert.True(t, capped >= 150*time.Millisecond && capped <= 300*time.Millisecond, capped)
+	}
+}
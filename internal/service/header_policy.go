@@ -0,0 +1,114 @@
+package service
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/jwtly10/jambda/api/data"
+)
+
+const (
+	// RequestIdHeader carries the invocation id of requests to functions, and is returned in their responses
+	RequestIdHeader       = "X-Request-Id"
+	FunctionIdHeader      = "X-Jambda-Function-Id"
+	FunctionVersionHeader = "X-Jambda-Function-Version"
+	InvocationIdHeader    = "X-Jambda-Invocation-Id"
+)
+
+// sensitiveRequestHeaders carry the client's credentials, including the api key used for rate limits
+var sensitiveRequestHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "X-Api-Key"}
+
+// sensitiveResponseHeaders reveal what the function is running on
+var sensitiveResponseHeaders = []string{"Server", "X-Powered-By"}
+
+// Invocation is a single request to a function, described to it by the injected headers
+type Invocation struct {
+	FunctionId   string
+	Version      string
+	InvocationId string
+}
+
+// TransformRequestHeaders applies the function's header policy to a request being proxied to it, the config may be nil
+func TransformRequestHeaders(header http.Header, config *data.TransformConfig, invocation Invocation) {
+	if config == nil {
+		return
+	}
+	if config.StripSensitiveHeaders {
+		for _, name := range sensitiveRequestHeaders {
+			header.Del(name)
+		}
+	}
+	applyHeaderRules(header, config.Request)
+
+	// Injected last, so clients can't pass their own
+	if config.InjectHeaders {
+		header.Set(FunctionIdHeader, invocation.FunctionId)
+		header.Set(InvocationIdHeader, invocation.InvocationId)
+		header.Del(FunctionVersionHeader)
+		if invocation.Version != "" {
+			header.Set(FunctionVersionHeader, invocation.Version)
+		}
+	}
+}
+
+// TransformResponseHeaders applies the function's header policy to its response, the config may be nil
+func TransformResponseHeaders(header http.Header, config *data.TransformConfig) {
+	if config == nil {
+		return
+	}
+	if config.StripSensitiveHeaders {
+		for _, name := range sensitiveResponseHeaders {
+			header.Del(name)
+		}
+	}
+	applyHeaderRules(header, config.Response)
+}
+
+// RewritePath replaces the prefix of the path with the first path rewrite matching it, matching whole path segments
+func RewritePath(path string, rewrites []data.PathRewrite) string {
+	for _, rewrite := range rewrites {
+		if !matchesPrefix(path, rewrite.From) {
+			continue
+		}
+		rest := path
+		if rewrite.From != "/" {
+			rest = strings.TrimPrefix(path, rewrite.From)
+		}
+		rewritten := strings.TrimSuffix(rewrite.To, "/") + rest
+		if !strings.HasPrefix(rewritten, "/") {
+			rewritten = "/" + rewritten
+		}
+		return rewritten
+	}
+	return path
+}
+
+func applyHeaderRules(header http.Header, rules data.HeaderRules) {
+	// Renamed in order, so the result doesn't depend on map iteration
+	names := make([]string, 0, len(rules.Rename))
+	for from := range rules.Rename {
+		names = append(names, from)
+	}
+	sort.Strings(names)
+	for _, from := range names {
+		values := header.Values(from)
+		if len(values) == 0 {
+			continue
+		}
+		values = append([]string(nil), values...)
+		header.Del(from)
+		to := rules.Rename[from]
+		header.Del(to)
+		for _, value := range values {
+			header.Add(to, value)
+		}
+	}
+
+	for _, name := range rules.Remove {
+		header.Del(name)
+	}
+	for name, value := range rules.Add {
+		header.Set(name, value)
+	}
+}
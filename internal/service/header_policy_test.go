@@ -0,0 +1,76 @@
+package service
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/jwtly10/jambda/api/data"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransformRequestHeaders(t *testing.T) {
+	config := &data.TransformConfig{
+		Request: data.HeaderRules{
+			Rename: map[string]string{"X-Api-Key": "X-Client-Key"},
+			Remove: []string{"X-Forwarded-For"},
+			Add:    map[string]string{"X-Env": "prod"},
+		},
+		InjectHeaders: true,
+	}
+	header := http.Header{
+		"X-Api-Key":        {"secret"},
+		"X-Forwarded-For":  {"10.0.0.1"},
+		"X-Env":            {"dev"},
+		InvocationIdHeader: {"spoofed"},
+	}
+
+	TransformRequestHeaders(header, config, Invocation{FunctionId: "fn", InvocationId: "inv-1"})
+
+	assert.Equal(t, http.Header{
+		"X-Client-Key":     {"secret"},
+		"X-Env":            {"prod"},
+		FunctionIdHeader:   {"fn"},
+		InvocationIdHeader: {"inv-1"},
+	}, header)
+}
+
+func TestTransformStripsSensitiveHeaders(t *testing.T) {
+	config := &data.TransformConfig{StripSensitiveHeaders: true}
+
+	request := http.Header{"Authorization": {"Bearer abc"}, "Cookie": {"session=1"}, "Accept": {"*/*"}}
+	TransformRequestHeaders(request, config, Invocation{})
+	assert.Equal(t, http.Header{"Accept": {"*/*"}}, request)
+
+	response := http.Header{"Server": {"gunicorn"}, "X-Powered-By": {"Express"}, "Content-Type": {"text/plain"}}
+	TransformResponseHeaders(response, config)
+	assert.Equal(t, http.Header{"Content-Type": {"text/plain"}}, response)
+
+	// Without a policy nothing changes
+	unchanged := http.Header{"Authorization": {"Bearer abc"}}
+	TransformRequestHeaders(unchanged, nil, Invocation{})
+	assert.Equal(t, http.Header{"Authorization": {"Bearer abc"}}, unchanged)
+}
+
+func TestRewritePath(t *testing.T) {
+	rewrites := []data.PathRewrite{
+		{From: "/v1", To: "/api/v1"},
+		{From: "/old", To: "/"},
+		{From: "/", To: "/app"},
+	}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/v1/users", "/api/v1/users"},
+		{"/v1", "/api/v1"},
+		{"/old/page", "/page"},
+		{"/old", "/"},
+		{"/v10", "/app/v10"},
+		{"/", "/app/"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, RewritePath(tt.path, rewrites), tt.path)
+	}
+	assert.Equal(t, "/v1/users", RewritePath("/v1/users", nil))
+}
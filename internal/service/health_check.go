@@ -0,0 +1,171 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jwtly10/jambda/api/data"
+	"github.com/jwtly10/jambda/internal/errors"
+	"github.com/jwtly10/jambda/internal/logging"
+)
+
+const (
+	defaultHealthCheckPath       = "/health"
+	defaultHealthCheckStatus     = http.StatusOK
+	defaultHealthCheckInterval   = 2 * time.Second
+	defaultHealthCheckTimeout    = 2 * time.Second
+	defaultHealthCheckMaxStartup = 30 * time.Second
+	defaultLivenessInterval      = 30 * time.Second
+	defaultLivenessThreshold     = 3
+
+	// initialProbeBackoff is the delay after the first failed startup probe, doubling on each failure
+	initialProbeBackoff = 5 * time.Millisecond
+)
+
+// healthCheckSettings is a HealthCheckConfig with defaults applied
+type healthCheckSettings struct {
+	path             string
+	expectedStatus   int
+	tcpOnly          bool
+	initialDelay     time.Duration
+	interval         time.Duration
+	timeout          time.Duration
+	maxStartupTime   time.Duration
+	livenessInterval time.Duration
+	failureThreshold int
+}
+
+func newHealthCheckSettings(config data.FunctionConfig) healthCheckSettings {
+	settings := healthCheckSettings{
+		path:             defaultHealthCheckPath,
+		expectedStatus:   defaultHealthCheckStatus,
+		interval:         defaultHealthCheckInterval,
+		timeout:          defaultHealthCheckTimeout,
+		maxStartupTime:   defaultHealthCheckMaxStartup,
+		livenessInterval: defaultLivenessInterval,
+		failureThreshold: defaultLivenessThreshold,
+	}
+
+	hc := config.HealthCheck
+	if hc == nil {
+		return settings
+	}
+	if hc.Path != "" {
+		settings.path = hc.Path
+	}
+	if hc.ExpectedStatus != 0 {
+		settings.expectedStatus = hc.ExpectedStatus
+	}
+	settings.tcpOnly = hc.TCPOnly
+	settings.initialDelay = hc.InitialDelay.Std()
+	if hc.Interval > 0 {
+		settings.interval = hc.Interval.Std()
+	}
+	if hc.Timeout > 0 {
+		settings.timeout = hc.Timeout.Std()
+	}
+	if hc.MaxStartupTime > 0 {
+		settings.maxStartupTime = hc.MaxStartupTime.Std()
+	}
+	if hc.LivenessInterval > 0 {
+		settings.livenessInterval = hc.LivenessInterval.Std()
+	}
+	if hc.FailureThreshold > 0 {
+		settings.failureThreshold = hc.FailureThreshold
+	}
+	return settings
+}
+
+// probe runs a single health check against an instance base url, e.g http://localhost:32768
+func (hc healthCheckSettings) probe(ctx context.Context, baseUrl string) error {
+	ctx, cancel := context.WithTimeout(ctx, hc.timeout)
+	defer cancel()
+
+	if hc.tcpOnly {
+		parsed, err := url.Parse(baseUrl)
+		if err != nil {
+			return fmt.Errorf("invalid instance url '%s': %v", baseUrl, err)
+		}
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", parsed.Host)
+		if err != nil {
+			return fmt.Errorf("tcp health check failed: %v", err)
+		}
+		return conn.Close()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(baseUrl, "/")+hc.path, nil)
+	if err != nil {
+		return fmt.Errorf("error building health check request: %v", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("health check request failed: %v", err)
+	}
+	// Drain the body so the connection can be reused
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode != hc.expectedStatus {
+		return fmt.Errorf("health check returned status %d, expected %d", resp.StatusCode, hc.expectedStatus)
+	}
+	return nil
+}
+
+// waitUntilHealthy probes a started instance until it passes its health check,
+// retrying until the function's max startup time has passed or the context is done
+func waitUntilHealthy(ctx context.Context, log logging.Logger, instanceId string, url string, config data.FunctionConfig) error {
+	hc := newHealthCheckSettings(config)
+	ctx, cancel := context.WithTimeout(ctx, hc.initialDelay+hc.maxStartupTime)
+	defer cancel()
+
+	if err := sleepContext(ctx, hc.initialDelay); err != nil {
+		return errors.NewDockerError(fmt.Sprintf("instance health check cancelled: %v", err))
+	}
+
+	// Probe quickly at first, most functions are ready within a few milliseconds of starting,
+	// backing off exponentially up to the configured interval for slower runtimes
+	delay := initialProbeBackoff
+	for {
+		err := hc.probe(ctx, url)
+		if err == nil {
+			return nil // Instance is ready
+		}
+
+		log.Debugf("Health check of instance '%s' failed, retrying in %s: %v", instanceId, delay, err)
+		if err := sleepContext(ctx, delay); err != nil {
+			return errors.NewDockerError(fmt.Sprintf("instance did not become ready within %s", hc.maxStartupTime))
+		}
+		delay = nextBackoff(delay, hc.interval)
+	}
+}
+
+// sleepContext waits for d, returning early with an error if the context is done first
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// nextBackoff doubles a retry delay, capped at max
+func nextBackoff(delay, max time.Duration) time.Duration {
+	delay *= 2
+	if delay > max {
+		return max
+	}
+	return delay
+}
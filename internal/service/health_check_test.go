@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jwtly10/jambda/api/data"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthCheckSettingsDefaults(t *testing.T) {
+	hc := newHealthCheckSettings(data.FunctionConfig{})
+	assert.Equal(t, "/health", hc.path)
+	assert.Equal(t, http.StatusOK, hc.expectedStatus)
+	assert.False(t, hc.tcpOnly)
+	assert.Equal(t, 30*time.Second, hc.maxStartupTime)
+
+	hc = newHealthCheckSettings(data.FunctionConfig{
+		HealthCheck: &data.HealthCheckConfig{
+			Path:           "/ready",
+			ExpectedStatus: http.StatusNoContent,
+			MaxStartupTime: data.Duration(2 * time.Minute),
+		},
+	})
+	assert.Equal(t, "/ready", hc.path)
+	assert.Equal(t, http.StatusNoContent, hc.expectedStatus)
+	assert.Equal(t, 2*time.Minute, hc.maxStartupTime)
+	assert.Equal(t, 2*time.Second, hc.interval)
+}
+
+func TestHealthCheckProbe(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/health":
+			w.WriteHeader(http.StatusOK)
+		case "/ready":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		config  *data.HealthCheckConfig
+		url     string
+		wantErr bool
+	}{
+		{
+			name:   "default health route",
+			config: nil,
+			url:    server.URL,
+		},
+		{
+			name:   "custom path and status",
+			config: &data.HealthCheckConfig{Path: "/ready", ExpectedStatus: http.StatusNoContent},
+			url:    server.URL,
+		},
+		{
+			name:    "unexpected status",
+			config:  &data.HealthCheckConfig{Path: "/missing"},
+			url:     server.URL,
+			wantErr: true,
+		},
+		{
+			name:   "tcp only ignores routes",
+			config: &data.HealthCheckConfig{Path: "/missing", TCPOnly: true},
+			url:    server.URL,
+		},
+		{
+			name:    "tcp only closed port",
+			config:  &data.HealthCheckConfig{TCPOnly: true},
+			url:     "http://" + closedAddr(t),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hc := newHealthCheckSettings(data.FunctionConfig{HealthCheck: tt.config})
+			err := hc.probe(context.Background(), tt.url)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+// closedAddr returns a local address with nothing listening on it
+func closedAddr(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := listener.Addr().String()
+	listener.Close()
+	return addr
+}
+
+func TestNextBackoff(t *testing.T) {
+	delay := initialProbeBackoff
+	var delays []time.Duration
+	for i := 0; i < 6; i++ {
+		delays = append(delays, delay)
+		delay = nextBackoff(delay, 100*time.Millisecond)
+	}
+
+	expected := []time.Duration{
+		5 * time.Millisecond,
+		10 * time.Millisecond,
+		20 * time.Millisecond,
+		40 * time.Millisecond,
+		80 * time.Millisecond,
+		100 * time.Millisecond,
+	}
+	assert.Equal(t, expected, delays)
+}
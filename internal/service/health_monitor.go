@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/jwtly10/jambda/internal/logging"
+)
+
+// healthMonitorTick is how often the monitor looks for instances due a liveness check
+const healthMonitorTick = time.Second
+
+type livenessState struct {
+	lastChecked time.Time
+	failures    int
+	checking    bool
+}
+
+// HealthMonitorService runs ongoing liveness checks against every warm instance,
+// restarting containers that fail too many checks in a row
+type HealthMonitorService struct {
+	log    logging.Logger
+	ps     *InstancePoolService
+	mu     sync.Mutex
+	states map[string]*livenessState
+}
+
+func NewHealthMonitorService(log logging.Logger, ps *InstancePoolService) *HealthMonitorService {
+	return &HealthMonitorService{
+		log:    log,
+		ps:     ps,
+		states: make(map[string]*livenessState),
+	}
+}
+
+// Run checks instances as their liveness interval passes, it never returns
+func (hm *HealthMonitorService) Run() {
+	ticker := time.NewTicker(healthMonitorTick)
+	defer ticker.Stop()
+	for range ticker.C {
+		hm.CheckInstances(time.Now())
+	}
+}
+
+// CheckInstances starts a liveness check for every instance that is due one
+func (hm *HealthMonitorService) CheckInstances(now time.Time) {
+	seen := make(map[string]bool)
+
+	for functionId, config := range hm.ps.GetPooledFunctions() {
+		hc := newHealthCheckSettings(config)
+		for _, inst := range hm.ps.GetInstances(functionId) {
+			seen[inst.ContainerId] = true
+
+			hm.mu.Lock()
+			state, exists := hm.states[inst.ContainerId]
+			if !exists {
+				// Instances have just passed their startup health check when they join the pool
+				state = &livenessState{lastChecked: inst.StartedAt}
+				hm.states[inst.ContainerId] = state
+			}
+			due := !state.checking && now.Sub(state.lastChecked) >= hc.livenessInterval
+			if due {
+				state.checking = true
+			}
+			hm.mu.Unlock()
+
+			if due {
+				go hm.check(functionId, inst, hc)
+			}
+		}
+	}
+
+	// Forget instances that are no longer in a pool
+	hm.mu.Lock()
+	for containerId, state := range hm.states {
+		if !seen[containerId] && !state.checking {
+			delete(hm.states, containerId)
+		}
+	}
+	hm.mu.Unlock()
+}
+
+// Recheck runs a liveness check of an instance now rather than waiting for its interval, e.g after a request to it failed.
+// Failures count towards restarting the instance as usual.
+func (hm *HealthMonitorService) Recheck(functionId string, containerId string) {
+	config, exists := hm.ps.GetPooledFunctions()[functionId]
+	if !exists {
+		return
+	}
+	for _, inst := range hm.ps.GetInstances(functionId) {
+		if inst.ContainerId != containerId {
+			continue
+		}
+
+		hm.mu.Lock()
+		state, exists := hm.states[containerId]
+		if !exists {
+			state = &livenessState{lastChecked: inst.StartedAt}
+			hm.states[containerId] = state
+		}
+		if state.checking {
+			hm.mu.Unlock()
+			return
+		}
+		state.checking = true
+		hm.mu.Unlock()
+
+		go hm.check(functionId, inst, newHealthCheckSettings(config))
+		return
+	}
+}
+
+func (hm *HealthMonitorService) check(functionId string, inst Instance, hc healthCheckSettings) {
+	err := hc.probe(context.Background(), inst.Url)
+
+	hm.mu.Lock()
+	state := hm.states[inst.ContainerId]
+	state.checking = false
+	state.lastChecked = time.Now()
+	if err == nil {
+		state.failures = 0
+		hm.mu.Unlock()
+		return
+	}
+	state.failures++
+	failures := state.failures
+	if failures >= hc.failureThreshold {
+		delete(hm.states, inst.ContainerId)
+	}
+	hm.mu.Unlock()
+
+	hm.log.Warn("Liveness check failed", "function", functionId, "container", inst.ContainerId, "failures", failures, "error", err)
+	if failures < hc.failureThreshold {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), hc.initialDelay+hc.maxStartupTime+10*time.Second)
+	defer cancel()
+	if err := hm.ps.RestartInstance(ctx, functionId, inst.ContainerId); err != nil {
+		hm.log.Errorf("Failed to restart unhealthy container '%s' for function '%s': %v", inst.ContainerId, functionId, err)
+	}
+}
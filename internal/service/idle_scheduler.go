@@ -0,0 +1,145 @@
+package service
+
+import (
+	"time"
+
+	"github.com/jwtly10/jambda/api/data"
+	"github.com/jwtly10/jambda/internal/logging"
+)
+
+// IdleScheduler stops the instances of functions that have gone without requests for longer than their idle timeout.
+// Rather than polling, it sleeps until the next function is due to become idle,
+// and is woken early whenever a new instance is started.
+type IdleScheduler struct {
+	log            logging.Logger
+	ps             *InstancePoolService
+	rs             *RequestStatsService
+	defaultTimeout time.Duration
+	wake           chan struct{}
+}
+
+func NewIdleScheduler(log logging.Logger, ps *InstancePoolService, rs *RequestStatsService, defaultTimeout time.Duration) *IdleScheduler {
+	return &IdleScheduler{
+		log:            log,
+		ps:             ps,
+		rs:             rs,
+		defaultTimeout: defaultTimeout,
+		wake:           make(chan struct{}, 1),
+	}
+}
+
+// Notify wakes the scheduler to recalculate the next idle deadline, it never blocks
+func (is *IdleScheduler) Notify(functionId string) {
+	select {
+	case is.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run stops idle functions as their deadlines pass, it never returns
+func (is *IdleScheduler) Run() {
+	for {
+		next, ok := is.StopIdleFunctions(time.Now())
+
+		var timer *time.Timer
+		var timerC <-chan time.Time
+		if ok {
+			is.log.Debugf("Next idle check in %s", time.Until(next))
+			timer = time.NewTimer(time.Until(next))
+			timerC = timer.C
+		}
+
+		select {
+		case <-timerC:
+		case <-is.wake:
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// StopIdleFunctions stops every warm function past its idle deadline,
+// and returns the earliest deadline of the functions left running, if any
+func (is *IdleScheduler) StopIdleFunctions(now time.Time) (time.Time, bool) {
+	stats := is.rs.GetFunctionStats()
+
+	var next time.Time
+	found := false
+	for functionId, config := range is.ps.GetPooledFunctions() {
+		timeout, ok := idleTimeout(config, is.defaultTimeout)
+		if !ok {
+			continue
+		}
+
+		// Instances warmed ahead of a spike are held like warm instances, until the hold expires and they can be stopped
+		warm := config.WarmInstances
+		if floor, until := is.ps.WarmFloor(functionId, now); floor > 0 {
+			warm = max(warm, floor)
+			if !found || until.Before(next) {
+				next = until
+				found = true
+			}
+		}
+
+		// Warm instances are never stopped, so there is nothing to do until the function scales above them.
+		// Instances still starting are not counted, they wake the scheduler once they join the pool.
+		instances := is.ps.GetInstances(functionId)
+		count := len(instances)
+		if warm > 0 && count <= warm {
+			continue
+		}
+
+		// Functions that have never been requested, e.g adopted containers, are idle from when they started
+		var lastActivity time.Time
+		for _, inst := range instances {
+			if inst.StartedAt.After(lastActivity) {
+				lastActivity = inst.StartedAt
+			}
+		}
+		if fs, exists := stats[functionId]; exists {
+			if fs.InFlight > 0 {
+				lastActivity = now
+			} else if fs.LastRequest.After(lastActivity) {
+				lastActivity = fs.LastRequest
+			}
+		}
+
+		deadline := lastActivity.Add(timeout)
+		if !deadline.After(now) {
+			is.log.Infof("Found idle function '%s', last activity: '%s', idle timeout: '%s'", functionId, lastActivity, timeout)
+			if warm > 0 {
+				is.ps.ScaleDown(functionId, count-warm)
+				continue
+			}
+			is.ps.StopFunction(functionId)
+			is.rs.ResetRequestCount(functionId, false)
+			continue
+		}
+
+		if !found || deadline.Before(next) {
+			next = deadline
+			found = true
+		}
+	}
+
+	return next, found
+}
+
+// idleTimeout returns the idle timeout of a function, and false if it should never be scaled to zero
+func idleTimeout(config data.FunctionConfig, defaultTimeout time.Duration) (time.Duration, bool) {
+	switch config.IdleTimeout {
+	case 0:
+		return defaultTimeout, defaultTimeout > 0
+	case data.Never:
+		return 0, false
+	}
+
+	timeout := config.IdleTimeout.Std()
+	if timeout < 0 {
+		// Configs are validated on save, so fall back to the default rather than never stopping
+		return defaultTimeout, defaultTimeout > 0
+	}
+	return timeout, true
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jwtly10/jambda/api/data"
+	"github.com/jwtly10/jambda/internal/logging"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestIdleTimeout(t *testing.T) {
+	tests := []struct {
+		name            string
+		config          data.FunctionConfig
+		defaultTimeout  time.Duration
+		expectedTimeout time.Duration
+		expectedOk      bool
+	}{
+		{
+			name:            "server default",
+			config:          data.FunctionConfig{},
+			defaultTimeout:  30 * time.Minute,
+			expectedTimeout: 30 * time.Minute,
+			expectedOk:      true,
+		},
+		{
+			name:            "function timeout",
+			config:          data.FunctionConfig{IdleTimeout: data.Duration(2 * time.Minute)},
+			defaultTimeout:  30 * time.Minute,
+			expectedTimeout: 2 * time.Minute,
+			expectedOk:      true,
+		},
+		{
+			name:           "never scale to zero",
+			config:         data.FunctionConfig{IdleTimeout: data.Never},
+			defaultTimeout: 30 * time.Minute,
+			expectedOk:     false,
+		},
+		{
+			name:           "server default disabled",
+			config:         data.FunctionConfig{},
+			defaultTimeout: 0,
+			expectedOk:     false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			timeout, ok := idleTimeout(tt.config, tt.defaultTimeout)
+			assert.Equal(t, tt.expectedOk, ok)
+			if tt.expectedOk {
+				assert.Equal(t, tt.expectedTimeout, timeout)
+			}
+		})
+	}
+}
+
+func TestStopIdleFunctionsReturnsNextDeadline(t *testing.T) {
+	logger := logging.NewLogger(false, zapcore.DebugLevel)
+	ps := NewInstancePoolService(logger, &DockerService{})
+	rs := NewRequestStatsService(logger)
+	scheduler := NewIdleScheduler(logger, ps, rs, 30*time.Minute)
+
+	now := time.Now()
+	ps.pools["short"] = &functionPool{
+		instances: []*Instance{{ContainerId: "c1", StartedAt: now.Add(-time.Minute)}},
+		config:    data.FunctionConfig{IdleTimeout: data.Duration(2 * time.Minute)},
+	}
+	ps.pools["warm"] = &functionPool{
+		instances: []*Instance{{ContainerId: "c2", StartedAt: now.Add(-time.Hour)}},
+		config:    data.FunctionConfig{IdleTimeout: data.Never},
+	}
+	ps.pools["default"] = &functionPool{
+		instances: []*Instance{{ContainerId: "c3", StartedAt: now.Add(-time.Hour)}},
+		config:    data.FunctionConfig{},
+	}
+	ps.pools["prewarmed"] = &functionPool{
+		instances: []*Instance{{ContainerId: "c4", StartedAt: now.Add(-time.Hour)}},
+		config:    data.FunctionConfig{IdleTimeout: data.Duration(time.Minute), WarmInstances: 1},
+	}
+	rs.IncrementRequestCount("default")
+
+	next, ok := scheduler.StopIdleFunctions(now)
+	assert.True(t, ok)
+	assert.Equal(t, now.Add(time.Minute), next)
+	assert.Len(t, ps.GetPooledFunctions(), 4)
+}
@@ -0,0 +1,784 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jwtly10/jambda/api/data"
+	"github.com/jwtly10/jambda/internal/errors"
+	"github.com/jwtly10/jambda/internal/logging"
+	"github.com/jwtly10/jambda/internal/tracing"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultMaxInstances      = 1
+	defaultConcurrencyTarget = 10
+
+	// coldStartTimeout bounds a cold start, independent of the requests waiting on it
+	coldStartTimeout = 2 * time.Minute
+
+	defaultQueueMaxSize = 100
+	defaultQueueMaxWait = 30 * time.Second
+)
+
+// Instance is a single running container serving requests for a function
+type Instance struct {
+	ContainerId string    `json:"container_id"`
+	Url         string    `json:"url"`
+	InFlight    int       `json:"in_flight"`
+	StartedAt   time.Time `json:"started_at"`
+}
+
+type functionPool struct {
+	instances []*Instance
+	// next is the round robin offset used to break ties between equally loaded instances
+	next int
+	// pending is the number of instances being started in the background
+	pending int
+	// config is the latest function config seen for the pool, used by the autoscaler
+	config data.FunctionConfig
+	// queue holds the requests waiting for an instance below max_concurrency, oldest first
+	queue []*queuedRequest
+	// warmFloor instances are kept running until warmUntil, as they were warmed ahead of a spike in traffic
+	warmFloor int
+	warmUntil time.Time
+}
+
+// queuedRequest is handed an instance once one has capacity, or closed if the function is stopped
+type queuedRequest struct {
+	ready chan *Instance
+}
+
+// InstancePoolService tracks the running instances of each function in memory,
+// and load balances requests between them
+type InstancePoolService struct {
+	log     logging.Logger
+	backend ExecutionBackend
+	mu      sync.Mutex
+	pools   map[string]*functionPool
+	// onInstanceAdded is called whenever a new instance joins a pool
+	onInstanceAdded func(functionId string)
+	// coldStarts are the cold starts currently in progress, keyed by function
+	coldStarts map[string]*coldStartCall
+	// startLocks serialise container creation per function, so concurrent starts never claim the same stopped container
+	startLocks map[string]*sync.Mutex
+}
+
+// coldStartCall is a single cold start shared by every request that arrives for the function while it runs
+type coldStartCall struct {
+	done chan struct{}
+	err  error
+}
+
+func NewInstancePoolService(log logging.Logger, backend ExecutionBackend) *InstancePoolService {
+	return &InstancePoolService{
+		log:        log,
+		backend:    backend,
+		pools:      make(map[string]*functionPool),
+		coldStarts: make(map[string]*coldStartCall),
+		startLocks: make(map[string]*sync.Mutex),
+	}
+}
+
+// OnInstanceAdded registers a callback run whenever a new instance joins a function's pool
+func (ps *InstancePoolService) OnInstanceAdded(fn func(functionId string)) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.onInstanceAdded = fn
+}
+
+// Acquire returns the least loaded instance of a function, cold starting one if none are running.
+// Concurrent requests for a cold function share a single cold start, each waiting at most until its context is done.
+// When every instance is at max_concurrency, the request waits in the function's queue.
+// Callers must Release the instance once the request has been served.
+func (ps *InstancePoolService) Acquire(ctx context.Context, functionId string, config data.FunctionConfig) (*Instance, error) {
+	ps.mu.Lock()
+	pool := ps.getPool(functionId)
+	pool.config = config
+	if len(pool.instances) == 0 {
+		call, inProgress := ps.coldStarts[functionId]
+		if !inProgress {
+			call = &coldStartCall{done: make(chan struct{})}
+			ps.coldStarts[functionId] = call
+			// The cold start outlives the request that triggered it, but stays part of its trace and keeps its invocation id,
+			// so slow responses can be traced back to it
+			startCtx := trace.ContextWithSpanContext(context.Background(), trace.SpanContextFromContext(ctx))
+			if invocationId, ok := ctx.Value("invocationId").(string); ok {
+				startCtx = context.WithValue(startCtx, "invocationId", invocationId)
+			}
+			go ps.runColdStart(startCtx, functionId, config, call)
+		} else {
+			ps.log.Infof("Waiting on cold start already in progress for function '%s'", functionId)
+			trace.SpanFromContext(ctx).AddEvent("waiting on cold start in progress")
+		}
+		ps.mu.Unlock()
+
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return nil, errors.NewDockerError(fmt.Sprintf("request ended while waiting for function '%s' to start: %v", functionId, ctx.Err()))
+		}
+		if call.err != nil {
+			return nil, call.err
+		}
+
+		// The pool may have been replaced while we were waiting, e.g if the function was stopped
+		ps.mu.Lock()
+		pool = ps.getPool(functionId)
+		if len(pool.instances) == 0 {
+			ps.mu.Unlock()
+			return nil, errors.NewDockerError(fmt.Sprintf("no instances available for function '%s'", functionId))
+		}
+	}
+
+	inst := selectInstance(pool)
+	if config.MaxConcurrency > 0 && (inst.InFlight >= config.MaxConcurrency || len(pool.queue) > 0) {
+		return ps.enqueue(ctx, functionId, pool, config)
+	}
+	inst.InFlight++
+	ps.mu.Unlock()
+
+	return inst, nil
+}
+
+// Release marks a request served by the instance as complete, handing the instance to the next queued request
+func (ps *InstancePoolService) Release(functionId string, inst *Instance) {
+	ps.mu.Lock()
+	if inst.InFlight > 0 {
+		inst.InFlight--
+	}
+	pool, exists := ps.pools[functionId]
+	if !exists || len(pool.queue) == 0 {
+		ps.mu.Unlock()
+		return
+	}
+	ps.dispatch(pool)
+	ps.mu.Unlock()
+}
+
+// GetQueueDepth returns the number of requests waiting for an instance of the function
+func (ps *InstancePoolService) GetQueueDepth(functionId string) int {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if pool, exists := ps.pools[functionId]; exists {
+		return len(pool.queue)
+	}
+	return 0
+}
+
+// enqueue waits in the function's queue until an instance has capacity, the queue's max wait passes, or the request ends.
+// It must be called with the lock held, and releases it.
+func (ps *InstancePoolService) enqueue(ctx context.Context, functionId string, pool *functionPool, config data.FunctionConfig) (*Instance, error) {
+	maxSize, maxWait := queueLimits(config)
+	if len(pool.queue) >= maxSize {
+		ps.mu.Unlock()
+		return nil, errors.NewUnavailableError(fmt.Sprintf("function '%s' is at max_concurrency and its queue of %d requests is full", functionId, maxSize))
+	}
+
+	req := &queuedRequest{ready: make(chan *Instance, 1)}
+	pool.queue = append(pool.queue, req)
+	ps.mu.Unlock()
+
+	timer := time.NewTimer(maxWait)
+	defer timer.Stop()
+
+	var err error
+	select {
+	case inst, ok := <-req.ready:
+		if !ok {
+			return nil, errors.NewUnavailableError(fmt.Sprintf("function '%s' was stopped while the request was queued", functionId))
+		}
+		return inst, nil
+	case <-timer.C:
+		err = errors.NewUnavailableError(fmt.Sprintf("function '%s' had no capacity within the queue's max_wait of %s", functionId, maxWait))
+	case <-ctx.Done():
+		err = errors.NewDockerError(fmt.Sprintf("request ended while queued for function '%s': %v", functionId, ctx.Err()))
+	}
+
+	ps.mu.Lock()
+	for i, queued := range pool.queue {
+		if queued == req {
+			pool.queue = append(pool.queue[:i], pool.queue[i+1:]...)
+			ps.mu.Unlock()
+			return nil, err
+		}
+	}
+	// An instance was handed over as we gave up, so pass it on to the next request
+	if inst, ok := <-req.ready; ok && inst.InFlight > 0 {
+		inst.InFlight--
+		ps.dispatch(pool)
+	}
+	ps.mu.Unlock()
+	return nil, err
+}
+
+// dispatch hands instances with capacity to queued requests, oldest first. It must be called with the lock held.
+func (ps *InstancePoolService) dispatch(pool *functionPool) {
+	for len(pool.queue) > 0 && len(pool.instances) > 0 {
+		inst := selectInstance(pool)
+		if limit := pool.config.MaxConcurrency; limit > 0 && inst.InFlight >= limit {
+			return
+		}
+		inst.InFlight++
+		pool.queue[0].ready <- inst
+		pool.queue = pool.queue[1:]
+	}
+}
+
+// GetInstances returns a copy of the instances currently tracked for a function
+func (ps *InstancePoolService) GetInstances(functionId string) []Instance {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	pool, exists := ps.pools[functionId]
+	if !exists {
+		return []Instance{}
+	}
+	instances := make([]Instance, 0, len(pool.instances))
+	for _, inst := range pool.instances {
+		instances = append(instances, *inst)
+	}
+	return instances
+}
+
+// GetPooledFunctions returns the config of every function with at least one instance tracked in the pool
+func (ps *InstancePoolService) GetPooledFunctions() map[string]data.FunctionConfig {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	functions := make(map[string]data.FunctionConfig)
+	for functionId, pool := range ps.pools {
+		if len(pool.instances) > 0 {
+			functions[functionId] = pool.config
+		}
+	}
+	return functions
+}
+
+// GetInstanceCount returns the number of running and pending instances for a function
+func (ps *InstancePoolService) GetInstanceCount(functionId string) int {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	pool, exists := ps.pools[functionId]
+	if !exists {
+		return 0
+	}
+	return len(pool.instances) + pool.pending
+}
+
+// ScaleUp starts count more instances for the function in the background
+func (ps *InstancePoolService) ScaleUp(functionId string, count int) {
+	ps.mu.Lock()
+	pool := ps.getPool(functionId)
+	pool.pending += count
+	config := pool.config
+	ps.mu.Unlock()
+
+	for i := 0; i < count; i++ {
+		go ps.scaleUp(functionId, config)
+	}
+}
+
+// ScaleDown removes up to count idle instances from the pool and stops their containers.
+// Instances still serving requests are never removed, so fewer instances may be stopped than requested.
+func (ps *InstancePoolService) ScaleDown(functionId string, count int) int {
+	ps.mu.Lock()
+	pool, exists := ps.pools[functionId]
+	if !exists {
+		ps.mu.Unlock()
+		return 0
+	}
+
+	// Remove the most recently started idle instances first
+	var removed []*Instance
+	for i := len(pool.instances) - 1; i >= 0 && len(removed) < count; i-- {
+		if pool.instances[i].InFlight == 0 {
+			removed = append(removed, pool.instances[i])
+			pool.instances = append(pool.instances[:i], pool.instances[i+1:]...)
+		}
+	}
+	if len(pool.instances) > 0 {
+		pool.next = pool.next % len(pool.instances)
+	}
+	ps.mu.Unlock()
+
+	for _, inst := range removed {
+		ps.log.Infof("Scaling down function '%s', stopping container '%s'", functionId, inst.ContainerId)
+		go ps.backend.Stop(inst.ContainerId)
+	}
+	return len(removed)
+}
+
+// RestartInstance takes an unhealthy instance out of the pool, restarts its container,
+// and adds it back once it passes its health check again
+func (ps *InstancePoolService) RestartInstance(ctx context.Context, functionId string, containerId string) error {
+	config, removed := ps.removeInstance(functionId, containerId)
+	if !removed {
+		// The instance has already left the pool, e.g scaled down
+		return nil
+	}
+
+	ps.log.Infof("Restarting unhealthy container '%s' for function '%s'", containerId, functionId)
+	if err := ps.backend.Restart(ctx, containerId); err != nil {
+		return err
+	}
+
+	inst, err := ps.readyInstance(ctx, containerId, config)
+	if err != nil {
+		// Don't leave a broken container running outside of the pool
+		ps.backend.Stop(containerId)
+		return err
+	}
+	ps.addInstance(functionId, inst)
+	return nil
+}
+
+// RecreateInstances replaces containers of the function with new ones in the background, e.g when requests to them keep failing
+func (ps *InstancePoolService) RecreateInstances(functionId string, containerIds []string) {
+	for _, containerId := range containerIds {
+		go ps.recreateInstance(functionId, containerId)
+	}
+}
+
+func (ps *InstancePoolService) recreateInstance(functionId string, containerId string) {
+	config, removed := ps.removeInstance(functionId, containerId)
+	if !removed {
+		return
+	}
+
+	ps.log.Infof("Recreating container '%s' for function '%s'", containerId, functionId)
+	if err := ps.backend.Stop(containerId); err != nil {
+		ps.log.Errorf("Failed to stop container '%s' for function '%s': %v", containerId, functionId, err)
+	}
+
+	hc := newHealthCheckSettings(config)
+	ctx, cancel := context.WithTimeout(context.Background(), hc.initialDelay+hc.maxStartupTime+10*time.Second)
+	defer cancel()
+	inst, err := ps.startInstance(ctx, functionId, config)
+	if err != nil {
+		ps.log.Errorf("Failed to recreate container '%s' for function '%s': %v", containerId, functionId, err)
+		return
+	}
+	ps.addInstance(functionId, inst)
+}
+
+// removeInstance takes an instance out of the pool, returning the function's config and whether it was still in the pool
+func (ps *InstancePoolService) removeInstance(functionId string, containerId string) (data.FunctionConfig, bool) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	pool, exists := ps.pools[functionId]
+	if !exists {
+		return data.FunctionConfig{}, false
+	}
+	removed := false
+	for i, inst := range pool.instances {
+		if inst.ContainerId == containerId {
+			pool.instances = append(pool.instances[:i], pool.instances[i+1:]...)
+			removed = true
+			break
+		}
+	}
+	if len(pool.instances) > 0 {
+		pool.next = pool.next % len(pool.instances)
+	}
+	return pool.config, removed
+}
+
+// RemoveContainer drops an instance whose container exited or was removed at the given time, without touching the container.
+// Instances that became ready after the exit, e.g a restarted container, are kept.
+func (ps *InstancePoolService) RemoveContainer(functionId string, containerId string, at time.Time) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	pool, exists := ps.pools[functionId]
+	if !exists {
+		return
+	}
+	for i, inst := range pool.instances {
+		if inst.ContainerId == containerId && !inst.StartedAt.After(at) {
+			ps.log.Infof("Container '%s' of function '%s' exited, removing it from the pool", containerId, functionId)
+			pool.instances = append(pool.instances[:i], pool.instances[i+1:]...)
+			break
+		}
+	}
+	if len(pool.instances) > 0 {
+		pool.next = pool.next % len(pool.instances)
+	}
+}
+
+// StopFunction stops every container of the function and empties its pool, failing any queued requests
+func (ps *InstancePoolService) StopFunction(functionId string) {
+	ps.mu.Lock()
+	if pool, exists := ps.pools[functionId]; exists {
+		for _, queued := range pool.queue {
+			close(queued.ready)
+		}
+		pool.queue = nil
+	}
+	delete(ps.pools, functionId)
+	ps.mu.Unlock()
+
+	ps.backend.StopFunction(functionId)
+}
+
+// InvocationEnvVar is set on process and VM instances started by a cold start, to the id of the invocation that triggered it.
+// Containers are reused across cold starts, so their start is logged with the invocation id instead.
+const InvocationEnvVar = "JAMBDA_INVOCATION_ID"
+
+// withInvocationEnv returns the env vars with the invocation id of the context added, leaving the given map unchanged
+func withInvocationEnv(ctx context.Context, envVars map[string]string) map[string]string {
+	invocationId, ok := ctx.Value("invocationId").(string)
+	if !ok || invocationId == "" {
+		return envVars
+	}
+	env := make(map[string]string, len(envVars)+1)
+	for key, value := range envVars {
+		env[key] = value
+	}
+	env[InvocationEnvVar] = invocationId
+	return env
+}
+
+// withoutInvocationEnv returns the env vars without an invocation id, for instances restarted outside a cold start
+func withoutInvocationEnv(envVars map[string]string) map[string]string {
+	if _, ok := envVars[InvocationEnvVar]; !ok {
+		return envVars
+	}
+	env := make(map[string]string, len(envVars))
+	for key, value := range envVars {
+		if key != InvocationEnvVar {
+			env[key] = value
+		}
+	}
+	return env
+}
+
+// runColdStart runs a cold start on behalf of all the requests waiting on the call,
+// so a single cancelled request can't abort the start for everyone else. The context is only used for its values.
+func (ps *InstancePoolService) runColdStart(ctx context.Context, functionId string, config data.FunctionConfig, call *coldStartCall) {
+	ctx, cancel := context.WithTimeout(ctx, coldStartTimeout)
+	defer cancel()
+
+	ctx, span := tracing.Tracer().Start(ctx, "function.cold_start", trace.WithAttributes(tracing.FunctionIdKey.String(functionId)))
+	if invocationId, ok := ctx.Value("invocationId").(string); ok {
+		ps.log.Infof("Cold starting function '%s' for invocation '%s'", functionId, invocationId)
+		span.SetAttributes(tracing.InvocationIdKey.String(invocationId))
+	}
+
+	err := ps.coldStart(ctx, functionId, config)
+	tracing.End(span, err)
+
+	ps.mu.Lock()
+	delete(ps.coldStarts, functionId)
+	ps.mu.Unlock()
+
+	call.err = err
+	close(call.done)
+}
+
+// coldStart adopts any containers already running for the function, or starts new instances.
+// The first instance is started synchronously, any further instances needed to reach min_instances
+// are started in the background.
+func (ps *InstancePoolService) coldStart(ctx context.Context, functionId string, config data.FunctionConfig) error {
+	adopted, err := ps.adoptRunning(ctx, functionId, config)
+	if err != nil {
+		return err
+	}
+
+	if adopted == 0 {
+		inst, err := ps.startInstance(ctx, functionId, config)
+		if err != nil {
+			return err
+		}
+		ps.addInstance(functionId, inst)
+	}
+
+	if missing := minInstances(config) - ps.GetInstanceCount(functionId); missing > 0 {
+		ps.ScaleUp(functionId, missing)
+	}
+
+	return nil
+}
+
+// HoldWarm keeps at least count instances of the function running until the given time,
+// so instances warmed ahead of a spike aren't scaled down or stopped as idle before it arrives
+func (ps *InstancePoolService) HoldWarm(functionId string, count int, until time.Time) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	pool := ps.getPool(functionId)
+	pool.warmFloor = count
+	pool.warmUntil = until
+}
+
+// WarmFloor returns the instances of the function held warm by HoldWarm, and until when, or 0 once the hold has expired
+func (ps *InstancePoolService) WarmFloor(functionId string, now time.Time) (int, time.Time) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	pool, exists := ps.pools[functionId]
+	if !exists || !now.Before(pool.warmUntil) {
+		return 0, time.Time{}
+	}
+	return pool.warmFloor, pool.warmUntil
+}
+
+// Warm makes sure at least count instances of the function are running,
+// starting any missing instances concurrently and waiting for them to become ready
+func (ps *InstancePoolService) Warm(ctx context.Context, functionId string, config data.FunctionConfig, count int) error {
+	ps.mu.Lock()
+	pool := ps.getPool(functionId)
+	pool.config = config
+	empty := len(pool.instances) == 0 && pool.pending == 0
+	ps.mu.Unlock()
+
+	if empty {
+		// Containers may still be running from before jambda was restarted
+		if _, err := ps.adoptRunning(ctx, functionId, config); err != nil {
+			return err
+		}
+	}
+
+	ps.mu.Lock()
+	missing := count - len(pool.instances) - pool.pending
+	if missing <= 0 {
+		ps.mu.Unlock()
+		return nil
+	}
+	pool.pending += missing
+	ps.mu.Unlock()
+
+	ps.log.Infof("Warming %d instances of function '%s'", missing, functionId)
+	var wg sync.WaitGroup
+	errs := make(chan error, missing)
+	for i := 0; i < missing; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			inst, err := ps.startInstance(ctx, functionId, config)
+
+			ps.mu.Lock()
+			if pool := ps.getPool(functionId); pool.pending > 0 {
+				pool.pending--
+			}
+			ps.mu.Unlock()
+
+			if err != nil {
+				errs <- err
+				return
+			}
+			ps.addInstance(functionId, inst)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	if err, failed := <-errs; failed {
+		ps.log.Errorf("Failed to warm all instances of function '%s': %v", functionId, err)
+		return err
+	}
+	return nil
+}
+
+// Adopt adds any running containers of the function the pool isn't tracking yet, returning how many were adopted
+func (ps *InstancePoolService) Adopt(ctx context.Context, functionId string, config data.FunctionConfig) (int, error) {
+	ps.mu.Lock()
+	ps.getPool(functionId).config = config
+	ps.mu.Unlock()
+
+	return ps.adoptRunning(ctx, functionId, config)
+}
+
+// adoptRunning adds any containers already running for the function to its pool, returning how many were adopted
+func (ps *InstancePoolService) adoptRunning(ctx context.Context, functionId string, config data.FunctionConfig) (int, error) {
+	running, err := ps.backend.ListRunning(ctx, functionId)
+	if err != nil {
+		return 0, err
+	}
+
+	adopted := 0
+	for _, containerId := range running {
+		inst, err := ps.readyInstance(ctx, containerId, config)
+		if err != nil {
+			ps.log.Errorf("Unable to adopt running container '%s' for function '%s': %v", containerId, functionId, err)
+			continue
+		}
+		ps.addInstance(functionId, inst)
+		adopted++
+	}
+	return adopted, nil
+}
+
+// scaleUp starts one more instance for the function in the background
+func (ps *InstancePoolService) scaleUp(functionId string, config data.FunctionConfig) {
+	ps.log.Infof("Scaling up function '%s'", functionId)
+	inst, err := ps.startInstance(context.Background(), functionId, config)
+
+	ps.mu.Lock()
+	pool := ps.getPool(functionId)
+	if pool.pending > 0 {
+		pool.pending--
+	}
+	ps.mu.Unlock()
+	if err != nil {
+		ps.log.Errorf("Failed to scale up function '%s': %v", functionId, err)
+		return
+	}
+
+	ps.addInstance(functionId, inst)
+	ps.log.Infof("Function '%s' now has %d instances", functionId, ps.GetInstanceCount(functionId))
+}
+
+// startInstance starts a container and waits for it to become ready to serve requests
+func (ps *InstancePoolService) startInstance(ctx context.Context, functionId string, config data.FunctionConfig) (*Instance, error) {
+	ps.mu.Lock()
+	startLock, exists := ps.startLocks[functionId]
+	if !exists {
+		startLock = &sync.Mutex{}
+		ps.startLocks[functionId] = startLock
+	}
+	ps.mu.Unlock()
+
+	spanCtx, span := tracing.Tracer().Start(ctx, "container.start", trace.WithAttributes(tracing.FunctionIdKey.String(functionId)))
+	startLock.Lock()
+	containerId, err := ps.backend.StartInstance(spanCtx, functionId, config)
+	startLock.Unlock()
+	span.SetAttributes(tracing.ContainerIdKey.String(containerId))
+	tracing.End(span, err)
+	if err != nil {
+		ps.log.Errorf("Error starting container: %v", err)
+		return nil, err
+	}
+	if invocationId, ok := ctx.Value("invocationId").(string); ok {
+		ps.log.Infof("Started container '%s' of function '%s' for invocation '%s'", containerId, functionId, invocationId)
+	}
+
+	return ps.readyInstance(ctx, containerId, config)
+}
+
+func (ps *InstancePoolService) readyInstance(ctx context.Context, containerId string, config data.FunctionConfig) (*Instance, error) {
+	// Wait for the backend to report the instance as running, so its endpoint is assigned
+	attrs := trace.WithAttributes(tracing.ContainerIdKey.String(containerId))
+	spanCtx, span := tracing.Tracer().Start(ctx, "container.wait_running", attrs)
+	err := ps.backend.WaitForRunning(spanCtx, containerId)
+	tracing.End(span, err)
+	if err != nil {
+		ps.log.Errorf("Container '%s' did not start: %v", containerId, err)
+		return nil, err
+	}
+
+	spanCtx, span = tracing.Tracer().Start(ctx, "container.get_url", attrs)
+	containerUrl, err := ps.backend.GetEndpoint(spanCtx, containerId, config)
+	tracing.End(span, err)
+	if err != nil {
+		// We didn't get the container URL!
+		ps.log.Errorf("Error getting container URL : %v", err)
+		return nil, errors.NewInternalError(fmt.Sprintf("unable to get container url: %v", err))
+	}
+
+	// Otherwise we can continue with the health check
+	// This waits for the underlying function to be ready, up to its max startup time,
+	// as rest platforms like springboot can take a few seconds to initialise.
+	ps.log.Infof("Running health check!!")
+	spanCtx, span = tracing.Tracer().Start(ctx, "container.health_check", attrs)
+	err = ps.backend.HealthCheck(spanCtx, containerId, config)
+	tracing.End(span, err)
+	if err != nil {
+		ps.log.Errorf("Health check failed %v", err)
+		return nil, err
+	}
+
+	ps.log.Infof("Determined container '%s' url : '%s'", containerId, containerUrl)
+	return &Instance{
+		ContainerId: containerId,
+		Url:         containerUrl,
+		StartedAt:   time.Now(),
+	}, nil
+}
+
+func (ps *InstancePoolService) addInstance(functionId string, inst *Instance) {
+	ps.mu.Lock()
+	pool := ps.getPool(functionId)
+	for _, existing := range pool.instances {
+		if existing.ContainerId == inst.ContainerId {
+			ps.mu.Unlock()
+			return
+		}
+	}
+	pool.instances = append(pool.instances, inst)
+	hook := ps.onInstanceAdded
+	ps.dispatch(pool)
+	ps.mu.Unlock()
+
+	if hook != nil {
+		hook(functionId)
+	}
+}
+
+// getPool must be called with the lock held
+func (ps *InstancePoolService) getPool(functionId string) *functionPool {
+	pool, exists := ps.pools[functionId]
+	if !exists {
+		pool = &functionPool{}
+		ps.pools[functionId] = pool
+	}
+	return pool
+}
+
+// selectInstance picks the instance with the fewest in flight requests,
+// rotating between instances with equal load. The pool must not be empty.
+func selectInstance(pool *functionPool) *Instance {
+	count := len(pool.instances)
+	var selected *Instance
+	for i := 0; i < count; i++ {
+		inst := pool.instances[(pool.next+i)%count]
+		if selected == nil || inst.InFlight < selected.InFlight {
+			selected = inst
+		}
+	}
+	pool.next = (pool.next + 1) % count
+	return selected
+}
+
+// minInstances is the floor of a warm function, covering both min_instances and warm_instances
+func minInstances(config data.FunctionConfig) int {
+	if config.WarmInstances > config.MinInstances {
+		return config.WarmInstances
+	}
+	return config.MinInstances
+}
+
+func maxInstances(config data.FunctionConfig) int {
+	if config.MaxInstances > 0 {
+		return config.MaxInstances
+	}
+	if minimum := minInstances(config); minimum > defaultMaxInstances {
+		return minimum
+	}
+	return defaultMaxInstances
+}
+
+// concurrencyTarget never exceeds max_concurrency, so functions scale up before requests are queued
+func concurrencyTarget(config data.FunctionConfig) int {
+	target := defaultConcurrencyTarget
+	if config.ConcurrencyTarget > 0 {
+		target = config.ConcurrencyTarget
+	}
+	if config.MaxConcurrency > 0 && target > config.MaxConcurrency {
+		return config.MaxConcurrency
+	}
+	return target
+}
+
+func queueLimits(config data.FunctionConfig) (int, time.Duration) {
+	maxSize, maxWait := defaultQueueMaxSize, defaultQueueMaxWait
+	if q := config.Queue; q != nil {
+		if q.MaxSize > 0 {
+			maxSize = q.MaxSize
+		}
+		if q.MaxWait > 0 {
+			maxWait = q.MaxWait.Std()
+		}
+	}
+	return maxSize, maxWait
+}
@@ -0,0 +1,217 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jwtly10/jambda/api/data"
+	"github.com/jwtly10/jambda/internal/errors"
+	"github.com/jwtly10/jambda/internal/logging"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestSelectInstance(t *testing.T) {
+	tests := []struct {
+		name       string
+		inFlight   []int
+		next       int
+		expectedId string
+	}{
+		{
+			name:       "single instance",
+			inFlight:   []int{3},
+			expectedId: "c0",
+		},
+		{
+			name:       "least connections wins",
+			inFlight:   []int{4, 1, 2},
+			expectedId: "c1",
+		},
+		{
+			name:       "ties broken by round robin offset",
+			inFlight:   []int{1, 1, 1},
+			next:       2,
+			expectedId: "c2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool := &functionPool{next: tt.next}
+			for i, inFlight := range tt.inFlight {
+				pool.instances = append(pool.instances, &Instance{
+					ContainerId: "c" + string(rune('0'+i)),
+					InFlight:    inFlight,
+				})
+			}
+
+			inst := selectInstance(pool)
+			assert.Equal(t, tt.expectedId, inst.ContainerId)
+			assert.Equal(t, (tt.next+1)%len(tt.inFlight), pool.next)
+		})
+	}
+}
+
+func TestInstanceLimits(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      data.FunctionConfig
+		expectedMin int
+		expectedMax int
+	}{
+		{
+			name:        "defaults",
+			config:      data.FunctionConfig{},
+			expectedMin: 0,
+			expectedMax: 1,
+		},
+		{
+			name:        "min instances raise the default max",
+			config:      data.FunctionConfig{MinInstances: 3},
+			expectedMin: 3,
+			expectedMax: 3,
+		},
+		{
+			name:        "warm instances count towards the floor",
+			config:      data.FunctionConfig{MinInstances: 1, WarmInstances: 2, MaxInstances: 4},
+			expectedMin: 2,
+			expectedMax: 4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expectedMin, minInstances(tt.config))
+			assert.Equal(t, tt.expectedMax, maxInstances(tt.config))
+		})
+	}
+}
+
+func TestAcquireWaitsOnColdStartInProgress(t *testing.T) {
+	logger := logging.NewLogger(false, zapcore.DebugLevel)
+	ps := NewInstancePoolService(logger, &DockerService{})
+
+	// Simulate a cold start already running for the function
+	call := &coldStartCall{done: make(chan struct{})}
+	ps.coldStarts["abc"] = call
+
+	// A waiting request gives up when its context is done, without starting another container
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := ps.Acquire(ctx, "abc", data.FunctionConfig{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "request ended while waiting for function 'abc' to start")
+	assert.Same(t, call, ps.coldStarts["abc"])
+
+	// Once the cold start completes, waiting requests share the started instance
+	result := make(chan *Instance)
+	go func() {
+		inst, err := ps.Acquire(context.Background(), "abc", data.FunctionConfig{})
+		assert.NoError(t, err)
+		result <- inst
+	}()
+
+	ps.addInstance("abc", &Instance{ContainerId: "c1"})
+	ps.mu.Lock()
+	delete(ps.coldStarts, "abc")
+	ps.mu.Unlock()
+	close(call.done)
+
+	inst := <-result
+	assert.Equal(t, "c1", inst.ContainerId)
+	assert.Equal(t, 1, inst.InFlight)
+}
+
+func TestAcquireReturnsColdStartError(t *testing.T) {
+	logger := logging.NewLogger(false, zapcore.DebugLevel)
+	ps := NewInstancePoolService(logger, &DockerService{})
+
+	call := &coldStartCall{done: make(chan struct{}), err: errors.NewDockerError("failed to create container")}
+	close(call.done)
+	ps.coldStarts["abc"] = call
+
+	_, err := ps.Acquire(context.Background(), "abc", data.FunctionConfig{})
+	assert.EqualError(t, err, "failed to create container")
+}
+
+func TestAcquireQueuesAtMaxConcurrency(t *testing.T) {
+	logger := logging.NewLogger(false, zapcore.DebugLevel)
+	ps := NewInstancePoolService(logger, &DockerService{})
+	config := data.FunctionConfig{MaxConcurrency: 1, Queue: &data.QueueConfig{MaxSize: 1, MaxWait: data.Duration(50 * time.Millisecond)}}
+
+	ps.addInstance("fn", &Instance{ContainerId: "c1"})
+	first, err := ps.Acquire(context.Background(), "fn", config)
+	assert.NoError(t, err)
+
+	// The instance is at max_concurrency, so the next request waits in the queue
+	result := make(chan *Instance)
+	go func() {
+		inst, err := ps.Acquire(context.Background(), "fn", config)
+		assert.NoError(t, err)
+		result <- inst
+	}()
+	assert.Eventually(t, func() bool { return ps.GetQueueDepth("fn") == 1 }, time.Second, time.Millisecond)
+
+	// Requests over the queue's max_size are rejected straight away
+	_, err = ps.Acquire(context.Background(), "fn", config)
+	var unavailable *errors.UnavailableError
+	assert.ErrorAs(t, err, &unavailable)
+
+	// Releasing the instance hands it to the queued request
+	ps.Release("fn", first)
+	second := <-result
+	assert.Same(t, first, second)
+	assert.Equal(t, 1, second.InFlight)
+	assert.Equal(t, 0, ps.GetQueueDepth("fn"))
+
+	// Queued requests give up after the queue's max_wait
+	_, err = ps.Acquire(context.Background(), "fn", config)
+	assert.ErrorAs(t, err, &unavailable)
+	assert.Contains(t, err.Error(), "max_wait")
+	assert.Equal(t, 0, ps.GetQueueDepth("fn"))
+
+	// A new instance serves queued requests
+	go func() {
+		inst, err := ps.Acquire(context.Background(), "fn", config)
+		assert.NoError(t, err)
+		result <- inst
+	}()
+	assert.Eventually(t, func() bool { return ps.GetQueueDepth("fn") == 1 }, time.Second, time.Millisecond)
+	ps.addInstance("fn", &Instance{ContainerId: "c2"})
+	assert.Equal(t, "c2", (<-result).ContainerId)
+}
+
+func TestRemoveContainerKeepsRestartedInstances(t *testing.T) {
+	ps := NewInstancePoolService(logging.NewLogger(false, zapcore.DebugLevel), &DockerService{})
+	exitedAt := time.Now()
+	ps.addInstance("fn", &Instance{ContainerId: "crashed", StartedAt: exitedAt.Add(-time.Minute)})
+	ps.addInstance("fn", &Instance{ContainerId: "restarted", StartedAt: exitedAt.Add(time.Second)})
+
+	ps.RemoveContainer("fn", "crashed", exitedAt)
+	ps.RemoveContainer("fn", "restarted", exitedAt)
+
+	instances := ps.GetInstances("fn")
+	assert.Len(t, instances, 1)
+	assert.Equal(t, "restarted", instances[0].ContainerId)
+}
+
+func TestWithInvocationEnv(t *testing.T) {
+	envVars := map[string]string{"MODE": "prod"}
+
+	assert.Equal(t, envVars, withInvocationEnv(context.Background(), envVars))
+
+	ctx := context.WithValue(context.Background(), "invocationId", "req-1")
+	env := withInvocationEnv(ctx, envVars)
+	assert.Equal(t, map[string]string{"MODE": "prod", InvocationEnvVar: "req-1"}, env)
+	// The function's config is shared, so is left unchanged
+	assert.Equal(t, map[string]string{"MODE": "prod"}, envVars)
+}
+
+func TestWithoutInvocationEnv(t *testing.T) {
+	envVars := map[string]string{"MODE": "prod", InvocationEnvVar: "req-1"}
+
+	assert.Equal(t, map[string]string{"MODE": "prod"}, withoutInvocationEnv(envVars))
+	assert.Equal(t, map[string]string{"MODE": "prod", InvocationEnvVar: "req-1"}, envVars)
+}
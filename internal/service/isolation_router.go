@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jwtly10/jambda/api/data"
+	"github.com/jwtly10/jambda/internal/errors"
+)
+
+// IsolationRouter sends functions with isolation 'vm' to the vm backend, and everything else to the container backend.
+// Instances are routed by their id after they are started, as vm instance ids are prefixed with 'vm-'.
+type IsolationRouter struct {
+	containers ExecutionBackend
+	// vms is nil when the vm tier isn't configured
+	vms ExecutionBackend
+}
+
+func NewIsolationRouter(containers ExecutionBackend, vms ExecutionBackend) *IsolationRouter {
+	return &IsolationRouter{
+		containers: containers,
+		vms:        vms,
+	}
+}
+
+func (ir *IsolationRouter) StartInstance(ctx context.Context, functionId string, config data.FunctionConfig) (string, error) {
+	if config.Isolation != data.IsolationVM {
+		return ir.containers.StartInstance(ctx, functionId, config)
+	}
+	if ir.vms == nil {
+		return "", errors.NewValidationError(fmt.Sprintf("function '%s' requires vm isolation, which is not enabled", functionId))
+	}
+	return ir.vms.StartInstance(ctx, functionId, config)
+}
+
+func (ir *IsolationRouter) WaitForRunning(ctx context.Context, instanceId string) error {
+	return ir.backendOf(instanceId).WaitForRunning(ctx, instanceId)
+}
+
+func (ir *IsolationRouter) GetEndpoint(ctx context.Context, instanceId string, config data.FunctionConfig) (string, error) {
+	return ir.backendOf(instanceId).GetEndpoint(ctx, instanceId, config)
+}
+
+func (ir *IsolationRouter) HealthCheck(ctx context.Context, instanceId string, config data.FunctionConfig) error {
+	return ir.backendOf(instanceId).HealthCheck(ctx, instanceId, config)
+}
+
+func (ir *IsolationRouter) Restart(ctx context.Context, instanceId string) error {
+	return ir.backendOf(instanceId).Restart(ctx, instanceId)
+}
+
+func (ir *IsolationRouter) Stop(instanceId string) error {
+	return ir.backendOf(instanceId).Stop(instanceId)
+}
+
+// StopFunction stops the function on both backends, as its isolation may have changed since its instances were started
+func (ir *IsolationRouter) StopFunction(functionId string) {
+	ir.containers.StopFunction(functionId)
+	if ir.vms != nil {
+		ir.vms.StopFunction(functionId)
+	}
+}
+
+func (ir *IsolationRouter) Remove(ctx context.Context, instanceId string) error {
+	return ir.backendOf(instanceId).Remove(ctx, instanceId)
+}
+
+func (ir *IsolationRouter) ListRunning(ctx context.Context, functionId string) ([]string, error) {
+	running, err := ir.containers.ListRunning(ctx, functionId)
+	if err != nil || ir.vms == nil {
+		return running, err
+	}
+	vms, err := ir.vms.ListRunning(ctx, functionId)
+	if err != nil {
+		return nil, err
+	}
+	return append(running, vms...), nil
+}
+
+func (ir *IsolationRouter) ListInstances(ctx context.Context) ([]ContainerRecord, error) {
+	records, err := ir.containers.ListInstances(ctx)
+	if err != nil || ir.vms == nil {
+		return records, err
+	}
+	vms, err := ir.vms.ListInstances(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return append(records, vms...), nil
+}
+
+func (ir *IsolationRouter) Logs(ctx context.Context, instanceId string, tail int) (string, error) {
+	return ir.backendOf(instanceId).Logs(ctx, instanceId, tail)
+}
+
+func (ir *IsolationRouter) backendOf(instanceId string) ExecutionBackend {
+	if ir.vms != nil && strings.HasPrefix(instanceId, vmInstancePrefix) {
+		return ir.vms
+	}
+	return ir.containers
+}
@@ -0,0 +1,723 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jwtly10/jambda/api/data"
+	"github.com/jwtly10/jambda/internal/errors"
+	"github.com/jwtly10/jambda/internal/logging"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	managedByLabel = "app.kubernetes.io/managed-by"
+	managedByValue = "jambda"
+
+	// artifactFetchImage is the image of the init container that downloads a function's binary into its pod
+	artifactFetchImage = "busybox:1.36"
+	artifactMountPath  = "/artifact"
+
+	// restartedAtAnnotation is the same annotation kubectl sets for a rollout restart
+	restartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
+
+	// slotLabel is set on the pod serving an instance slot
+	slotLabel = "jambda.io/slot"
+	// podDeletionCostAnnotation makes the ReplicaSet remove the pod of a stopped instance when scaling down, rather than any pod
+	podDeletionCostAnnotation = "controller.kubernetes.io/pod-deletion-cost"
+
+	maxDeploymentPollInterval = 2 * time.Second
+)
+
+// KubernetesBackend runs each function as a Deployment and Service in a single namespace.
+// Every instance in the pool is a replica of the Deployment, so starting and stopping instances scales the replicas,
+// down to zero when the function is idle. Each instance claims a ready pod by labelling it with its slot, and has its own
+// Service selecting that pod. Requests are proxied through the instance Service's cluster DNS name, so the pool's
+// health checks and restarts apply to a single pod. The function's binary is downloaded from jambda by an init container.
+type KubernetesBackend struct {
+	log       logging.Logger
+	client    kubernetes.Interface
+	namespace string
+	// artifactUrl is the base url pods download function binaries from, e.g 'http://jambda.jambda.svc:8080/v1/api/function'
+	artifactUrl string
+	mu          sync.Mutex
+	// slots are the instance ids of each function, one per replica
+	slots map[string]map[int]bool
+}
+
+func NewKubernetesBackend(log logging.Logger, client kubernetes.Interface, namespace string, artifactUrl string) *KubernetesBackend {
+	return &KubernetesBackend{
+		log:         log,
+		client:      client,
+		namespace:   namespace,
+		artifactUrl: strings.TrimSuffix(artifactUrl, "/"),
+		slots:       make(map[string]map[int]bool),
+	}
+}
+
+// NewKubernetesClient connects using the in cluster service account when running in a pod,
+// falling back to the given kubeconfig, or the default kubeconfig if it's empty
+func NewKubernetesClient(kubeconfig string) (kubernetes.Interface, error) {
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		rules := clientcmd.NewDefaultClientConfigLoadingRules()
+		if kubeconfig != "" {
+			rules.ExplicitPath = kubeconfig
+		}
+		config, err = clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{}).ClientConfig()
+		if err != nil {
+			return nil, fmt.Errorf("error loading kubernetes config: %v", err)
+		}
+	}
+	return kubernetes.NewForConfig(config)
+}
+
+// StartInstance adds a replica to the function's Deployment, creating the Deployment and Services if needed
+func (kb *KubernetesBackend) StartInstance(ctx context.Context, functionId string, config data.FunctionConfig) (string, error) {
+	kb.mu.Lock()
+	defer kb.mu.Unlock()
+
+	slots, err := kb.loadSlots(ctx, functionId)
+	if err != nil {
+		return "", err
+	}
+
+	slot := 0
+	for slots[slot] {
+		slot++
+	}
+
+	if err := kb.applyService(ctx, functionId, deploymentName(functionId), "", *config.Port); err != nil {
+		return "", err
+	}
+	if err := kb.applyService(ctx, functionId, instanceName(functionId, slot), strconv.Itoa(slot), *config.Port); err != nil {
+		return "", err
+	}
+	if err := kb.applyDeployment(ctx, functionId, config, int32(len(slots)+1)); err != nil {
+		return "", err
+	}
+
+	slots[slot] = true
+	instanceId := instanceName(functionId, slot)
+	kb.log.Infof("Scaled deployment for function '%s' to %d replicas", functionId, len(slots))
+	return instanceId, nil
+}
+
+// WaitForRunning polls the function's pods until the instance has claimed a ready pod
+func (kb *KubernetesBackend) WaitForRunning(ctx context.Context, instanceId string) error {
+	functionId, slot, err := parseInstanceName(instanceId)
+	if err != nil {
+		return err
+	}
+
+	delay := initialProbeBackoff
+	for {
+		deployment, err := kb.client.AppsV1().Deployments(kb.namespace).Get(ctx, deploymentName(functionId), metav1.GetOptions{})
+		if err != nil {
+			return errors.NewDockerError(fmt.Sprintf("error getting deployment of function '%s': %v", functionId, err))
+		}
+		for _, condition := range deployment.Status.Conditions {
+			if condition.Type == appsv1.DeploymentProgressing && condition.Status == corev1.ConditionFalse {
+				return errors.NewDockerError(fmt.Sprintf("deployment of function '%s' failed to progress: %s", functionId, condition.Message))
+			}
+		}
+
+		kb.mu.Lock()
+		pod, err := kb.slotPod(ctx, functionId, slot)
+		kb.mu.Unlock()
+		if err != nil {
+			return err
+		}
+		if pod != nil {
+			return nil
+		}
+
+		if err := sleepContext(ctx, delay); err != nil {
+			return errors.NewDockerError(fmt.Sprintf("instance '%s' was not running in time: %v", instanceId, err))
+		}
+		delay = nextBackoff(delay, maxDeploymentPollInterval)
+	}
+}
+
+// GetEndpoint returns the cluster DNS name of the instance's Service, which selects the pod claimed by the instance
+func (kb *KubernetesBackend) GetEndpoint(ctx context.Context, instanceId string, config data.FunctionConfig) (string, error) {
+	if _, _, err := parseInstanceName(instanceId); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("http://%s.%s.svc:%d", instanceId, kb.namespace, *config.Port), nil
+}
+
+func (kb *KubernetesBackend) HealthCheck(ctx context.Context, instanceId string, config data.FunctionConfig) error {
+	url, err := kb.GetEndpoint(ctx, instanceId, config)
+	if err != nil {
+		return err
+	}
+	return waitUntilHealthy(ctx, kb.log, instanceId, url, config)
+}
+
+// Restart deletes the instance's pod, the ReplicaSet replaces it and the instance claims the new pod once it's ready
+func (kb *KubernetesBackend) Restart(ctx context.Context, instanceId string) error {
+	functionId, slot, err := parseInstanceName(instanceId)
+	if err != nil {
+		return err
+	}
+
+	kb.mu.Lock()
+	defer kb.mu.Unlock()
+	pods, err := kb.listPods(ctx, functionId)
+	if err != nil {
+		return err
+	}
+	pod := claimedPod(pods, slot)
+	if pod == nil {
+		// The instance hasn't claimed a pod yet, so it will claim a new one
+		return nil
+	}
+	if err := kb.client.CoreV1().Pods(kb.namespace).Delete(ctx, pod.Name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		return errors.NewDockerError(fmt.Sprintf("error deleting pod '%s' of instance '%s': %v", pod.Name, instanceId, err))
+	}
+	kb.log.Infof("Deleted pod '%s' to restart instance '%s'", pod.Name, instanceId)
+	return nil
+}
+
+// Stop removes a replica from the function's Deployment
+func (kb *KubernetesBackend) Stop(instanceId string) error {
+	functionId, slot, err := parseInstanceName(instanceId)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	kb.mu.Lock()
+	defer kb.mu.Unlock()
+	slots, err := kb.loadSlots(ctx, functionId)
+	if err != nil {
+		return err
+	}
+	if !slots[slot] {
+		return nil
+	}
+	delete(slots, slot)
+
+	if err := kb.markPodForDeletion(ctx, functionId, slot); err != nil {
+		return err
+	}
+	if err := kb.scale(ctx, functionId, int32(len(slots))); err != nil {
+		return err
+	}
+	if err := kb.client.CoreV1().Services(kb.namespace).Delete(ctx, instanceId, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		return errors.NewDockerError(fmt.Sprintf("error deleting service of instance '%s': %v", instanceId, err))
+	}
+	kb.log.Infof("Scaled deployment for function '%s' to %d replicas", functionId, len(slots))
+	return nil
+}
+
+// StopFunction scales the function's Deployment to zero
+func (kb *KubernetesBackend) StopFunction(functionId string) {
+	kb.log.Infof("Scaling function '%s' to zero", functionId)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	kb.mu.Lock()
+	defer kb.mu.Unlock()
+	kb.slots[functionId] = make(map[int]bool)
+	if err := kb.scale(ctx, functionId, 0); err != nil {
+		kb.log.Errorf("Failed to scale function '%s' to zero: %v", functionId, err)
+	}
+	if err := kb.deleteInstanceServices(ctx, functionId); err != nil {
+		kb.log.Errorf("Failed to delete instance services of function '%s': %v", functionId, err)
+	}
+}
+
+// Remove removes a replica, deleting the function's Deployment and Services once it has none left
+func (kb *KubernetesBackend) Remove(ctx context.Context, instanceId string) error {
+	functionId, _, err := parseInstanceName(instanceId)
+	if err != nil {
+		return err
+	}
+	if err := kb.Stop(instanceId); err != nil {
+		return err
+	}
+
+	kb.mu.Lock()
+	defer kb.mu.Unlock()
+	if len(kb.slots[functionId]) > 0 {
+		return nil
+	}
+	delete(kb.slots, functionId)
+
+	name := deploymentName(functionId)
+	if err := kb.client.AppsV1().Deployments(kb.namespace).Delete(ctx, name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		return errors.NewDockerError(fmt.Sprintf("error deleting deployment of function '%s': %v", functionId, err))
+	}
+	if err := kb.client.CoreV1().Services(kb.namespace).Delete(ctx, name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		return errors.NewDockerError(fmt.Sprintf("error deleting service of function '%s': %v", functionId, err))
+	}
+	if err := kb.deleteInstanceServices(ctx, functionId); err != nil {
+		return err
+	}
+	kb.log.Infof("Removed deployment and services of function '%s'", functionId)
+	return nil
+}
+
+func (kb *KubernetesBackend) ListRunning(ctx context.Context, functionId string) ([]string, error) {
+	kb.mu.Lock()
+	defer kb.mu.Unlock()
+	slots, err := kb.loadSlots(ctx, functionId)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []string{}
+	for _, slot := range sortedSlots(slots) {
+		ids = append(ids, instanceName(functionId, slot))
+	}
+	return ids, nil
+}
+
+// ListInstances returns an instance per replica of every function Deployment.
+// Deployments scaled to zero are listed as a single exited instance, so they can still be removed.
+func (kb *KubernetesBackend) ListInstances(ctx context.Context) ([]ContainerRecord, error) {
+	deployments, err := kb.client.AppsV1().Deployments(kb.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", managedByLabel, managedByValue),
+	})
+	if err != nil {
+		return nil, errors.NewDockerError(fmt.Sprintf("error listing deployments: %v", err))
+	}
+
+	kb.mu.Lock()
+	defer kb.mu.Unlock()
+	var records []ContainerRecord
+	for _, deployment := range deployments.Items {
+		functionId := deployment.Labels["function_id"]
+		slots := kb.slotsFromDeployment(functionId, &deployment)
+		startedAt := deployment.CreationTimestamp.Time
+
+		if len(slots) == 0 {
+			records = append(records, ContainerRecord{
+				ContainerId: instanceName(functionId, 0),
+				FunctionId:  functionId,
+				State:       ContainerStateExited,
+				StartedAt:   startedAt,
+			})
+			continue
+		}
+		for _, slot := range sortedSlots(slots) {
+			records = append(records, ContainerRecord{
+				ContainerId: instanceName(functionId, slot),
+				FunctionId:  functionId,
+				State:       ContainerStateRunning,
+				StartedAt:   startedAt,
+			})
+		}
+	}
+	return records, nil
+}
+
+// Logs returns the logs of the instance's pod, or of every pod of the function when it hasn't claimed one yet
+func (kb *KubernetesBackend) Logs(ctx context.Context, instanceId string, tail int) (string, error) {
+	functionId, slot, err := parseInstanceName(instanceId)
+	if err != nil {
+		return "", err
+	}
+
+	pods, err := kb.listPods(ctx, functionId)
+	if err != nil {
+		return "", err
+	}
+	if pod := claimedPod(pods, slot); pod != nil {
+		pods = []corev1.Pod{*pod}
+	}
+
+	opts := &corev1.PodLogOptions{Container: "function"}
+	if tail > 0 {
+		lines := int64(tail)
+		opts.TailLines = &lines
+	}
+
+	var output bytes.Buffer
+	for _, pod := range pods {
+		stream, err := kb.client.CoreV1().Pods(kb.namespace).GetLogs(pod.Name, opts).Stream(ctx)
+		if err != nil {
+			kb.log.Errorf("Failed to get logs of pod '%s': %v", pod.Name, err)
+			continue
+		}
+		fmt.Fprintf(&output, "==> %s <==\n", pod.Name)
+		io.Copy(&output, stream)
+		stream.Close()
+	}
+	return output.String(), nil
+}
+
+// loadSlots returns the instance slots of a function, initialising them from the Deployment's replicas
+// the first time the function is seen, e.g after jambda restarts. It must be called with the lock held.
+func (kb *KubernetesBackend) loadSlots(ctx context.Context, functionId string) (map[int]bool, error) {
+	if slots, exists := kb.slots[functionId]; exists {
+		return slots, nil
+	}
+
+	deployment, err := kb.client.AppsV1().Deployments(kb.namespace).Get(ctx, deploymentName(functionId), metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, errors.NewDockerError(fmt.Sprintf("error getting deployment of function '%s': %v", functionId, err))
+	}
+	if apierrors.IsNotFound(err) {
+		deployment = nil
+	}
+	return kb.slotsFromDeployment(functionId, deployment), nil
+}
+
+// slotsFromDeployment must be called with the lock held
+func (kb *KubernetesBackend) slotsFromDeployment(functionId string, deployment *appsv1.Deployment) map[int]bool {
+	if slots, exists := kb.slots[functionId]; exists {
+		return slots
+	}
+
+	slots := make(map[int]bool)
+	if deployment != nil && deployment.Spec.Replicas != nil {
+		for i := 0; i < int(*deployment.Spec.Replicas); i++ {
+			slots[i] = true
+		}
+	}
+	kb.slots[functionId] = slots
+	return slots
+}
+
+// slotPod returns the ready pod claimed by an instance slot, claiming a ready pod that no other running slot has when it has none.
+// It returns nil when there is no ready pod for the slot yet. It must be called with the lock held.
+func (kb *KubernetesBackend) slotPod(ctx context.Context, functionId string, slot int) (*corev1.Pod, error) {
+	slots, err := kb.loadSlots(ctx, functionId)
+	if err != nil {
+		return nil, err
+	}
+	if !slots[slot] {
+		return nil, errors.NewNotFoundError(fmt.Sprintf("instance '%s' is not running", instanceName(functionId, slot)))
+	}
+
+	pods, err := kb.listPods(ctx, functionId)
+	if err != nil {
+		return nil, err
+	}
+	if pod := claimedPod(pods, slot); pod != nil {
+		if !podReady(pod) {
+			return nil, nil
+		}
+		return pod, nil
+	}
+
+	for i := range pods {
+		pod := &pods[i]
+		claimed, err := strconv.Atoi(pod.Labels[slotLabel])
+		// Pods left claimed by stopped slots are free to claim again
+		if pod.DeletionTimestamp != nil || !podReady(pod) || (err == nil && slots[claimed]) {
+			continue
+		}
+
+		pod.Labels[slotLabel] = strconv.Itoa(slot)
+		updated, err := kb.client.CoreV1().Pods(kb.namespace).Update(ctx, pod, metav1.UpdateOptions{})
+		if apierrors.IsConflict(err) || apierrors.IsNotFound(err) {
+			// The pod changed since it was listed, try again on the next poll
+			return nil, nil
+		}
+		if err != nil {
+			return nil, errors.NewDockerError(fmt.Sprintf("error claiming pod '%s' for instance '%s': %v", pod.Name, instanceName(functionId, slot), err))
+		}
+		kb.log.Infof("Instance '%s' claimed pod '%s'", instanceName(functionId, slot), pod.Name)
+		return updated, nil
+	}
+	return nil, nil
+}
+
+// markPodForDeletion makes the pod of a slot the one removed when the Deployment is scaled down. It must be called with the lock held.
+func (kb *KubernetesBackend) markPodForDeletion(ctx context.Context, functionId string, slot int) error {
+	pods, err := kb.listPods(ctx, functionId)
+	if err != nil {
+		return err
+	}
+	pod := claimedPod(pods, slot)
+	if pod == nil {
+		return nil
+	}
+
+	if pod.Annotations == nil {
+		pod.Annotations = make(map[string]string)
+	}
+	pod.Annotations[podDeletionCostAnnotation] = "-1000"
+	if _, err := kb.client.CoreV1().Pods(kb.namespace).Update(ctx, pod, metav1.UpdateOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		return errors.NewDockerError(fmt.Sprintf("error marking pod '%s' for deletion: %v", pod.Name, err))
+	}
+	return nil
+}
+
+func (kb *KubernetesBackend) listPods(ctx context.Context, functionId string) ([]corev1.Pod, error) {
+	pods, err := kb.client.CoreV1().Pods(kb.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("function_id=%s", functionId),
+	})
+	if err != nil {
+		return nil, errors.NewDockerError(fmt.Sprintf("error listing pods of function '%s': %v", functionId, err))
+	}
+	return pods.Items, nil
+}
+
+// claimedPod returns the pod claimed by a slot that isn't being deleted
+func claimedPod(pods []corev1.Pod, slot int) *corev1.Pod {
+	for i := range pods {
+		if pods[i].DeletionTimestamp == nil && pods[i].Labels[slotLabel] == strconv.Itoa(slot) {
+			return &pods[i]
+		}
+	}
+	return nil
+}
+
+func podReady(pod *corev1.Pod) bool {
+	if pod.Status.PodIP == "" {
+		return false
+	}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+func (kb *KubernetesBackend) scale(ctx context.Context, functionId string, replicas int32) error {
+	deployments := kb.client.AppsV1().Deployments(kb.namespace)
+	deployment, err := deployments.Get(ctx, deploymentName(functionId), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		// Nothing has been deployed for the function, so there is nothing to scale
+		return nil
+	}
+	if err != nil {
+		return errors.NewDockerError(fmt.Sprintf("error getting deployment of function '%s': %v", functionId, err))
+	}
+	deployment.Spec.Replicas = &replicas
+	if _, err := deployments.Update(ctx, deployment, metav1.UpdateOptions{}); err != nil {
+		return errors.NewDockerError(fmt.Sprintf("error scaling deployment of function '%s': %v", functionId, err))
+	}
+	return nil
+}
+
+// applyService creates a Service for the function's pods if it doesn't exist yet. The function's Service, without a slot,
+// selects every pod, and an instance's Service selects only the pod claimed by its slot.
+func (kb *KubernetesBackend) applyService(ctx context.Context, functionId string, name string, slot string, port int) error {
+	services := kb.client.CoreV1().Services(kb.namespace)
+	_, err := services.Get(ctx, name, metav1.GetOptions{})
+	if err == nil {
+		return nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return errors.NewDockerError(fmt.Sprintf("error getting service '%s': %v", name, err))
+	}
+
+	labels := functionLabels(functionId)
+	selector := map[string]string{"function_id": functionId}
+	if slot != "" {
+		labels[slotLabel] = slot
+		selector[slotLabel] = slot
+	}
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: labels,
+		},
+		Spec: corev1.ServiceSpec{
+			Selector: selector,
+			Ports: []corev1.ServicePort{{
+				Name:       "http",
+				Port:       int32(port),
+				TargetPort: intstr.FromInt32(int32(port)),
+			}},
+		},
+	}
+	if _, err := services.Create(ctx, service, metav1.CreateOptions{}); err != nil {
+		return errors.NewDockerError(fmt.Sprintf("error creating service '%s': %v", name, err))
+	}
+	return nil
+}
+
+// deleteInstanceServices deletes the Services of every instance of the function
+func (kb *KubernetesBackend) deleteInstanceServices(ctx context.Context, functionId string) error {
+	services := kb.client.CoreV1().Services(kb.namespace)
+	list, err := services.List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("function_id=%s,%s", functionId, slotLabel),
+	})
+	if err != nil {
+		return errors.NewDockerError(fmt.Sprintf("error listing services of function '%s': %v", functionId, err))
+	}
+	for _, service := range list.Items {
+		if err := services.Delete(ctx, service.Name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return errors.NewDockerError(fmt.Sprintf("error deleting service '%s': %v", service.Name, err))
+		}
+	}
+	return nil
+}
+
+// applyDeployment creates the function's Deployment, or updates it to the latest config and replica count
+func (kb *KubernetesBackend) applyDeployment(ctx context.Context, functionId string, config data.FunctionConfig, replicas int32) error {
+	deployments := kb.client.AppsV1().Deployments(kb.namespace)
+	desired, err := kb.buildDeployment(functionId, config, replicas)
+	if err != nil {
+		return err
+	}
+
+	existing, err := deployments.Get(ctx, desired.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		if _, err := deployments.Create(ctx, desired, metav1.CreateOptions{}); err != nil {
+			return errors.NewDockerError(fmt.Sprintf("error creating deployment of function '%s': %v", functionId, err))
+		}
+		return nil
+	}
+	if err != nil {
+		return errors.NewDockerError(fmt.Sprintf("error getting deployment of function '%s': %v", functionId, err))
+	}
+
+	// Keep any rollout restart annotation, so updating the replicas doesn't restart every pod
+	if restartedAt, exists := existing.Spec.Template.Annotations[restartedAtAnnotation]; exists {
+		desired.Spec.Template.Annotations[restartedAtAnnotation] = restartedAt
+	}
+	existing.Labels = desired.Labels
+	existing.Spec.Replicas = desired.Spec.Replicas
+	existing.Spec.Template = desired.Spec.Template
+	if _, err := deployments.Update(ctx, existing, metav1.UpdateOptions{}); err != nil {
+		return errors.NewDockerError(fmt.Sprintf("error updating deployment of function '%s': %v", functionId, err))
+	}
+	return nil
+}
+
+func (kb *KubernetesBackend) buildDeployment(functionId string, config data.FunctionConfig, replicas int32) (*appsv1.Deployment, error) {
+	var artifact string
+	var command []string
+	switch {
+	case strings.Contains(config.Image, "golang"):
+		artifact = "bootstrap"
+		command = []string{artifactMountPath + "/bootstrap"}
+	case strings.Contains(config.Image, "jdk"):
+		artifact = "bootstrap.jar"
+		command = []string{"java", "-jar", artifactMountPath + "/bootstrap.jar"}
+	default:
+		return nil, errors.NewValidationError(fmt.Sprintf("image '%s' is not supported by the kubernetes backend", config.Image))
+	}
+
+	port := int32(*config.Port)
+	env := []corev1.EnvVar{{Name: "PORT", Value: strconv.Itoa(*config.Port)}}
+	for _, key := range sortedKeys(config.EnvVars) {
+		env = append(env, corev1.EnvVar{Name: key, Value: config.EnvVars[key]})
+	}
+
+	hc := newHealthCheckSettings(config)
+	probe := &corev1.Probe{
+		InitialDelaySeconds: int32(hc.initialDelay.Seconds()),
+		PeriodSeconds:       int32(max(hc.interval.Seconds(), 1)),
+		TimeoutSeconds:      int32(max(hc.timeout.Seconds(), 1)),
+	}
+	if hc.tcpOnly {
+		probe.TCPSocket = &corev1.TCPSocketAction{Port: intstr.FromInt32(port)}
+	} else {
+		probe.HTTPGet = &corev1.HTTPGetAction{Path: hc.path, Port: intstr.FromInt32(port)}
+	}
+
+	labels := functionLabels(functionId)
+	artifactVolume := corev1.VolumeMount{Name: "artifact", MountPath: artifactMountPath}
+	artifactPath := fmt.Sprintf("%s/%s", artifactMountPath, artifact)
+
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   deploymentName(functionId),
+			Labels: labels,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"function_id": functionId}},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels:      labels,
+					Annotations: map[string]string{},
+				},
+				Spec: corev1.PodSpec{
+					InitContainers: []corev1.Container{{
+						Name:         "fetch-artifact",
+						Image:        artifactFetchImage,
+						Command:      []string{"sh", "-c", fmt.Sprintf("wget -q -O %s %s/%s/artifact && chmod +x %s", artifactPath, kb.artifactUrl, functionId, artifactPath)},
+						VolumeMounts: []corev1.VolumeMount{artifactVolume},
+					}},
+					Containers: []corev1.Container{{
+						Name:           "function",
+						Image:          config.Image,
+						Command:        command,
+						Env:            env,
+						Ports:          []corev1.ContainerPort{{Name: "http", ContainerPort: port}},
+						ReadinessProbe: probe,
+						VolumeMounts:   []corev1.VolumeMount{artifactVolume},
+					}},
+					Volumes: []corev1.Volume{{
+						Name:         "artifact",
+						VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+					}},
+				},
+			},
+		},
+	}, nil
+}
+
+func functionLabels(functionId string) map[string]string {
+	return map[string]string{
+		"function_id":  functionId,
+		managedByLabel: managedByValue,
+	}
+}
+
+func deploymentName(functionId string) string {
+	return "jambda-" + functionId
+}
+
+// instanceName identifies a single replica slot of a function's Deployment
+func instanceName(functionId string, slot int) string {
+	return fmt.Sprintf("%s-%d", deploymentName(functionId), slot)
+}
+
+func parseInstanceName(instanceId string) (string, int, error) {
+	name, prefixed := strings.CutPrefix(instanceId, "jambda-")
+	i := strings.LastIndex(name, "-")
+	if !prefixed || i <= 0 {
+		return "", 0, errors.NewNotFoundError(fmt.Sprintf("instance '%s' not found", instanceId))
+	}
+	slot, err := strconv.Atoi(name[i+1:])
+	if err != nil {
+		return "", 0, errors.NewNotFoundError(fmt.Sprintf("instance '%s' not found", instanceId))
+	}
+	return name[:i], slot, nil
+}
+
+func sortedSlots(slots map[int]bool) []int {
+	sorted := make([]int, 0, len(slots))
+	for slot := range slots {
+		sorted = append(sorted, slot)
+	}
+	sort.Ints(sorted)
+	return sorted
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
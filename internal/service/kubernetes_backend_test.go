@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jwtly10/jambda/api/data"
+	"github.com/jwtly10/jambda/internal/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zapcore"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestKubernetesBackendScaling(t *testing.T) {
+	logger := logging.NewLogger(false, zapcore.DebugLevel)
+	client := fake.NewSimpleClientset()
+	backend := NewKubernetesBackend(logger, client, "functions", "http://jambda:8080/v1/api/function/")
+	port := 8080
+	config := data.FunctionConfig{Image: "golang:1.22", Port: &port, EnvVars: map[string]string{"GREETING": "hello"}}
+	ctx := context.Background()
+
+	first, err := backend.StartInstance(ctx, "fn", config)
+	require.NoError(t, err)
+	second, err := backend.StartInstance(ctx, "fn", config)
+	require.NoError(t, err)
+	assert.Equal(t, "jambda-fn-0", first)
+	assert.Equal(t, "jambda-fn-1", second)
+
+	deployment, err := client.AppsV1().Deployments("functions").Get(ctx, "jambda-fn", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), *deployment.Spec.Replicas)
+	assert.Equal(t, "jambda", deployment.Labels[managedByLabel])
+
+	pod := deployment.Spec.Template.Spec
+	require.Len(t, pod.InitContainers, 1)
+	assert.Contains(t, pod.InitContainers[0].Command[2], "http://jambda:8080/v1/api/function/fn/artifact")
+	assert.Equal(t, []string{"/artifact/bootstrap"}, pod.Containers[0].Command)
+	assert.Equal(t, "PORT", pod.Containers[0].Env[0].Name)
+	assert.Equal(t, "GREETING", pod.Containers[0].Env[1].Name)
+	assert.Equal(t, "/health", pod.Containers[0].ReadinessProbe.HTTPGet.Path)
+
+	// The fake clientset has no controllers, so create the replicas' pods ourselves
+	addReadyPod(t, client, "functions", "fn", "pod-a", "10.0.0.1")
+	assert.NoError(t, backend.WaitForRunning(ctx, first))
+	addReadyPod(t, client, "functions", "fn", "pod-b", "10.0.0.2")
+	assert.NoError(t, backend.WaitForRunning(ctx, second))
+
+	// The function's Service selects every pod, and each instance's Service only the pod it claimed
+	function, err := client.CoreV1().Services("functions").Get(ctx, "jambda-fn", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"function_id": "fn"}, function.Spec.Selector)
+	instance, err := client.CoreV1().Services("functions").Get(ctx, second, metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"function_id": "fn", slotLabel: "1"}, instance.Spec.Selector)
+	claimed, err := client.CoreV1().Pods("functions").Get(ctx, "pod-b", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "1", claimed.Labels[slotLabel])
+
+	endpoint, err := backend.GetEndpoint(ctx, first, config)
+	assert.NoError(t, err)
+	assert.Equal(t, "http://jambda-fn-0.functions.svc:8080", endpoint)
+
+	// Restarting an instance deletes only its own pod, and it claims the replacement
+	require.NoError(t, backend.Restart(ctx, second))
+	_, err = client.CoreV1().Pods("functions").Get(ctx, "pod-b", metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err))
+	_, err = client.CoreV1().Pods("functions").Get(ctx, "pod-a", metav1.GetOptions{})
+	assert.NoError(t, err)
+	addReadyPod(t, client, "functions", "fn", "pod-c", "10.0.0.3")
+	assert.NoError(t, backend.WaitForRunning(ctx, second))
+	claimed, err = client.CoreV1().Pods("functions").Get(ctx, "pod-c", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "1", claimed.Labels[slotLabel])
+
+	// Stopping an instance frees its slot for the next start
+	assert.NoError(t, backend.Stop(first))
+	running, err := backend.ListRunning(ctx, "fn")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{second}, running)
+	// Its pod is the one the ReplicaSet removes when scaling down
+	stopped, err := client.CoreV1().Pods("functions").Get(ctx, "pod-a", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "-1000", stopped.Annotations[podDeletionCostAnnotation])
+	_, err = client.CoreV1().Services("functions").Get(ctx, first, metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err))
+
+	restarted, err := backend.StartInstance(ctx, "fn", config)
+	require.NoError(t, err)
+	assert.Equal(t, first, restarted)
+
+	// Scaling to zero keeps the deployment around for the next cold start
+	backend.StopFunction("fn")
+	deployment, err = client.AppsV1().Deployments("functions").Get(ctx, "jambda-fn", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, int32(0), *deployment.Spec.Replicas)
+
+	records, err := backend.ListInstances(ctx)
+	assert.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, ContainerStateExited, records[0].State)
+
+	assert.NoError(t, backend.Remove(ctx, records[0].ContainerId))
+	_, err = client.AppsV1().Deployments("functions").Get(ctx, "jambda-fn", metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err))
+	services, err := client.CoreV1().Services("functions").List(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, services.Items)
+}
+
+func TestKubernetesBackendLoadsExistingReplicas(t *testing.T) {
+	logger := logging.NewLogger(false, zapcore.DebugLevel)
+	client := fake.NewSimpleClientset()
+	port := 8080
+	config := data.FunctionConfig{Image: "eclipse-temurin:21-jdk", Port: &port}
+	ctx := context.Background()
+
+	previous := NewKubernetesBackend(logger, client, "default", "http://jambda:8080/v1/api/function")
+	for i := 0; i < 2; i++ {
+		_, err := previous.StartInstance(ctx, "fn", config)
+		require.NoError(t, err)
+	}
+
+	// A new backend, as after jambda restarts, picks up the replicas already running
+	backend := NewKubernetesBackend(logger, client, "default", "http://jambda:8080/v1/api/function")
+	records, err := backend.ListInstances(ctx)
+	assert.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, "jambda-fn-0", records[0].ContainerId)
+	assert.Equal(t, "jambda-fn-1", records[1].ContainerId)
+	assert.Equal(t, ContainerStateRunning, records[0].State)
+
+	deployment, err := client.AppsV1().Deployments("default").Get(ctx, "jambda-fn", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"java", "-jar", "/artifact/bootstrap.jar"}, deployment.Spec.Template.Spec.Containers[0].Command)
+}
+
+// addReadyPod creates a ready pod of the function, as its Deployment's ReplicaSet would
+func addReadyPod(t *testing.T, client *fake.Clientset, namespace string, functionId string, name string, ip string) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: functionLabels(functionId)},
+		Status: corev1.PodStatus{
+			PodIP:      ip,
+			Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}},
+		},
+	}
+	_, err := client.CoreV1().Pods(namespace).Create(context.Background(), pod, metav1.CreateOptions{})
+	require.NoError(t, err)
+}
+
+func TestParseInstanceName(t *testing.T) {
+	tests := []struct {
+		name       string
+		instanceId string
+		functionId string
+		slot       int
+		wantErr    bool
+	}{
+		{name: "simple id", instanceId: "jambda-abc123-0", functionId: "abc123", slot: 0},
+		{name: "id with dashes", instanceId: "jambda-my-fn-12", functionId: "my-fn", slot: 12},
+		{name: "missing prefix", instanceId: "abc123-0", wantErr: true},
+		{name: "missing slot", instanceId: "jambda-abc123", wantErr: true},
+		{name: "invalid slot", instanceId: "jambda-abc-x", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			functionId, slot, err := parseInstanceName(tt.instanceId)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.functionId, functionId)
+			assert.Equal(t, tt.slot, slot)
+		})
+	}
+}
@@ -0,0 +1,14 @@
+package service
+
+import (
+	"os"
+	"testing"
+)
+
+// TestMain lets the test binary launch sandboxed processes, as jambda's main does
+func TestMain(m *testing.M) {
+	if IsSandboxLauncher() {
+		RunSandboxLauncher()
+	}
+	os.Exit(m.Run())
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jwtly10/jambda/api/data"
+	"github.com/jwtly10/jambda/internal/errors"
+	"github.com/jwtly10/jambda/internal/logging"
+)
+
+// prewarmTimeout bounds how long background warming waits for instances to become ready
+const prewarmTimeout = 2 * time.Minute
+
+// DefaultWarmDuration is how long instances warmed ahead of a spike are kept running without requests
+const DefaultWarmDuration = 10 * time.Minute
+
+// PrewarmService starts function instances ahead of requests, so they don't pay for a cold start
+type PrewarmService struct {
+	log logging.Logger
+	ps  *InstancePoolService
+	ds  DockerService
+	fs  FunctionService
+}
+
+func NewPrewarmService(log logging.Logger, ps *InstancePoolService, ds DockerService, fs FunctionService) *PrewarmService {
+	return &PrewarmService{
+		log: log,
+		ps:  ps,
+		ds:  ds,
+		fs:  fs,
+	}
+}
+
+// WarmActiveFunctions starts the warm instances of every active function in the background, used when jambda boots
+func (pw *PrewarmService) WarmActiveFunctions() {
+	functions, err := pw.fs.GetAllActiveFunctions()
+	if err != nil {
+		pw.log.Errorf("Failed to get active functions to prewarm: %v", err)
+		return
+	}
+
+	for _, function := range functions {
+		if function.Configuration != nil {
+			pw.WarmDeployedFunction(function.ExternalId, *function.Configuration)
+		}
+	}
+}
+
+// WarmDeployedFunction starts the warm instances of a function in the background, used after a function is deployed
+func (pw *PrewarmService) WarmDeployedFunction(functionId string, config data.FunctionConfig) {
+	if config.WarmInstances <= 0 || config.Type != "REST" {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), prewarmTimeout)
+		defer cancel()
+
+		pw.log.Infof("Prewarming %d instances of function '%s'", config.WarmInstances, functionId)
+		if err := pw.ps.Warm(ctx, functionId, config, config.WarmInstances); err != nil {
+			pw.log.Errorf("Failed to prewarm function '%s': %v", functionId, err)
+		}
+	}()
+}
+
+// WarmFunction starts instances of a function ahead of a known spike in traffic, waiting until they are ready.
+// A count of 0 warms the function's configured warm instances, or a single instance if it has none.
+// The instances are kept running for the duration, or DefaultWarmDuration if it's 0, even without requests.
+func (pw *PrewarmService) WarmFunction(ctx context.Context, functionId string, count int, duration time.Duration) ([]Instance, error) {
+	config, err := pw.ds.GetFunctionConfiguration(ctx, functionId)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Type != "REST" {
+		return nil, errors.NewValidationError(fmt.Sprintf("function type '%s' can not be warmed", config.Type))
+	}
+
+	if count <= 0 {
+		count = minInstances(*config)
+		if count < 1 {
+			count = 1
+		}
+	}
+	if maximum := maxInstances(*config); count > maximum {
+		return nil, errors.NewValidationError(fmt.Sprintf("can not warm %d instances, function '%s' has max_instances of %d", count, functionId, maximum))
+	}
+
+	if duration <= 0 {
+		duration = DefaultWarmDuration
+	}
+	// Held from the start, so instances that are ready first aren't scaled down while the rest start
+	pw.ps.HoldWarm(functionId, count, time.Now().Add(duration))
+
+	if err := pw.ps.Warm(ctx, functionId, *config, count); err != nil {
+		return nil, err
+	}
+
+	return pw.ps.GetInstances(functionId), nil
+}
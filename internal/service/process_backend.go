@@ -0,0 +1,549 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jwtly10/jambda/api/data"
+	"github.com/jwtly10/jambda/internal/errors"
+	"github.com/jwtly10/jambda/internal/logging"
+)
+
+const (
+	// processStopTimeout is how long a process has to exit after being asked to, before it's killed
+	processStopTimeout = 10 * time.Second
+
+	// maxProcessLogBytes is the amount of output kept in memory per process
+	maxProcessLogBytes = 1 << 20
+
+	// maxPortAttempts is how many free ports are tried when allocating a port for a process
+	maxPortAttempts = 10
+
+	// maxBindRetries is how many times a process is started on a new port when it fails to bind its port
+	maxBindRetries = 3
+)
+
+// processInstance is a single child process running a function's bootstrap binary
+type processInstance struct {
+	id         string
+	functionId string
+	config     data.FunctionConfig
+	cmd        *exec.Cmd
+	port       int
+	workDir    string
+	state      string
+	startedAt  time.Time
+	finishedAt time.Time
+	exitCode   int
+	// done is closed once the process has exited
+	done chan struct{}
+	logs *logBuffer
+}
+
+// sandboxLauncherEnv marks jambda being re-executed to launch a function's process, with the sandbox it runs in.
+// Go can't change resource limits between fork and exec, so the launcher applies them and then execs the function in its place.
+const sandboxLauncherEnv = "JAMBDA_SANDBOX"
+
+// ProcessSandbox limits what the processes of the process backend can do, these are only applied on linux
+type ProcessSandbox struct {
+	// User is the 'uid:gid' processes run as when jambda runs as root, e.g '65534:65534' for nobody.
+	// Processes keep jambda's user when it isn't root, or when this is empty.
+	User string
+	// MaxMemory is the address space each process can reserve in bytes (RLIMIT_AS), unlimited when 0.
+	// This is virtual memory, so it needs to leave room for runtimes like the JVM that reserve far more than they use.
+	MaxMemory uint64
+	// MaxProcesses is how many processes and threads the user processes run as can have in total (RLIMIT_NPROC), unlimited when 0.
+	// When processes keep jambda's user this counts every process of that user, not just the function's.
+	MaxProcesses uint64
+}
+
+// IsSandboxLauncher is whether jambda was started by the process backend to launch a sandboxed process,
+// in which case main must call RunSandboxLauncher before doing anything else
+func IsSandboxLauncher() bool {
+	_, ok := os.LookupEnv(sandboxLauncherEnv)
+	return ok
+}
+
+// ProcessBackend runs functions directly as child processes on the host, for development and running tests without a docker daemon.
+// Each process runs in its own process group, with a scrubbed environment, a temporary working directory, and on linux the limits of the ProcessSandbox.
+// Processes share the host's filesystem, network and process namespaces, so this is not isolation for untrusted functions, use the docker or vm backends for those.
+// Functions are told which port to listen on with the PORT env var, which is the configured port when it's free.
+type ProcessBackend struct {
+	log         logging.Logger
+	registry    *ContainerRegistry
+	binariesDir string
+	sandbox     ProcessSandbox
+	mu          sync.Mutex
+	instances   map[string]*processInstance
+	nextId      int
+}
+
+func NewProcessBackend(log logging.Logger, registry *ContainerRegistry, binariesDir string, sandbox ProcessSandbox) *ProcessBackend {
+	return &ProcessBackend{
+		log:         log,
+		registry:    registry,
+		binariesDir: binariesDir,
+		sandbox:     sandbox,
+		instances:   make(map[string]*processInstance),
+	}
+}
+
+// StartInstance starts a process for the function, reusing the id of an exited process where possible
+func (pb *ProcessBackend) StartInstance(ctx context.Context, functionId string, config data.FunctionConfig) (string, error) {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+
+	var inst *processInstance
+	for _, existing := range pb.instances {
+		if existing.functionId == functionId && existing.state == ContainerStateExited {
+			inst = existing
+			break
+		}
+	}
+	if inst == nil {
+		pb.nextId++
+		inst = &processInstance{
+			id:         fmt.Sprintf("proc-%s-%d", functionId, pb.nextId),
+			functionId: functionId,
+		}
+	}
+	inst.config = config
+	inst.config.EnvVars = withInvocationEnv(ctx, config.EnvVars)
+
+	if err := pb.launch(inst); err != nil {
+		return "", err
+	}
+	pb.instances[inst.id] = inst
+	return inst.id, nil
+}
+
+// WaitForRunning returns straight away for a running process, as processes are running as soon as they are started
+func (pb *ProcessBackend) WaitForRunning(ctx context.Context, instanceId string) error {
+	inst, err := pb.getInstance(instanceId)
+	if err != nil {
+		return err
+	}
+
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	if inst.state != ContainerStateRunning {
+		return errors.NewDockerError(fmt.Sprintf("process '%s' exited with code %d", instanceId, inst.exitCode))
+	}
+	return nil
+}
+
+func (pb *ProcessBackend) GetEndpoint(ctx context.Context, instanceId string, config data.FunctionConfig) (string, error) {
+	inst, err := pb.getInstance(instanceId)
+	if err != nil {
+		return "", err
+	}
+
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	return fmt.Sprintf("http://localhost:%d", inst.port), nil
+}
+
+// HealthCheck waits for the process to pass its health check, failing early if it exits.
+// Something else can take the process's port before it listens on it, so a process failing to bind is started again on another port.
+func (pb *ProcessBackend) HealthCheck(ctx context.Context, instanceId string, config data.FunctionConfig) error {
+	inst, err := pb.getInstance(instanceId)
+	if err != nil {
+		return err
+	}
+
+	for retry := 0; ; retry++ {
+		pb.mu.Lock()
+		url := fmt.Sprintf("http://localhost:%d", inst.port)
+		done := inst.done
+		pb.mu.Unlock()
+
+		err := pb.waitUntilHealthy(ctx, instanceId, url, done, config)
+		if err == nil || retry == maxBindRetries || ctx.Err() != nil {
+			return err
+		}
+
+		pb.mu.Lock()
+		if inst.state != ContainerStateExited || !isBindFailure(inst.logs.Tail(5)) {
+			pb.mu.Unlock()
+			return err
+		}
+		pb.log.Warn("Process failed to bind its port, starting it again", "process", instanceId, "port", inst.port)
+		err = pb.launch(inst)
+		pb.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// waitUntilHealthy waits for the process at url to be healthy, giving up as soon as done is closed
+func (pb *ProcessBackend) waitUntilHealthy(ctx context.Context, instanceId string, url string, done chan struct{}, config data.FunctionConfig) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return waitUntilHealthy(ctx, pb.log, instanceId, url, config)
+}
+
+func (pb *ProcessBackend) Restart(ctx context.Context, instanceId string) error {
+	if err := pb.Stop(instanceId); err != nil {
+		return err
+	}
+
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	inst, exists := pb.instances[instanceId]
+	if !exists {
+		return errors.NewNotFoundError(fmt.Sprintf("process '%s' not found", instanceId))
+	}
+	// The invocation that cold started the instance didn't trigger this start
+	inst.config.EnvVars = withoutInvocationEnv(inst.config.EnvVars)
+	if err := pb.launch(inst); err != nil {
+		return err
+	}
+	pb.log.Infof("Restarted process %s", instanceId)
+	return nil
+}
+
+// Stop asks the process to exit, killing it if it hasn't within the stop timeout
+func (pb *ProcessBackend) Stop(instanceId string) error {
+	inst, err := pb.getInstance(instanceId)
+	if err != nil {
+		return err
+	}
+
+	pb.mu.Lock()
+	if inst.state != ContainerStateRunning {
+		pb.mu.Unlock()
+		return nil
+	}
+	pb.registry.ExpectStop(instanceId)
+	cmd, done := inst.cmd, inst.done
+	pb.mu.Unlock()
+
+	if err := terminateProcess(cmd); err != nil {
+		pb.log.Errorf("Failed to terminate process %s: %v", instanceId, err)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(processStopTimeout):
+		pb.log.Errorf("Process %s did not exit within %s, killing it", instanceId, processStopTimeout)
+		if err := killProcess(cmd); err != nil {
+			return errors.NewDockerError(fmt.Sprintf("error killing process: %v", err))
+		}
+		<-done
+	}
+	pb.log.Infof("Stopped process %s", instanceId)
+	return nil
+}
+
+func (pb *ProcessBackend) StopFunction(functionId string) {
+	pb.log.Infof("Stopping processes for function '%s' ", functionId)
+	running, _ := pb.ListRunning(context.Background(), functionId)
+	for _, instanceId := range running {
+		if err := pb.Stop(instanceId); err != nil {
+			pb.log.Errorf("Failed to stop process %s: %v", instanceId, err)
+		}
+	}
+}
+
+func (pb *ProcessBackend) Remove(ctx context.Context, instanceId string) error {
+	inst, err := pb.getInstance(instanceId)
+	if err != nil {
+		return err
+	}
+	if err := pb.Stop(instanceId); err != nil {
+		return err
+	}
+
+	pb.mu.Lock()
+	delete(pb.instances, instanceId)
+	pb.mu.Unlock()
+
+	pb.registry.ContainerDestroyed(inst.functionId, instanceId, time.Now())
+	pb.log.Infof("Removed process %s", instanceId)
+	return nil
+}
+
+func (pb *ProcessBackend) ListRunning(ctx context.Context, functionId string) ([]string, error) {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	ids := []string{}
+	for _, inst := range pb.instances {
+		if inst.functionId == functionId && inst.state == ContainerStateRunning {
+			ids = append(ids, inst.id)
+		}
+	}
+	return ids, nil
+}
+
+func (pb *ProcessBackend) ListInstances(ctx context.Context) ([]ContainerRecord, error) {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	records := make([]ContainerRecord, 0, len(pb.instances))
+	for _, inst := range pb.instances {
+		records = append(records, inst.record())
+	}
+	return records, nil
+}
+
+func (pb *ProcessBackend) Logs(ctx context.Context, instanceId string, tail int) (string, error) {
+	inst, err := pb.getInstance(instanceId)
+	if err != nil {
+		return "", err
+	}
+	return inst.logs.Tail(tail), nil
+}
+
+// launch starts the process for an instance, it must be called with the lock held
+func (pb *ProcessBackend) launch(inst *processInstance) error {
+	name, args, err := processCommand(pb.binariesDir, inst.functionId, inst.config)
+	if err != nil {
+		return err
+	}
+
+	preferred := 0
+	if inst.config.Port != nil {
+		preferred = *inst.config.Port
+	}
+	port, err := allocatePort(preferred, pb.usedPorts())
+	if err != nil {
+		return errors.NewDockerError(fmt.Sprintf("error allocating port for process: %v", err))
+	}
+
+	workDir, err := os.MkdirTemp("", "jambda-"+inst.functionId+"-")
+	if err != nil {
+		return errors.NewDockerError(fmt.Sprintf("error creating process working directory: %v", err))
+	}
+
+	if inst.logs == nil {
+		inst.logs = newLogBuffer(maxProcessLogBytes)
+	}
+
+	cmd, launcherEnv, err := sandboxCommand(pb.sandbox, workDir, name, args...)
+	if err != nil {
+		os.RemoveAll(workDir)
+		return errors.NewDockerError(fmt.Sprintf("error sandboxing process: %v", err))
+	}
+	cmd.Dir = workDir
+	cmd.Env = append(processEnv(inst.config, workDir, port), launcherEnv...)
+	cmd.Stdout = inst.logs
+	cmd.Stderr = inst.logs
+
+	pb.log.Infof("Running command for process '%s': '%s %s' on port %d", inst.id, name, strings.Join(args, " "), port)
+	if err := cmd.Start(); err != nil {
+		os.RemoveAll(workDir)
+		pb.log.Error("Failed to start process: ", err)
+		return errors.NewDockerError(fmt.Sprintf("error starting process: %v", err))
+	}
+
+	inst.cmd = cmd
+	inst.port = port
+	inst.workDir = workDir
+	inst.state = ContainerStateRunning
+	inst.startedAt = time.Now()
+	inst.finishedAt = time.Time{}
+	inst.exitCode = 0
+	inst.done = make(chan struct{})
+
+	pb.registry.ContainerStarted(inst.record())
+	go pb.wait(inst, cmd, inst.done)
+	return nil
+}
+
+// wait records the exit of a process, reporting it to the registry like a container dying
+func (pb *ProcessBackend) wait(inst *processInstance, cmd *exec.Cmd, done chan struct{}) {
+	cmd.Wait()
+	exitCode := cmd.ProcessState.ExitCode()
+	now := time.Now()
+
+	pb.mu.Lock()
+	inst.state = ContainerStateExited
+	inst.finishedAt = now
+	inst.exitCode = exitCode
+	os.RemoveAll(inst.workDir)
+	close(done)
+	pb.mu.Unlock()
+
+	pb.registry.ContainerDied(inst.functionId, inst.id, exitCode, now)
+}
+
+func (pb *ProcessBackend) getInstance(instanceId string) (*processInstance, error) {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	inst, exists := pb.instances[instanceId]
+	if !exists {
+		return nil, errors.NewNotFoundError(fmt.Sprintf("process '%s' not found", instanceId))
+	}
+	return inst, nil
+}
+
+// record must be called with the lock held
+func (inst *processInstance) record() ContainerRecord {
+	return ContainerRecord{
+		ContainerId: inst.id,
+		FunctionId:  inst.functionId,
+		State:       inst.state,
+		Ports:       map[string]string{fmt.Sprintf("%d/tcp", inst.port): fmt.Sprintf("%d", inst.port)},
+		StartedAt:   inst.startedAt,
+		FinishedAt:  inst.finishedAt,
+		ExitCode:    inst.exitCode,
+	}
+}
+
+// processCommand returns the command to run a function's uploaded binary
+func processCommand(binariesDir string, functionId string, config data.FunctionConfig) (string, []string, error) {
+	var binaryPath string
+	var name string
+	var args []string
+	switch {
+	case strings.Contains(config.Image, "golang"):
+		binaryPath = filepath.Join(binariesDir, functionId, "bootstrap")
+	case strings.Contains(config.Image, "jdk"):
+		binaryPath = filepath.Join(binariesDir, functionId, "bootstrap.jar")
+		name = "java"
+	default:
+		return "", nil, errors.NewValidationError(fmt.Sprintf("image '%s' is not supported by the process backend", config.Image))
+	}
+
+	absPath, err := filepath.Abs(binaryPath)
+	if err != nil {
+		return "", nil, errors.NewInternalError(fmt.Sprintf("error resolving binary path: %v", err))
+	}
+	if _, err := os.Stat(absPath); err != nil {
+		return "", nil, errors.NewNotFoundError(fmt.Sprintf("binary for function '%s' not found: %v", functionId, err))
+	}
+
+	if name == "" {
+		return absPath, nil, nil
+	}
+	args = []string{"-jar", absPath}
+	return name, args, nil
+}
+
+// processEnv is the only environment a process sees, so nothing leaks from jambda's own environment
+func processEnv(config data.FunctionConfig, workDir string, port int) []string {
+	env := []string{
+		"PATH=" + os.Getenv("PATH"),
+		"HOME=" + workDir,
+		"TMPDIR=" + workDir,
+		fmt.Sprintf("PORT=%d", port),
+	}
+	for key, value := range config.EnvVars {
+		env = append(env, key+"="+value)
+	}
+	return env
+}
+
+// parseProcessUser parses the numeric 'uid:gid' of a ProcessSandbox's user
+func parseProcessUser(user string) (int, int, error) {
+	uidValue, gidValue, found := strings.Cut(user, ":")
+	if !found {
+		return 0, 0, fmt.Errorf("invalid process user '%s', must be 'uid:gid'", user)
+	}
+	uid, err := strconv.Atoi(uidValue)
+	if err != nil || uid < 0 {
+		return 0, 0, fmt.Errorf("invalid uid '%s' of process user", uidValue)
+	}
+	gid, err := strconv.Atoi(gidValue)
+	if err != nil || gid < 0 {
+		return 0, 0, fmt.Errorf("invalid gid '%s' of process user", gidValue)
+	}
+	return uid, gid, nil
+}
+
+// usedPorts are the ports given to running processes, which may not be listening yet. It must be called with the lock held.
+func (pb *ProcessBackend) usedPorts() map[int]bool {
+	used := make(map[int]bool)
+	for _, inst := range pb.instances {
+		if inst.state == ContainerStateRunning {
+			used[inst.port] = true
+		}
+	}
+	return used
+}
+
+// allocatePort returns the preferred port if it's free, otherwise any free port. Ports in used are skipped even when
+// nothing is listening on them, so processes started together never share a port before they've bound it.
+func allocatePort(preferred int, used map[int]bool) (int, error) {
+	if preferred > 0 && !used[preferred] {
+		if l, err := net.Listen("tcp", fmt.Sprintf(":%d", preferred)); err == nil {
+			l.Close()
+			return preferred, nil
+		}
+	}
+
+	for attempt := 0; attempt < maxPortAttempts; attempt++ {
+		l, err := net.Listen("tcp", ":0")
+		if err != nil {
+			return 0, err
+		}
+		port := l.Addr().(*net.TCPAddr).Port
+		l.Close()
+		if !used[port] {
+			return port, nil
+		}
+	}
+	return 0, fmt.Errorf("no free port after %d attempts", maxPortAttempts)
+}
+
+// isBindFailure is whether a process exited because its port was taken between being allocated and the process listening on it
+func isBindFailure(logs string) bool {
+	return strings.Contains(logs, "address already in use")
+}
+
+// logBuffer keeps the most recent output of a process in memory
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+	max int
+}
+
+func newLogBuffer(max int) *logBuffer {
+	return &logBuffer{max: max}
+}
+
+func (lb *logBuffer) Write(p []byte) (int, error) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	lb.buf.Write(p)
+	if over := lb.buf.Len() - lb.max; over > 0 {
+		lb.buf.Next(over)
+	}
+	return len(p), nil
+}
+
+// Tail returns the last n lines written, or everything if n is 0
+func (lb *logBuffer) Tail(n int) string {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	output := lb.buf.String()
+	if n <= 0 {
+		return output
+	}
+
+	lines := strings.SplitAfter(output, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "")
+}
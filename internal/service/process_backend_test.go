@@ -0,0 +1,202 @@
+package service
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jwtly10/jambda/api/data"
+	"github.com/jwtly10/jambda/internal/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zapcore"
+)
+
+// writeBootstrap writes a shell script as the function's binary, so the backend can be tested without compiling a function
+func writeBootstrap(t *testing.T, binariesDir string, functionId string, script string) {
+	dir := filepath.Join(binariesDir, functionId)
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "bootstrap"), []byte("#!/bin/sh\n"+script), 0755))
+}
+
+func TestProcessBackendLifecycle(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("process backend tests use shell scripts")
+	}
+
+	logger := logging.NewLogger(false, zapcore.DebugLevel)
+	registry := NewContainerRegistry(logger)
+	binariesDir := t.TempDir()
+	backend := NewProcessBackend(logger, registry, binariesDir, ProcessSandbox{})
+	config := data.FunctionConfig{Image: "golang:1.22", EnvVars: map[string]string{"GREETING": "hello"}}
+	ctx := context.Background()
+
+	writeBootstrap(t, binariesDir, "fn", "echo \"$GREETING from port $PORT\"\nexec sleep 30\n")
+
+	instanceId, err := backend.StartInstance(ctx, "fn", config)
+	require.NoError(t, err)
+	assert.NoError(t, backend.WaitForRunning(ctx, instanceId))
+
+	running, err := backend.ListRunning(ctx, "fn")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{instanceId}, running)
+
+	assert.Eventually(t, func() bool {
+		logs, _ := backend.Logs(ctx, instanceId, 1)
+		return logs != ""
+	}, time.Second, 10*time.Millisecond)
+	logs, err := backend.Logs(ctx, instanceId, 0)
+	assert.NoError(t, err)
+	assert.Contains(t, logs, "hello from port")
+
+	// Stops requested by jambda are not crashes
+	assert.NoError(t, backend.Stop(instanceId))
+	record, found := registry.GetContainer(instanceId)
+	assert.True(t, found)
+	assert.Equal(t, ContainerStateExited, record.State)
+	assert.Empty(t, registry.GetFunctionContainers("fn").Crashes)
+
+	// Stopped processes are reused by the next start
+	restartedId, err := backend.StartInstance(ctx, "fn", config)
+	assert.NoError(t, err)
+	assert.Equal(t, instanceId, restartedId)
+
+	assert.NoError(t, backend.Remove(ctx, instanceId))
+	_, found = registry.GetContainer(instanceId)
+	assert.False(t, found)
+	instances, err := backend.ListInstances(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, instances)
+}
+
+func TestProcessBackendRecordsCrashes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("process backend tests use shell scripts")
+	}
+
+	logger := logging.NewLogger(false, zapcore.DebugLevel)
+	registry := NewContainerRegistry(logger)
+	binariesDir := t.TempDir()
+	backend := NewProcessBackend(logger, registry, binariesDir, ProcessSandbox{})
+	ctx := context.Background()
+
+	writeBootstrap(t, binariesDir, "fn", "exit 3\n")
+
+	instanceId, err := backend.StartInstance(ctx, "fn", data.FunctionConfig{Image: "golang:1.22"})
+	require.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		return len(registry.GetFunctionContainers("fn").Crashes) == 1
+	}, time.Second, 10*time.Millisecond)
+	crash := registry.GetFunctionContainers("fn").Crashes[0]
+	assert.Equal(t, instanceId, crash.ContainerId)
+	assert.Equal(t, 3, crash.ExitCode)
+	assert.Error(t, backend.WaitForRunning(ctx, instanceId))
+}
+
+func TestProcessBackendMissingBinary(t *testing.T) {
+	logger := logging.NewLogger(false, zapcore.DebugLevel)
+	backend := NewProcessBackend(logger, NewContainerRegistry(logger), t.TempDir(), ProcessSandbox{})
+
+	_, err := backend.StartInstance(context.Background(), "missing", data.FunctionConfig{Image: "golang:1.22"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "binary for function 'missing' not found")
+}
+
+func TestProcessBackendSandboxLimits(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the process sandbox is only applied on linux")
+	}
+
+	logger := logging.NewLogger(false, zapcore.DebugLevel)
+	binariesDir := t.TempDir()
+	backend := NewProcessBackend(logger, NewContainerRegistry(logger), binariesDir, ProcessSandbox{MaxMemory: 1 << 30, MaxProcesses: 4096})
+	ctx := context.Background()
+
+	writeBootstrap(t, binariesDir, "fn", "echo \"launcher env: [$JAMBDA_SANDBOX]\"\ncat /proc/self/limits\nexec sleep 30\n")
+
+	instanceId, err := backend.StartInstance(ctx, "fn", data.FunctionConfig{Image: "golang:1.22"})
+	require.NoError(t, err)
+	defer backend.Remove(ctx, instanceId)
+
+	var logs string
+	assert.Eventually(t, func() bool {
+		logs, _ = backend.Logs(ctx, instanceId, 0)
+		return strings.Contains(logs, "Max address space")
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Regexp(t, `Max address space\s+1073741824\s+1073741824`, logs)
+	assert.Regexp(t, `Max processes\s+4096\s+4096`, logs)
+	// The launcher's env var doesn't reach the function
+	assert.Contains(t, logs, "launcher env: []")
+}
+
+func TestParseProcessUser(t *testing.T) {
+	uid, gid, err := parseProcessUser("65534:65533")
+	assert.NoError(t, err)
+	assert.Equal(t, 65534, uid)
+	assert.Equal(t, 65533, gid)
+
+	for _, user := range []string{"nobody", "65534", "a:1", "1:-1"} {
+		_, _, err := parseProcessUser(user)
+		assert.Error(t, err, user)
+	}
+}
+
+func TestAllocatePortSkipsUsedPorts(t *testing.T) {
+	l, err := net.Listen("tcp", ":0")
+	require.NoError(t, err)
+	free := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	// A free port given to a process that isn't listening yet isn't handed out again
+	port, err := allocatePort(free, map[int]bool{})
+	assert.NoError(t, err)
+	assert.Equal(t, free, port)
+
+	port, err = allocatePort(free, map[int]bool{free: true})
+	assert.NoError(t, err)
+	assert.NotEqual(t, free, port)
+}
+
+func TestLogBufferTail(t *testing.T) {
+	lb := newLogBuffer(16)
+	lb.Write([]byte("one\ntwo\n"))
+	lb.Write([]byte("three\nfour\n"))
+
+	// Only the most recent bytes are kept
+	assert.Equal(t, "\ntwo\nthree\nfour\n", lb.Tail(0))
+	assert.Equal(t, "three\nfour\n", lb.Tail(2))
+	assert.Equal(t, "four\n", lb.Tail(1))
+}
+
+func TestProcessBackendDropsUser(t *testing.T) {
+	if runtime.GOOS != "linux" || os.Geteuid() != 0 {
+		t.Skip("processes only change user on linux when jambda runs as root")
+	}
+
+	logger := logging.NewLogger(false, zapcore.DebugLevel)
+	binariesDir := t.TempDir()
+	// The function's user needs to reach its binary
+	require.NoError(t, os.Chmod(binariesDir, 0755))
+	require.NoError(t, os.Chmod(filepath.Dir(binariesDir), 0755))
+	backend := NewProcessBackend(logger, NewContainerRegistry(logger), binariesDir, ProcessSandbox{User: "65534:65534"})
+	ctx := context.Background()
+
+	writeBootstrap(t, binariesDir, "fn", "echo \"user $(id -u):$(id -g)\"\ntouch \"$HOME/written\" && echo \"home writable\"\nexec sleep 30\n")
+
+	instanceId, err := backend.StartInstance(ctx, "fn", data.FunctionConfig{Image: "golang:1.22"})
+	require.NoError(t, err)
+	defer backend.Remove(ctx, instanceId)
+
+	var logs string
+	assert.Eventually(t, func() bool {
+		logs, _ = backend.Logs(ctx, instanceId, 0)
+		return strings.Contains(logs, "home writable")
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Contains(t, logs, "user 65534:65534")
+}
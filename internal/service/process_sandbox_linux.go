@@ -0,0 +1,119 @@
+//go:build linux
+
+package service
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+)
+
+// rlimitNproc is RLIMIT_NPROC, which the syscall package doesn't define
+const rlimitNproc = 0x6
+
+// RunSandboxLauncher applies the sandbox to jambda's own process, then execs the function's process in its place.
+// It must only be called when IsSandboxLauncher, and never returns.
+func RunSandboxLauncher() {
+	spec := os.Getenv(sandboxLauncherEnv)
+	os.Unsetenv(sandboxLauncherEnv)
+	err := launchSandboxed(spec, os.Args[1:])
+	fmt.Fprintf(os.Stderr, "jambda: error launching sandboxed process: %v\n", err)
+	os.Exit(126)
+}
+
+// sandboxAttributes runs each process in its own process group, so the whole tree can be signalled,
+// and kills it if jambda dies so processes are never left running unmanaged
+func sandboxAttributes() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{
+		Setpgid:   true,
+		Pdeathsig: syscall.SIGKILL,
+	}
+}
+
+// sandboxCommand returns the command running a function's process in the sandbox. When the sandbox limits or drops
+// the user of the process, the command runs jambda itself as the launcher, see RunSandboxLauncher.
+func sandboxCommand(sandbox ProcessSandbox, workDir string, name string, args ...string) (*exec.Cmd, []string, error) {
+	uid, gid := -1, -1
+	if sandbox.User != "" && os.Geteuid() == 0 {
+		var err error
+		if uid, gid, err = parseProcessUser(sandbox.User); err != nil {
+			return nil, nil, err
+		}
+		if err := os.Chown(workDir, uid, gid); err != nil {
+			return nil, nil, fmt.Errorf("error changing owner of working directory: %v", err)
+		}
+	}
+
+	if uid < 0 && sandbox.MaxMemory == 0 && sandbox.MaxProcesses == 0 {
+		cmd := exec.Command(name, args...)
+		cmd.SysProcAttr = sandboxAttributes()
+		return cmd, nil, nil
+	}
+
+	cmd := exec.Command("/proc/self/exe", append([]string{name}, args...)...)
+	cmd.SysProcAttr = sandboxAttributes()
+	env := []string{fmt.Sprintf("%s=%d %d %d %d", sandboxLauncherEnv, uid, gid, sandbox.MaxMemory, sandbox.MaxProcesses)}
+	return cmd, env, nil
+}
+
+// launchSandboxed runs in the launcher, applying the sandbox before exec'ing the function. It only returns on error.
+func launchSandboxed(spec string, args []string) error {
+	var uid, gid int
+	var maxMemory, maxProcesses uint64
+	if _, err := fmt.Sscanf(spec, "%d %d %d %d", &uid, &gid, &maxMemory, &maxProcesses); err != nil {
+		return fmt.Errorf("invalid sandbox '%s': %v", spec, err)
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("no command to run")
+	}
+
+	// Process attributes are per thread, and must be set on the thread that execs
+	runtime.LockOSThread()
+
+	if maxMemory > 0 {
+		if err := syscall.Setrlimit(syscall.RLIMIT_AS, &syscall.Rlimit{Cur: maxMemory, Max: maxMemory}); err != nil {
+			return fmt.Errorf("error limiting memory: %v", err)
+		}
+	}
+	if maxProcesses > 0 {
+		if err := syscall.Setrlimit(rlimitNproc, &syscall.Rlimit{Cur: maxProcesses, Max: maxProcesses}); err != nil {
+			return fmt.Errorf("error limiting processes: %v", err)
+		}
+	}
+
+	if uid >= 0 {
+		if err := syscall.Setgroups(nil); err != nil {
+			return fmt.Errorf("error dropping groups: %v", err)
+		}
+		if err := syscall.Setgid(gid); err != nil {
+			return fmt.Errorf("error changing group: %v", err)
+		}
+		if err := syscall.Setuid(uid); err != nil {
+			return fmt.Errorf("error changing user: %v", err)
+		}
+		// Changing user clears the parent death signal
+		if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, syscall.PR_SET_PDEATHSIG, uintptr(syscall.SIGKILL), 0); errno != 0 {
+			return fmt.Errorf("error setting parent death signal: %v", errno)
+		}
+		// jambda may have died before the signal was set again
+		if os.Getppid() == 1 {
+			return fmt.Errorf("jambda exited")
+		}
+	}
+
+	path, err := exec.LookPath(args[0])
+	if err != nil {
+		return err
+	}
+	return syscall.Exec(path, args, os.Environ())
+}
+
+func terminateProcess(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+}
+
+func killProcess(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
@@ -0,0 +1,39 @@
+//go:build !linux
+
+package service
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// sandboxAttributes has no process group support outside of linux, only the process itself is signalled
+func sandboxAttributes() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{}
+}
+
+// sandboxCommand runs the process directly outside of linux, without dropping its user or limiting its resources
+func sandboxCommand(sandbox ProcessSandbox, workDir string, name string, args ...string) (*exec.Cmd, []string, error) {
+	cmd := exec.Command(name, args...)
+	cmd.SysProcAttr = sandboxAttributes()
+	return cmd, nil, nil
+}
+
+// RunSandboxLauncher never runs outside of linux, as processes aren't launched through jambda there
+func RunSandboxLauncher() {
+	fmt.Fprintln(os.Stderr, "jambda: sandboxed processes are only launched on linux")
+	os.Exit(126)
+}
+
+func terminateProcess(cmd *exec.Cmd) error {
+	if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		return cmd.Process.Kill()
+	}
+	return nil
+}
+
+func killProcess(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
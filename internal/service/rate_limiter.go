@@ -0,0 +1,151 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/jwtly10/jambda/api/data"
+	"github.com/jwtly10/jambda/internal/errors"
+	"github.com/jwtly10/jambda/internal/logging"
+)
+
+// rateLimitIdle is how long a client's bucket is kept after its last request
+const rateLimitIdle = time.Hour
+
+// maxRateLimitKeys is the most buckets, and the most quotas, kept in memory at once
+const maxRateLimitKeys = 100_000
+
+// tokenBucket allows bursts of up to burst requests, refilling at rps tokens per second
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func (b *tokenBucket) refill(now time.Time, rps float64, burst int) {
+	b.tokens = math.Min(float64(burst), b.tokens+now.Sub(b.last).Seconds()*rps)
+	b.last = now
+}
+
+// dailyQuota counts requests on a UTC day
+type dailyQuota struct {
+	day   string
+	count int
+}
+
+// RateLimitService enforces the rate limits and daily quotas of functions.
+// Counts are kept in memory, so quotas start again when jambda restarts.
+type RateLimitService struct {
+	log     logging.Logger
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	quotas  map[string]*dailyQuota
+	maxKeys int
+}
+
+func NewRateLimitService(log logging.Logger) *RateLimitService {
+	return &RateLimitService{
+		log:     log,
+		buckets: make(map[string]*tokenBucket),
+		quotas:  make(map[string]*dailyQuota),
+		maxKeys: maxRateLimitKeys,
+	}
+}
+
+// Allow records a request by the client key to the function, returning a RateLimitError if it's over the function's limits.
+// Rejected requests don't count towards the quota.
+func (rl *RateLimitService) Allow(functionId string, key string, config data.RateLimitConfig, now time.Time) error {
+	id := functionId + "/" + key
+	now = now.UTC()
+	today := now.Format(time.DateOnly)
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	var quota *dailyQuota
+	if config.DailyQuota > 0 {
+		quota = rl.quotas[id]
+		if quota == nil || quota.day != today {
+			if quota == nil {
+				evictIfFull(rl.quotas, rl.maxKeys)
+			}
+			quota = &dailyQuota{day: today}
+			rl.quotas[id] = quota
+		}
+		if quota.count >= config.DailyQuota {
+			midnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+			return errors.NewRateLimitError(fmt.Sprintf("daily quota of %d requests exceeded", config.DailyQuota), midnight.Sub(now))
+		}
+	}
+
+	if config.RPS > 0 {
+		burst := rateLimitBurst(config)
+		bucket := rl.buckets[id]
+		if bucket == nil {
+			evictIfFull(rl.buckets, rl.maxKeys)
+			bucket = &tokenBucket{tokens: float64(burst), last: now}
+			rl.buckets[id] = bucket
+		}
+		bucket.refill(now, config.RPS, burst)
+		if bucket.tokens < 1 {
+			wait := time.Duration((1 - bucket.tokens) / config.RPS * float64(time.Second))
+			return errors.NewRateLimitError(fmt.Sprintf("rate limit of %v requests per second exceeded", config.RPS), wait)
+		}
+		bucket.tokens--
+	}
+
+	if quota != nil {
+		quota.count++
+	}
+	return nil
+}
+
+// Run forgets idle buckets and quotas of previous days every interval, so clients that stopped sending requests don't use memory
+func (rl *RateLimitService) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		rl.prune(time.Now())
+	}
+}
+
+func (rl *RateLimitService) prune(now time.Time) {
+	now = now.UTC()
+	today := now.Format(time.DateOnly)
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	// Limits below one request per hour may be reset early, as the limits of a bucket aren't known here
+	for id, bucket := range rl.buckets {
+		if now.Sub(bucket.last) > rateLimitIdle {
+			delete(rl.buckets, id)
+		}
+	}
+	for id, quota := range rl.quotas {
+		if quota.day != today {
+			delete(rl.quotas, id)
+		}
+	}
+}
+
+// evictIfFull drops an entry from a full map before another is added, so clients coming from many addresses can't grow it without bound.
+// The dropped client starts with a fresh limit, which is preferred over rejecting new clients.
+func evictIfFull[V any](m map[string]V, max int) {
+	if len(m) < max {
+		return
+	}
+	for id := range m {
+		delete(m, id)
+		return
+	}
+}
+
+func rateLimitBurst(config data.RateLimitConfig) int {
+	if config.Burst > 0 {
+		return config.Burst
+	}
+	return int(math.Ceil(config.RPS))
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jwtly10/jambda/api/data"
+	"github.com/jwtly10/jambda/internal/errors"
+	"github.com/jwtly10/jambda/internal/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestRateLimitBurstAndRefill(t *testing.T) {
+	logger := logging.NewLogger(false, zapcore.DebugLevel)
+	rl := NewRateLimitService(logger)
+	config := data.RateLimitConfig{RPS: 2, Burst: 3}
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, rl.Allow("fn", "ip:10.0.0.1", config, now))
+	}
+
+	err := rl.Allow("fn", "ip:10.0.0.1", config, now)
+	var rateLimitErr *errors.RateLimitError
+	require.ErrorAs(t, err, &rateLimitErr)
+	assert.Equal(t, 500*time.Millisecond, rateLimitErr.RetryAfter)
+
+	// Other clients have their own bucket
+	assert.NoError(t, rl.Allow("fn", "ip:10.0.0.2", config, now))
+
+	// Tokens refill at rps
+	assert.NoError(t, rl.Allow("fn", "ip:10.0.0.1", config, now.Add(500*time.Millisecond)))
+	assert.Error(t, rl.Allow("fn", "ip:10.0.0.1", config, now.Add(500*time.Millisecond)))
+
+	// Burst defaults to rps rounded up
+	assert.NoError(t, rl.Allow("other", "", data.RateLimitConfig{RPS: 0.5}, now))
+	assert.Error(t, rl.Allow("other", "", data.RateLimitConfig{RPS: 0.5}, now))
+}
+
+func TestRateLimitKeysAreCapped(t *testing.T) {
+	logger := logging.NewLogger(false, zapcore.DebugLevel)
+	rl := NewRateLimitService(logger)
+	rl.maxKeys = 2
+	config := data.RateLimitConfig{RPS: 1, DailyQuota: 10}
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, key := range []string{"ip:10.0.0.1", "ip:10.0.0.2", "ip:10.0.0.3", "ip:10.0.0.4"} {
+		assert.NoError(t, rl.Allow("fn", key, config, now))
+	}
+	assert.Len(t, rl.buckets, 2)
+	assert.Len(t, rl.quotas, 2)
+}
+
+func TestRateLimitDailyQuota(t *testing.T) {
+	logger := logging.NewLogger(false, zapcore.DebugLevel)
+	rl := NewRateLimitService(logger)
+	config := data.RateLimitConfig{RPS: 1, DailyQuota: 2}
+	now := time.Date(2024, 6, 1, 23, 0, 0, 0, time.UTC)
+
+	assert.NoError(t, rl.Allow("fn", "key:a", config, now))
+	// Rate limited requests don't use the quota
+	assert.Error(t, rl.Allow("fn", "key:a", config, now))
+	assert.NoError(t, rl.Allow("fn", "key:a", config, now.Add(time.Second)))
+
+	err := rl.Allow("fn", "key:a", config, now.Add(2*time.Second))
+	var rateLimitErr *errors.RateLimitError
+	require.ErrorAs(t, err, &rateLimitErr)
+	assert.Contains(t, rateLimitErr.Message, "daily quota")
+	assert.Equal(t, time.Hour-2*time.Second, rateLimitErr.RetryAfter)
+
+	// The quota starts again on the next UTC day
+	nextDay := now.Add(time.Hour)
+	assert.NoError(t, rl.Allow("fn", "key:a", config, nextDay))
+
+	rl.prune(nextDay.Add(2 * time.Hour))
+	assert.Empty(t, rl.buckets)
+	assert.Len(t, rl.quotas, 1)
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/jwtly10/jambda/api/data"
+	"github.com/jwtly10/jambda/internal/logging"
+)
+
+const (
+	// reconcileTimeout bounds a single reconcile pass, including health checking adopted containers
+	reconcileTimeout = 2 * time.Minute
+
+	// adoptGracePeriod skips recently started containers, as they may still be starting under the instance pool
+	adoptGracePeriod = time.Minute
+)
+
+// ReconcilerService keeps the instances of the execution backend in line with the functions in the database.
+// Containers of deleted or unknown functions are removed, and running containers jambda has lost track of,
+// e.g after a restart, are adopted so they are load balanced, autoscaled and eventually stopped when idle.
+type ReconcilerService struct {
+	log     logging.Logger
+	ps      *InstancePoolService
+	backend ExecutionBackend
+	fs      FunctionService
+	rs      *RequestStatsService
+}
+
+func NewReconcilerService(log logging.Logger, ps *InstancePoolService, backend ExecutionBackend, fs FunctionService, rs *RequestStatsService) *ReconcilerService {
+	return &ReconcilerService{
+		log:     log,
+		ps:      ps,
+		backend: backend,
+		fs:      fs,
+		rs:      rs,
+	}
+}
+
+// Run reconciles every interval, it never returns
+func (rc *ReconcilerService) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		rc.Reconcile()
+	}
+}
+
+// Reconcile runs a single pass, removing orphaned containers and adopting untracked running ones
+func (rc *ReconcilerService) Reconcile() {
+	ctx, cancel := context.WithTimeout(context.Background(), reconcileTimeout)
+	defer cancel()
+
+	functions, err := rc.fs.GetAllActiveFunctions()
+	if err != nil {
+		// Without the functions we can't tell what is orphaned, so leave everything alone
+		rc.log.Errorf("Failed to get active functions to reconcile: %v", err)
+		return
+	}
+	active := make(map[string]data.FunctionConfig, len(functions))
+	for _, function := range functions {
+		if function.Configuration != nil {
+			active[function.ExternalId] = *function.Configuration
+		}
+	}
+
+	containers, err := rc.backend.ListInstances(ctx)
+	if err != nil {
+		rc.log.Errorf("Failed to list containers to reconcile: %v", err)
+		return
+	}
+
+	orphaned, untracked := planReconcile(active, containers, rc.isTracked, time.Now())
+
+	for _, record := range orphaned {
+		rc.log.Infof("Removing orphaned container '%s' of deleted or unknown function '%s'", record.ContainerId, record.FunctionId)
+		if err := rc.backend.Remove(ctx, record.ContainerId); err != nil {
+			rc.log.Errorf("Failed to remove orphaned container '%s': %v", record.ContainerId, err)
+		}
+	}
+
+	for _, functionId := range untracked {
+		rc.log.Infof("Adopting untracked running containers of function '%s'", functionId)
+		rc.rs.TrackFunction(functionId)
+		if _, err := rc.ps.Adopt(ctx, functionId, active[functionId]); err != nil {
+			rc.log.Errorf("Failed to adopt containers of function '%s': %v", functionId, err)
+		}
+	}
+}
+
+// RemoveFunction stops and removes every container of a function in the background, used when a function is deleted
+func (rc *ReconcilerService) RemoveFunction(functionId string) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), reconcileTimeout)
+		defer cancel()
+
+		rc.ps.StopFunction(functionId)
+		for _, containerId := range rc.functionContainers(ctx, functionId) {
+			if err := rc.backend.Remove(ctx, containerId); err != nil {
+				rc.log.Errorf("Failed to remove container '%s' of deleted function '%s': %v", containerId, functionId, err)
+			}
+		}
+	}()
+}
+
+func (rc *ReconcilerService) functionContainers(ctx context.Context, functionId string) []string {
+	containers, err := rc.backend.ListInstances(ctx)
+	if err != nil {
+		rc.log.Errorf("Failed to list containers of function '%s': %v", functionId, err)
+		return nil
+	}
+
+	var ids []string
+	for _, record := range containers {
+		if record.FunctionId == functionId {
+			ids = append(ids, record.ContainerId)
+		}
+	}
+	return ids
+}
+
+func (rc *ReconcilerService) isTracked(functionId string, containerId string) bool {
+	for _, inst := range rc.ps.GetInstances(functionId) {
+		if inst.ContainerId == containerId {
+			return true
+		}
+	}
+	return false
+}
+
+// planReconcile returns the containers to remove as they belong to no active function,
+// and the active functions with running containers the instance pool isn't tracking
+func planReconcile(active map[string]data.FunctionConfig, containers []ContainerRecord, tracked func(functionId string, containerId string) bool, now time.Time) ([]ContainerRecord, []string) {
+	var orphaned []ContainerRecord
+	var untracked []string
+	seen := make(map[string]bool)
+
+	for _, record := range containers {
+		config, exists := active[record.FunctionId]
+		if !exists {
+			orphaned = append(orphaned, record)
+			continue
+		}
+
+		// Only REST functions are served from the instance pool
+		if config.Type != "REST" || record.State != ContainerStateRunning || seen[record.FunctionId] {
+			continue
+		}
+		if now.Sub(record.StartedAt) < adoptGracePeriod || tracked(record.FunctionId, record.ContainerId) {
+			continue
+		}
+		seen[record.FunctionId] = true
+		untracked = append(untracked, record.FunctionId)
+	}
+	return orphaned, untracked
+}
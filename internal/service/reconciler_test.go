@@ -0,0 +1,81 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jwtly10/jambda/api/data"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlanReconcile(t *testing.T) {
+	now := time.Now()
+	longAgo := now.Add(-time.Hour)
+
+	active := map[string]data.FunctionConfig{
+		"rest":   {Type: "REST"},
+		"single": {Type: "SINGLE"},
+	}
+
+	tests := []struct {
+		name              string
+		containers        []ContainerRecord
+		tracked           []string
+		expectedOrphaned  []string
+		expectedUntracked []string
+	}{
+		{
+			name: "containers of deleted or unknown functions are removed",
+			containers: []ContainerRecord{
+				{ContainerId: "c1", FunctionId: "deleted", State: ContainerStateRunning, StartedAt: longAgo},
+				{ContainerId: "c2", FunctionId: "unknown", State: ContainerStateExited},
+			},
+			expectedOrphaned: []string{"c1", "c2"},
+		},
+		{
+			name: "untracked running containers are adopted once per function",
+			containers: []ContainerRecord{
+				{ContainerId: "c1", FunctionId: "rest", State: ContainerStateRunning, StartedAt: longAgo},
+				{ContainerId: "c2", FunctionId: "rest", State: ContainerStateRunning, StartedAt: longAgo},
+			},
+			expectedUntracked: []string{"rest"},
+		},
+		{
+			name: "tracked, stopped and recently started containers are left alone",
+			containers: []ContainerRecord{
+				{ContainerId: "tracked", FunctionId: "rest", State: ContainerStateRunning, StartedAt: longAgo},
+				{ContainerId: "stopped", FunctionId: "rest", State: ContainerStateExited, StartedAt: longAgo},
+				{ContainerId: "starting", FunctionId: "rest", State: ContainerStateRunning, StartedAt: now.Add(-time.Second)},
+			},
+			tracked: []string{"tracked"},
+		},
+		{
+			name: "only rest functions are adopted",
+			containers: []ContainerRecord{
+				{ContainerId: "c1", FunctionId: "single", State: ContainerStateRunning, StartedAt: longAgo},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracked := func(functionId string, containerId string) bool {
+				for _, id := range tt.tracked {
+					if id == containerId {
+						return true
+					}
+				}
+				return false
+			}
+
+			orphaned, untracked := planReconcile(active, tt.containers, tracked, now)
+
+			var orphanedIds []string
+			for _, record := range orphaned {
+				orphanedIds = append(orphanedIds, record.ContainerId)
+			}
+			assert.Equal(t, tt.expectedOrphaned, orphanedIds)
+			assert.Equal(t, tt.expectedUntracked, untracked)
+		})
+	}
+}
@@ -7,25 +7,65 @@ import (
 	"github.com/jwtly10/jambda/internal/logging"
 )
 
+// rpsWindowSize is the sliding window used to calculate the requests per second of a function
+const rpsWindowSize = 30
+
 type FunctionStats struct {
 	RequestCount int
 	LastRequest  time.Time
+	InFlight     int
+	// Timeouts are the requests that the function didn't respond to within its timeout
+	Timeouts int
+	RPS      float64
+	window   rpsWindow
+}
+
+// rpsWindow counts requests in one second buckets over the last rpsWindowSize seconds
+type rpsWindow struct {
+	buckets [rpsWindowSize]int
+	seconds [rpsWindowSize]int64
+}
+
+func (w *rpsWindow) record(now time.Time) {
+	sec := now.Unix()
+	idx := sec % rpsWindowSize
+	if w.seconds[idx] != sec {
+		w.seconds[idx] = sec
+		w.buckets[idx] = 0
+	}
+	w.buckets[idx]++
+}
+
+func (w *rpsWindow) rate(now time.Time) float64 {
+	sec := now.Unix()
+	total := 0
+	for i := range w.buckets {
+		if sec-w.seconds[i] < rpsWindowSize {
+			total += w.buckets[i]
+		}
+	}
+	return float64(total) / rpsWindowSize
 }
 
 type RequestStatsService struct {
 	functionStats map[string]*FunctionStats
 	mu            sync.Mutex
 	log           logging.Logger
-	ds            DockerService
-	fs            FunctionService
 }
 
-func NewRequestStatsService(log logging.Logger, ds DockerService, fs FunctionService) *RequestStatsService {
+func NewRequestStatsService(log logging.Logger) *RequestStatsService {
 	return &RequestStatsService{
 		functionStats: make(map[string]*FunctionStats),
 		log:           log,
-		ds:            ds,
-		fs:            fs,
+	}
+}
+
+// TrackFunction starts tracking a function that hasn't been requested yet, e.g one adopted after a restart
+func (rs *RequestStatsService) TrackFunction(functionID string) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if _, exists := rs.functionStats[functionID]; !exists {
+		rs.functionStats[functionID] = &FunctionStats{}
 	}
 }
 
@@ -35,8 +75,51 @@ func (rs *RequestStatsService) IncrementRequestCount(functionID string) {
 	if _, exists := rs.functionStats[functionID]; !exists {
 		rs.functionStats[functionID] = &FunctionStats{}
 	}
-	rs.functionStats[functionID].RequestCount++
-	rs.functionStats[functionID].LastRequest = time.Now()
+	now := time.Now()
+	stats := rs.functionStats[functionID]
+	stats.RequestCount++
+	stats.InFlight++
+	stats.LastRequest = now
+	stats.window.record(now)
+}
+
+// CompleteRequest marks a request counted by IncrementRequestCount as finished
+func (rs *RequestStatsService) CompleteRequest(functionID string) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if stats, exists := rs.functionStats[functionID]; exists && stats.InFlight > 0 {
+		stats.InFlight--
+	}
+}
+
+// GetLoad returns the in flight requests and sliding window requests per second of a function
+func (rs *RequestStatsService) GetLoad(functionID string) (int, float64) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	stats, exists := rs.functionStats[functionID]
+	if !exists {
+		return 0, 0
+	}
+	return stats.InFlight, stats.window.rate(time.Now())
+}
+
+// RecordTimeout counts a request the function didn't respond to within its timeout
+func (rs *RequestStatsService) RecordTimeout(functionID string) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if _, exists := rs.functionStats[functionID]; !exists {
+		rs.functionStats[functionID] = &FunctionStats{}
+	}
+	rs.functionStats[functionID].Timeouts++
+}
+
+func (rs *RequestStatsService) GetTimeouts(functionID string) int {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if stats, exists := rs.functionStats[functionID]; exists {
+		return stats.Timeouts
+	}
+	return 0
 }
 
 func (rs *RequestStatsService) ResetRequestCount(functionID string, skipLock bool) {
@@ -59,31 +142,15 @@ func (rs *RequestStatsService) GetFunctionStats() map[string]*FunctionStats {
 	defer rs.mu.Unlock()
 	// Return a copy of the stats to avoid exposing internal state
 	copyStats := make(map[string]*FunctionStats)
+	now := time.Now()
 	for id, stats := range rs.functionStats {
 		copyStats[id] = &FunctionStats{
 			RequestCount: stats.RequestCount,
 			LastRequest:  stats.LastRequest,
+			InFlight:     stats.InFlight,
+			Timeouts:     stats.Timeouts,
+			RPS:          stats.window.rate(now),
 		}
 	}
 	return copyStats
 }
-
-func (rs *RequestStatsService) ScaleDownUnusedContainers(idleDuration time.Duration) {
-	rs.log.Info("Checking for idle functions")
-	functionIDs, _ := rs.fs.GetAllActiveFunctions()
-	rs.mu.Lock()
-	defer rs.mu.Unlock()
-	currentTime := time.Now()
-	for _, function := range functionIDs {
-		rs.log.Infof("Checking function ID  %s", function.ExternalId)
-		if stats, exists := rs.functionStats[function.ExternalId]; exists {
-			rs.log.Infof("Stats for function '%s', LastRequest: '%s', ReqCount: '%d'", function.ExternalId, stats.LastRequest.String(), stats.RequestCount)
-			// We only turn off functions if they are beyond the idle duration
-			if currentTime.Sub(stats.LastRequest) > idleDuration && stats.RequestCount > 0 {
-				rs.log.Infof("Found idle function '%s', LastRequest: '%s', ReqCount: '%d'", function.ExternalId, stats.LastRequest, stats.RequestCount)
-				rs.ds.StopContainerForFunction(function.ExternalId)
-				rs.ResetRequestCount(function.ExternalId, true)
-			}
-		}
-	}
-}
@@ -0,0 +1,42 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jwtly10/jambda/internal/logging"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestRpsWindow(t *testing.T) {
+	var window rpsWindow
+	start := time.Unix(1000, 0)
+
+	for i := 0; i < 30; i++ {
+		window.record(start)
+	}
+	for i := 0; i < 30; i++ {
+		window.record(start.Add(10 * time.Second))
+	}
+	assert.Equal(t, 2.0, window.rate(start.Add(10*time.Second)))
+
+	// The first bucket has left the window
+	assert.Equal(t, 1.0, window.rate(start.Add(35*time.Second)))
+
+	// Everything has left the window
+	assert.Equal(t, 0.0, window.rate(start.Add(2*time.Minute)))
+}
+
+func TestRecordTimeout(t *testing.T) {
+	rs := NewRequestStatsService(logging.NewLogger(false, zapcore.DebugLevel))
+	rs.TrackFunction("fn")
+	rs.IncrementRequestCount("fn")
+	rs.RecordTimeout("fn")
+	rs.RecordTimeout("fn")
+	rs.ResetRequestCount("fn", false)
+
+	assert.Equal(t, 2, rs.GetTimeouts("fn"))
+	assert.Equal(t, 2, rs.GetFunctionStats()["fn"].Timeouts)
+	assert.Equal(t, 0, rs.GetTimeouts("other"))
+}
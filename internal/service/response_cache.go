@@ -0,0 +1,238 @@
+package service
+
+import (
+	"container/list"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jwtly10/jambda/api/data"
+	"github.com/jwtly10/jambda/internal/logging"
+)
+
+// MaxCachedResponse is the largest response body cached, so one response can't push the rest out of the cache
+const MaxCachedResponse = 1 << 20
+
+// cacheableStatus are the status codes cached, those a response to a GET means the same for every client
+var cacheableStatus = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMovedPermanently:     true,
+	http.StatusNotFound:             true,
+	http.StatusGone:                 true,
+}
+
+// CachedResponse is a function's response served again by the gateway
+type CachedResponse struct {
+	Status  int
+	Header  http.Header
+	Body    []byte
+	Stored  time.Time
+	Expires time.Time
+}
+
+// CachePurge is the result of purging a function's cached responses
+type CachePurge struct {
+	FunctionId string `json:"function_id"`
+	Purged     int    `json:"purged"`
+}
+
+type cacheEntry struct {
+	key        string
+	functionId string
+	response   *CachedResponse
+	size       int64
+}
+
+// ResponseCacheService holds responses of functions in memory, evicting the least recently used once it's over its size
+type ResponseCacheService struct {
+	log      logging.Logger
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	// lru has the most recently used entries at the front
+	lru     *list.List
+	entries map[string]*list.Element
+}
+
+func NewResponseCacheService(log logging.Logger, maxBytes int64) *ResponseCacheService {
+	return &ResponseCacheService{
+		log:      log,
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+// Get returns the response cached under key, if it hasn't expired
+func (rc *ResponseCacheService) Get(key string, now time.Time) (*CachedResponse, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	elem, exists := rc.entries[key]
+	if !exists {
+		return nil, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if !now.Before(entry.response.Expires) {
+		rc.remove(elem)
+		return nil, false
+	}
+	rc.lru.MoveToFront(elem)
+	return entry.response, true
+}
+
+// Put caches the response of the function under key, replacing any response already cached under it
+func (rc *ResponseCacheService) Put(functionId string, key string, response *CachedResponse) {
+	size := int64(len(key) + len(response.Body))
+	for name, values := range response.Header {
+		size += int64(len(name))
+		for _, value := range values {
+			size += int64(len(value))
+		}
+	}
+	if size > rc.maxBytes {
+		return
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if elem, exists := rc.entries[key]; exists {
+		rc.remove(elem)
+	}
+	rc.entries[key] = rc.lru.PushFront(&cacheEntry{key: key, functionId: functionId, response: response, size: size})
+	rc.size += size
+
+	for rc.size > rc.maxBytes {
+		rc.remove(rc.lru.Back())
+	}
+}
+
+// Purge removes every cached response of the function, returning how many there were
+func (rc *ResponseCacheService) Purge(functionId string) int {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	purged := 0
+	for elem := rc.lru.Front(); elem != nil; {
+		next := elem.Next()
+		if elem.Value.(*cacheEntry).functionId == functionId {
+			rc.remove(elem)
+			purged++
+		}
+		elem = next
+	}
+	if purged > 0 {
+		rc.log.Infof("Purged %d cached responses of function '%s'", purged, functionId)
+	}
+	return purged
+}
+
+func (rc *ResponseCacheService) remove(elem *list.Element) {
+	entry := rc.lru.Remove(elem).(*cacheEntry)
+	delete(rc.entries, entry.key)
+	rc.size -= entry.size
+}
+
+// CacheKey is where the response to the request is cached, with a variant for each value of the config's vary headers
+func CacheKey(functionId string, r *http.Request, config data.CacheConfig) string {
+	var key strings.Builder
+	key.WriteString(functionId)
+	key.WriteString(" ")
+	key.WriteString(r.URL.RequestURI())
+	for _, name := range config.Vary {
+		key.WriteString("\n")
+		key.WriteString(http.CanonicalHeaderKey(name))
+		key.WriteString(": ")
+		key.WriteString(strings.Join(r.Header.Values(name), ", "))
+	}
+	return key.String()
+}
+
+// ResponseTTL returns how long the function's response to the request can be cached, and false if it can't be.
+// The function's Cache-Control wins over the config's ttl, and responses it marks private or no-store are never cached.
+func ResponseTTL(r *http.Request, status int, header http.Header, config data.CacheConfig) (time.Duration, bool) {
+	if !cacheableStatus[status] || header.Get("Set-Cookie") != "" {
+		return 0, false
+	}
+	// Streams don't end, so never fit in the cache
+	if strings.HasPrefix(header.Get("Content-Type"), "text/event-stream") {
+		return 0, false
+	}
+
+	// Responses can only vary on headers that are part of the cache key
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			if !varies(config, strings.TrimSpace(name)) {
+				return 0, false
+			}
+		}
+	}
+
+	cc := ParseCacheControl(header)
+	if cc.Has("no-store") || cc.Has("no-cache") || cc.Has("private") {
+		return 0, false
+	}
+	// Responses to authenticated requests are only shared when the function says they can be
+	if r.Header.Get("Authorization") != "" && !cc.Has("public") && !cc.Has("s-maxage") {
+		return 0, false
+	}
+
+	ttl := config.TTL.Std()
+	if seconds, ok := cc.Seconds("s-maxage"); ok {
+		ttl = seconds
+	} else if seconds, ok := cc.Seconds("max-age"); ok {
+		ttl = seconds
+	}
+	return ttl, ttl > 0
+}
+
+func varies(config data.CacheConfig, name string) bool {
+	if name == "" {
+		return true
+	}
+	for _, vary := range config.Vary {
+		if strings.EqualFold(vary, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// CacheControl holds the directives of Cache-Control headers, by lower case name
+type CacheControl map[string]string
+
+func ParseCacheControl(header http.Header) CacheControl {
+	cc := CacheControl{}
+	for _, value := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			if name != "" {
+				cc[strings.ToLower(name)] = strings.Trim(arg, `"`)
+			}
+		}
+	}
+	return cc
+}
+
+func (cc CacheControl) Has(directive string) bool {
+	_, ok := cc[directive]
+	return ok
+}
+
+// Seconds returns the duration of a directive like max-age, and false if it's missing or invalid
+func (cc CacheControl) Seconds(directive string) (time.Duration, bool) {
+	arg, ok := cc[directive]
+	if !ok {
+		return 0, false
+	}
+	seconds, err := strconv.Atoi(arg)
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jwtly10/jambda/api/data"
+	"github.com/jwtly10/jambda/internal/logging"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zapcore"
+)
+
+func cachedBody(body string, now time.Time) *CachedResponse {
+	return &CachedResponse{Status: http.StatusOK, Header: http.Header{}, Body: []byte(body), Stored: now, Expires: now.Add(time.Minute)}
+}
+
+func TestResponseCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	rc := NewResponseCacheService(logging.NewLogger(false, zapcore.DebugLevel), 30)
+	now := time.Now()
+
+	rc.Put("fn", "a", cachedBody("0123456789", now))
+	rc.Put("fn", "b", cachedBody("0123456789", now))
+	// Using a makes b the least recently used
+	_, ok := rc.Get("a", now)
+	assert.True(t, ok)
+	rc.Put("fn", "c", cachedBody("0123456789", now))
+
+	_, ok = rc.Get("a", now)
+	assert.True(t, ok)
+	_, ok = rc.Get("b", now)
+	assert.False(t, ok, "b should have been evicted")
+	_, ok = rc.Get("c", now)
+	assert.True(t, ok)
+
+	// Larger than the whole cache
+	rc.Put("fn", "d", cachedBody("0123456789012345678901234567890", now))
+	_, ok = rc.Get("d", now)
+	assert.False(t, ok)
+}
+
+func TestResponseCacheExpiresAndPurges(t *testing.T) {
+	rc := NewResponseCacheService(logging.NewLogger(false, zapcore.DebugLevel), 1<<20)
+	now := time.Now()
+
+	rc.Put("fn", "fn a", cachedBody("a", now))
+	rc.Put("fn", "fn b", cachedBody("b", now))
+	rc.Put("other", "other a", cachedBody("a", now))
+
+	_, ok := rc.Get("fn a", now.Add(time.Minute))
+	assert.False(t, ok, "expired responses aren't served")
+
+	assert.Equal(t, 1, rc.Purge("fn"))
+	_, ok = rc.Get("fn b", now)
+	assert.False(t, ok)
+	_, ok = rc.Get("other a", now)
+	assert.True(t, ok)
+}
+
+func TestCacheKeyVaries(t *testing.T) {
+	config := data.CacheConfig{TTL: data.Duration(time.Hour), Vary: []string{"accept"}}
+	json := httptest.NewRequest(http.MethodGet, "/v1/api/execute/fn/weather?city=london", nil)
+	json.Header.Set("Accept", "application/json")
+	text := httptest.NewRequest(http.MethodGet, "/v1/api/execute/fn/weather?city=london", nil)
+	text.Header.Set("Accept", "text/plain")
+	other := httptest.NewRequest(http.MethodGet, "/v1/api/execute/fn/weather?city=paris", nil)
+	other.Header.Set("Accept", "application/json")
+
+	assert.NotEqual(t, CacheKey("fn", json, config), CacheKey("fn", text, config))
+	assert.NotEqual(t, CacheKey("fn", json, config), CacheKey("fn", other, config))
+	assert.NotEqual(t, CacheKey("fn", json, config), CacheKey("other", json, config))
+	assert.Equal(t, CacheKey("fn", json, config), CacheKey("fn", json.Clone(json.Context()), config))
+}
+
+func TestResponseTTL(t *testing.T) {
+	config := data.CacheConfig{TTL: data.Duration(time.Hour), Vary: []string{"Accept"}}
+
+	tests := []struct {
+		name          string
+		authorization string
+		status        int
+		header        http.Header
+		wantTTL       time.Duration
+		wantOk        bool
+	}{
+		{"uses the config ttl", "", 200, http.Header{}, time.Hour, true},
+		{"max-age wins over the config", "", 200, http.Header{"Cache-Control": {"public, max-age=60"}}, time.Minute, true},
+		{"s-maxage wins over max-age", "", 200, http.Header{"Cache-Control": {"max-age=60, s-maxage=30"}}, 30 * time.Second, true},
+		{"max-age of 0", "", 200, http.Header{"Cache-Control": {"max-age=0"}}, 0, false},
+		{"no-store", "", 200, http.Header{"Cache-Control": {"no-store"}}, 0, false},
+		{"private", "", 200, http.Header{"Cache-Control": {"private, max-age=60"}}, 0, false},
+		{"uncacheable status", "", 500, http.Header{}, 0, false},
+		{"not found is cached", "", 404, http.Header{}, time.Hour, true},
+		{"sets a cookie", "", 200, http.Header{"Set-Cookie": {"session=abc"}}, 0, false},
+		{"varies on a configured header", "", 200, http.Header{"Vary": {"accept"}}, time.Hour, true},
+		{"varies on another header", "", 200, http.Header{"Vary": {"Accept, Cookie"}}, 0, false},
+		{"varies on everything", "", 200, http.Header{"Vary": {"*"}}, 0, false},
+		{"authenticated", "Bearer abc", 200, http.Header{}, 0, false},
+		{"authenticated and public", "Bearer abc", 200, http.Header{"Cache-Control": {"public"}}, time.Hour, true},
+		{"event stream", "", 200, http.Header{"Content-Type": {"text/event-stream"}}, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/v1/api/execute/fn/", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			ttl, ok := ResponseTTL(r, tt.status, tt.header, config)
+			assert.Equal(t, tt.wantOk, ok)
+			if tt.wantOk {
+				assert.Equal(t, tt.wantTTL, ttl)
+			}
+		})
+	}
+}
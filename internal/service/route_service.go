@@ -0,0 +1,303 @@
+package service
+
+import (
+	"database/sql"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/jwtly10/jambda/api/data"
+	"github.com/jwtly10/jambda/internal/errors"
+	"github.com/jwtly10/jambda/internal/logging"
+	"github.com/jwtly10/jambda/internal/repository"
+	"github.com/lib/pq"
+)
+
+// reservedPrefixes are never matched by routes, so a catch all route can't hide jambda's own api
+var reservedPrefixes = []string{"/v1/api", "/swagger"}
+
+// RouteMatch is where a request matched by a route is sent
+type RouteMatch struct {
+	FunctionId string
+	// Path is forwarded to the function, with the route's prefix removed unless it keeps it
+	Path string
+}
+
+// RouteService holds the routes table in memory, ordered from most to least specific.
+// The active function of each name routes refer to is cached with them, until functions change.
+type RouteService struct {
+	log    logging.Logger
+	repo   repository.IRouteRepository
+	fr     repository.IFunctionRepository
+	mu     sync.RWMutex
+	routes []data.RouteEntity
+	// aliases maps function names to their active function id, "" when none is active
+	aliases map[string]string
+	// generation changes whenever aliases are cleared, so lookups racing a change aren't cached
+	generation int
+}
+
+func NewRouteService(log logging.Logger, repo repository.IRouteRepository, fr repository.IFunctionRepository) *RouteService {
+	return &RouteService{
+		log:     log,
+		repo:    repo,
+		fr:      fr,
+		aliases: make(map[string]string),
+	}
+}
+
+// Load reads the routes table from the database, replacing the routes in memory
+func (rs *RouteService) Load() error {
+	routes, err := rs.repo.GetAllRoutes()
+	if err != nil {
+		return errors.NewInternalError(fmt.Sprintf("error retrieving routes from db: %v", err))
+	}
+
+	aliases := make(map[string]string)
+	for _, route := range routes {
+		if route.FunctionName == "" {
+			continue
+		}
+		if _, ok := aliases[route.FunctionName]; ok {
+			continue
+		}
+		functionId, err := rs.repo.GetActiveFunctionIdByName(route.FunctionName)
+		if err != nil {
+			return errors.NewInternalError(fmt.Sprintf("error resolving function name '%s' from db: %v", route.FunctionName, err))
+		}
+		aliases[route.FunctionName] = functionId
+	}
+
+	rs.mu.Lock()
+	rs.aliases = aliases
+	rs.generation++
+	rs.mu.Unlock()
+	rs.setRoutes(routes)
+	rs.log.Infof("Loaded %d routes", len(routes))
+	return nil
+}
+
+// ClearAliases forgets the cached function ids of names, so they're looked up again.
+// It must be called whenever a function is created, deleted or recreated.
+func (rs *RouteService) ClearAliases() {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.aliases = make(map[string]string)
+	rs.generation++
+}
+
+func (rs *RouteService) GetRoutes() []data.RouteEntity {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	routes := make([]data.RouteEntity, len(rs.routes))
+	copy(routes, rs.routes)
+	sort.Slice(routes, func(i, j int) bool { return routes[i].ID < routes[j].ID })
+	return routes
+}
+
+func (rs *RouteService) CreateRoute(route data.RouteEntity) (*data.RouteEntity, error) {
+	if err := rs.validateRoute(&route); err != nil {
+		return nil, err
+	}
+
+	saved, err := rs.repo.SaveRoute(route)
+	if err != nil {
+		return nil, routeSaveError(route, err)
+	}
+	return saved, rs.Load()
+}
+
+func (rs *RouteService) UpdateRoute(id int, route data.RouteEntity) (*data.RouteEntity, error) {
+	if err := rs.validateRoute(&route); err != nil {
+		return nil, err
+	}
+
+	updated, err := rs.repo.UpdateRoute(id, route)
+	if err != nil {
+		return nil, routeSaveError(route, err)
+	}
+	if updated == nil {
+		return nil, errors.NewNotFoundError(fmt.Sprintf("route '%d' not found", id))
+	}
+	return updated, rs.Load()
+}
+
+func (rs *RouteService) DeleteRoute(id int) error {
+	err := rs.repo.DeleteRoute(id)
+	if err == sql.ErrNoRows {
+		return errors.NewNotFoundError(fmt.Sprintf("route '%d' not found", id))
+	}
+	if err != nil {
+		return errors.NewInternalError(fmt.Sprintf("error deleting route from db: %v", err))
+	}
+	return rs.Load()
+}
+
+// Match returns the function of the most specific route matching the host and path.
+// Routes for a host win over routes for any host, then longer path prefixes win.
+// An error is returned when the function of a route's name can't be looked up.
+func (rs *RouteService) Match(host string, path string) (*RouteMatch, bool, error) {
+	for _, prefix := range reservedPrefixes {
+		if matchesPrefix(path, prefix) {
+			return nil, false, nil
+		}
+	}
+
+	rs.mu.RLock()
+	var route *data.RouteEntity
+	for i := range rs.routes {
+		if matchesHost(host, rs.routes[i].Host) && matchesPrefix(path, rs.routes[i].PathPrefix) {
+			route = &rs.routes[i]
+			break
+		}
+	}
+	rs.mu.RUnlock()
+	if route == nil {
+		return nil, false, nil
+	}
+
+	functionId := route.FunctionId
+	if route.FunctionName != "" {
+		var err error
+		functionId, err = rs.resolveAlias(route.FunctionName)
+		if err != nil {
+			return nil, false, errors.NewUnavailableError(fmt.Sprintf("error resolving function name '%s' of route '%d': %v", route.FunctionName, route.ID, err))
+		}
+		if functionId == "" {
+			rs.log.Warn("Route alias has no active function", "route", route.ID, "function_name", route.FunctionName)
+			return nil, false, nil
+		}
+	}
+
+	forwardPath := path
+	if !route.KeepPrefix && route.PathPrefix != "/" {
+		forwardPath = strings.TrimPrefix(path, route.PathPrefix)
+		if !strings.HasPrefix(forwardPath, "/") {
+			forwardPath = "/" + forwardPath
+		}
+	}
+	return &RouteMatch{FunctionId: functionId, Path: forwardPath}, true, nil
+}
+
+// resolveAlias returns the cached active function id of the name, looking it up when it isn't cached
+func (rs *RouteService) resolveAlias(name string) (string, error) {
+	rs.mu.RLock()
+	functionId, ok := rs.aliases[name]
+	generation := rs.generation
+	rs.mu.RUnlock()
+	if ok {
+		return functionId, nil
+	}
+
+	functionId, err := rs.repo.GetActiveFunctionIdByName(name)
+	if err != nil {
+		return "", err
+	}
+	rs.mu.Lock()
+	if rs.generation == generation {
+		rs.aliases[name] = functionId
+	}
+	rs.mu.Unlock()
+	return functionId, nil
+}
+
+// HasHost returns whether a route matches the host exactly, so certificates are only issued for custom domains
+func (rs *RouteService) HasHost(host string) bool {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	for _, route := range rs.routes {
+		if route.Host != "" && matchesHost(host, route.Host) {
+			return true
+		}
+	}
+	return false
+}
+
+func (rs *RouteService) setRoutes(routes []data.RouteEntity) {
+	sorted := make([]data.RouteEntity, len(routes))
+	copy(sorted, routes)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if (sorted[i].Host != "") != (sorted[j].Host != "") {
+			return sorted[i].Host != ""
+		}
+		return len(sorted[i].PathPrefix) > len(sorted[j].PathPrefix)
+	})
+
+	rs.mu.Lock()
+	rs.routes = sorted
+	rs.mu.Unlock()
+}
+
+// validateRoute checks the route and normalises its host and path prefix, e.g "weather/*" becomes "/weather"
+func (rs *RouteService) validateRoute(route *data.RouteEntity) error {
+	route.Host = strings.ToLower(strings.TrimSpace(route.Host))
+	if strings.ContainsAny(route.Host, "/*") {
+		return errors.NewValidationError(fmt.Sprintf("invalid host '%s'; must be a host name like 'api.home.lan'", route.Host))
+	}
+
+	prefix := strings.TrimSuffix(strings.TrimSpace(route.PathPrefix), "*")
+	if !strings.HasPrefix(prefix, "/") {
+		prefix = "/" + prefix
+	}
+	if prefix != "/" {
+		prefix = strings.TrimSuffix(prefix, "/")
+	}
+	if strings.Contains(prefix, "*") {
+		return errors.NewValidationError(fmt.Sprintf("invalid path_prefix '%s'; only a trailing '/*' is supported", route.PathPrefix))
+	}
+	for _, reserved := range reservedPrefixes {
+		if matchesPrefix(prefix, reserved) {
+			return errors.NewValidationError(fmt.Sprintf("path_prefix '%s' is reserved for jambda", reserved))
+		}
+	}
+	// jambda's UI is served from "/", so only a host's whole domain can be routed
+	if prefix == "/" && route.Host == "" {
+		return errors.NewValidationError("path_prefix '/' needs a host, so the route doesn't hide jambda's UI")
+	}
+	route.PathPrefix = prefix
+
+	if (route.FunctionId == "") == (route.FunctionName == "") {
+		return errors.NewValidationError("exactly one of function_id or function_name must be set")
+	}
+	if route.FunctionId != "" {
+		function, err := rs.fr.GetFunctionEntityFromExternalId(route.FunctionId)
+		if err != nil {
+			return errors.NewInternalError(fmt.Sprintf("error getting function from db: %v", err))
+		}
+		if function == nil {
+			return errors.NewValidationError(fmt.Sprintf("function '%s' does not exist", route.FunctionId))
+		}
+	}
+	return nil
+}
+
+func routeSaveError(route data.RouteEntity, err error) error {
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+		return errors.NewValidationError(fmt.Sprintf("a route for host '%s' and path_prefix '%s' already exists", route.Host, route.PathPrefix))
+	}
+	return errors.NewInternalError(fmt.Sprintf("error saving route to db: %v", err))
+}
+
+// matchesHost compares without the port, unless the route's host has one
+func matchesHost(requestHost string, routeHost string) bool {
+	if routeHost == "" {
+		return true
+	}
+	requestHost = strings.ToLower(requestHost)
+	if !strings.Contains(routeHost, ":") {
+		if host, _, err := net.SplitHostPort(requestHost); err == nil {
+			requestHost = host
+		}
+	}
+	return requestHost == routeHost
+}
+
+// matchesPrefix matches whole path segments, so "/weather" matches "/weather/today" but not "/weathervane"
+func matchesPrefix(path string, prefix string) bool {
+	if prefix == "/" {
+		return true
+	}
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
@@ -0,0 +1,172 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/jwtly10/jambda/api/data"
+	"github.com/jwtly10/jambda/internal/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zapcore"
+)
+
+type fakeRouteRepository struct {
+	routes []data.RouteEntity
+	// functions maps active function names to their ids
+	functions map[string]string
+	lookups   int
+	lookupErr error
+}
+
+func (f *fakeRouteRepository) GetAllRoutes() ([]data.RouteEntity, error) {
+	return f.routes, nil
+}
+
+func (f *fakeRouteRepository) SaveRoute(route data.RouteEntity) (*data.RouteEntity, error) {
+	route.ID = len(f.routes) + 1
+	f.routes = append(f.routes, route)
+	return &route, nil
+}
+
+func (f *fakeRouteRepository) UpdateRoute(id int, route data.RouteEntity) (*data.RouteEntity, error) {
+	for i := range f.routes {
+		if f.routes[i].ID == id {
+			route.ID = id
+			f.routes[i] = route
+			return &route, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeRouteRepository) DeleteRoute(id int) error {
+	for i := range f.routes {
+		if f.routes[i].ID == id {
+			f.routes = append(f.routes[:i], f.routes[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (f *fakeRouteRepository) GetActiveFunctionIdByName(name string) (string, error) {
+	f.lookups++
+	if f.lookupErr != nil {
+		return "", f.lookupErr
+	}
+	return f.functions[name], nil
+}
+
+func TestRouteServiceMatch(t *testing.T) {
+	logger := logging.NewLogger(false, zapcore.DebugLevel)
+	repo := &fakeRouteRepository{
+		routes: []data.RouteEntity{
+			{ID: 1, PathPrefix: "/weather", FunctionId: "weather1"},
+			{ID: 2, PathPrefix: "/weather/radar", FunctionId: "radar1", KeepPrefix: true},
+			{ID: 3, Host: "api.home.lan", PathPrefix: "/", FunctionName: "api"},
+			{ID: 4, Host: "api.home.lan", PathPrefix: "/weather", FunctionId: "apiweath"},
+			{ID: 5, Host: "old.home.lan", PathPrefix: "/", FunctionName: "deleted"},
+		},
+		functions: map[string]string{"api": "api12345"},
+	}
+	rs := NewRouteService(logger, repo, nil)
+	require.NoError(t, rs.Load())
+
+	tests := []struct {
+		name       string
+		host       string
+		path       string
+		found      bool
+		functionId string
+		forward    string
+	}{
+		{name: "path prefix is removed", host: "localhost:8080", path: "/weather/today", found: true, functionId: "weather1", forward: "/today"},
+		{name: "exact prefix forwards root", host: "localhost:8080", path: "/weather", found: true, functionId: "weather1", forward: "/"},
+		{name: "longer prefix wins and keeps prefix", host: "localhost", path: "/weather/radar/uk", found: true, functionId: "radar1", forward: "/weather/radar/uk"},
+		{name: "prefix matches whole segments", host: "localhost", path: "/weathervane", found: false},
+		{name: "host route wins over any host", host: "API.home.lan:8080", path: "/weather/today", found: true, functionId: "apiweath", forward: "/today"},
+		{name: "alias resolves active function", host: "api.home.lan", path: "/users/1", found: true, functionId: "api12345", forward: "/users/1"},
+		{name: "alias without active function", host: "old.home.lan", path: "/other", found: false},
+		{name: "jambda api is reserved", host: "api.home.lan", path: "/v1/api/function", found: false},
+		{name: "swagger is reserved", host: "api.home.lan", path: "/swagger/index.html", found: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, found, err := rs.Match(tt.host, tt.path)
+			require.NoError(t, err)
+			assert.Equal(t, tt.found, found)
+			if tt.found {
+				assert.Equal(t, tt.functionId, match.FunctionId)
+				assert.Equal(t, tt.forward, match.Path)
+			}
+		})
+	}
+}
+
+func TestRouteServiceValidation(t *testing.T) {
+	logger := logging.NewLogger(false, zapcore.DebugLevel)
+	repo := &fakeRouteRepository{}
+	rs := NewRouteService(logger, repo, nil)
+
+	created, err := rs.CreateRoute(data.RouteEntity{Host: " API.Home.lan ", PathPrefix: "weather/*", FunctionName: "weather"})
+	require.NoError(t, err)
+	assert.Equal(t, "api.home.lan", created.Host)
+	assert.Equal(t, "/weather", created.PathPrefix)
+	assert.Len(t, rs.GetRoutes(), 1)
+
+	_, err = rs.CreateRoute(data.RouteEntity{PathPrefix: "/v1/api/execute", FunctionName: "weather"})
+	assert.Error(t, err)
+
+	_, err = rs.CreateRoute(data.RouteEntity{PathPrefix: "/*", FunctionName: "weather"})
+	assert.Error(t, err)
+
+	_, err = rs.CreateRoute(data.RouteEntity{PathPrefix: "/a/*/b", FunctionName: "weather"})
+	assert.Error(t, err)
+
+	_, err = rs.CreateRoute(data.RouteEntity{PathPrefix: "/weather"})
+	assert.Error(t, err)
+
+	_, err = rs.CreateRoute(data.RouteEntity{PathPrefix: "/weather", FunctionId: "abc", FunctionName: "weather"})
+	assert.Error(t, err)
+
+	_, err = rs.UpdateRoute(99, data.RouteEntity{PathPrefix: "/weather", FunctionName: "weather"})
+	assert.Error(t, err)
+
+	assert.NoError(t, rs.DeleteRoute(created.ID))
+	assert.Empty(t, rs.GetRoutes())
+}
+
+func TestRouteServiceAliasCache(t *testing.T) {
+	logger := logging.NewLogger(false, zapcore.DebugLevel)
+	repo := &fakeRouteRepository{
+		routes:    []data.RouteEntity{{ID: 1, Host: "api.home.lan", PathPrefix: "/", FunctionName: "api"}},
+		functions: map[string]string{"api": "api12345"},
+	}
+	rs := NewRouteService(logger, repo, nil)
+	require.NoError(t, rs.Load())
+	assert.Equal(t, 1, repo.lookups)
+
+	for i := 0; i < 3; i++ {
+		match, found, err := rs.Match("api.home.lan", "/")
+		require.NoError(t, err)
+		require.True(t, found)
+		assert.Equal(t, "api12345", match.FunctionId)
+	}
+	assert.Equal(t, 1, repo.lookups, "resolved ids should be cached")
+
+	// Recreating the function changes its id
+	repo.functions["api"] = "api67890"
+	rs.ClearAliases()
+	match, found, err := rs.Match("api.home.lan", "/")
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, "api67890", match.FunctionId)
+	assert.Equal(t, 2, repo.lookups)
+
+	repo.lookupErr = assert.AnError
+	rs.ClearAliases()
+	_, found, err = rs.Match("api.home.lan", "/")
+	assert.Error(t, err)
+	assert.False(t, found)
+}
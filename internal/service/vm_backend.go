@@ -0,0 +1,325 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jwtly10/jambda/api/data"
+	"github.com/jwtly10/jambda/internal/errors"
+	"github.com/jwtly10/jambda/internal/logging"
+)
+
+const (
+	vmInstancePrefix = "vm-"
+
+	// vmBootTimeout bounds booting a single VM, health checking happens after
+	vmBootTimeout = 30 * time.Second
+)
+
+// vmInstance is a single microVM running a function's bootstrap binary
+type vmInstance struct {
+	id         string
+	functionId string
+	config     data.FunctionConfig
+	vm         *VM
+	state      string
+	startedAt  time.Time
+	finishedAt time.Time
+	exitCode   int
+	// exited is closed once the VM's exit has been recorded
+	exited chan struct{}
+}
+
+// VMBackend runs each instance of a function in its own microVM, for functions with isolation 'vm'.
+// The guest has its own kernel and address, so the function is reached directly on its configured port.
+type VMBackend struct {
+	log         logging.Logger
+	registry    *ContainerRegistry
+	manager     VMManager
+	binariesDir string
+	mu          sync.Mutex
+	instances   map[string]*vmInstance
+	nextId      int
+}
+
+func NewVMBackend(log logging.Logger, registry *ContainerRegistry, manager VMManager, binariesDir string) *VMBackend {
+	return &VMBackend{
+		log:         log,
+		registry:    registry,
+		manager:     manager,
+		binariesDir: binariesDir,
+		instances:   make(map[string]*vmInstance),
+	}
+}
+
+// StartInstance boots a VM for the function, reusing the id of an exited VM where possible
+func (vb *VMBackend) StartInstance(ctx context.Context, functionId string, config data.FunctionConfig) (string, error) {
+	vb.mu.Lock()
+	defer vb.mu.Unlock()
+
+	var inst *vmInstance
+	for _, existing := range vb.instances {
+		if existing.functionId == functionId && existing.state == ContainerStateExited {
+			inst = existing
+			break
+		}
+	}
+	if inst == nil {
+		vb.nextId++
+		inst = &vmInstance{
+			id:         fmt.Sprintf("%s%s-%d", vmInstancePrefix, functionId, vb.nextId),
+			functionId: functionId,
+		}
+	}
+	inst.config = config
+	inst.config.EnvVars = withInvocationEnv(ctx, config.EnvVars)
+
+	if err := vb.boot(ctx, inst); err != nil {
+		return "", err
+	}
+	vb.instances[inst.id] = inst
+	return inst.id, nil
+}
+
+// WaitForRunning returns straight away for a running VM, as the guest's readiness is left to the health check
+func (vb *VMBackend) WaitForRunning(ctx context.Context, instanceId string) error {
+	inst, err := vb.getInstance(instanceId)
+	if err != nil {
+		return err
+	}
+
+	vb.mu.Lock()
+	defer vb.mu.Unlock()
+	if inst.state != ContainerStateRunning {
+		return errors.NewDockerError(fmt.Sprintf("vm '%s' exited with code %d", instanceId, inst.exitCode))
+	}
+	return nil
+}
+
+func (vb *VMBackend) GetEndpoint(ctx context.Context, instanceId string, config data.FunctionConfig) (string, error) {
+	inst, err := vb.getInstance(instanceId)
+	if err != nil {
+		return "", err
+	}
+
+	vb.mu.Lock()
+	defer vb.mu.Unlock()
+	return fmt.Sprintf("http://%s:%d", inst.vm.Address, *inst.config.Port), nil
+}
+
+// HealthCheck waits for the guest to pass its health check, failing early if the VM exits
+func (vb *VMBackend) HealthCheck(ctx context.Context, instanceId string, config data.FunctionConfig) error {
+	inst, err := vb.getInstance(instanceId)
+	if err != nil {
+		return err
+	}
+
+	vb.mu.Lock()
+	url := fmt.Sprintf("http://%s:%d", inst.vm.Address, *inst.config.Port)
+	done := inst.vm.Done()
+	vb.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return waitUntilHealthy(ctx, vb.log, instanceId, url, config)
+}
+
+func (vb *VMBackend) Restart(ctx context.Context, instanceId string) error {
+	if err := vb.Stop(instanceId); err != nil {
+		return err
+	}
+
+	vb.mu.Lock()
+	defer vb.mu.Unlock()
+	inst, exists := vb.instances[instanceId]
+	if !exists {
+		return errors.NewNotFoundError(fmt.Sprintf("vm '%s' not found", instanceId))
+	}
+	// The invocation that cold started the instance didn't trigger this start
+	inst.config.EnvVars = withoutInvocationEnv(inst.config.EnvVars)
+	if err := vb.boot(ctx, inst); err != nil {
+		return err
+	}
+	vb.log.Infof("Restarted vm %s", instanceId)
+	return nil
+}
+
+// Stop shuts the guest down, the VM manager kills it if it doesn't shut down in time
+func (vb *VMBackend) Stop(instanceId string) error {
+	inst, err := vb.getInstance(instanceId)
+	if err != nil {
+		return err
+	}
+
+	vb.mu.Lock()
+	if inst.state != ContainerStateRunning {
+		vb.mu.Unlock()
+		return nil
+	}
+	vb.registry.ExpectStop(instanceId)
+	exited := inst.exited
+	vb.mu.Unlock()
+
+	if err := vb.manager.Shutdown(context.Background(), instanceId); err != nil {
+		return errors.NewDockerError(fmt.Sprintf("error shutting down vm: %v", err))
+	}
+	<-exited
+	vb.log.Infof("Stopped vm %s", instanceId)
+	return nil
+}
+
+func (vb *VMBackend) StopFunction(functionId string) {
+	vb.log.Infof("Stopping vms for function '%s' ", functionId)
+	running, _ := vb.ListRunning(context.Background(), functionId)
+	for _, instanceId := range running {
+		if err := vb.Stop(instanceId); err != nil {
+			vb.log.Errorf("Failed to stop vm %s: %v", instanceId, err)
+		}
+	}
+}
+
+func (vb *VMBackend) Remove(ctx context.Context, instanceId string) error {
+	inst, err := vb.getInstance(instanceId)
+	if err != nil {
+		return err
+	}
+	if err := vb.Stop(instanceId); err != nil {
+		return err
+	}
+
+	vb.mu.Lock()
+	delete(vb.instances, instanceId)
+	vb.mu.Unlock()
+
+	vb.registry.ContainerDestroyed(inst.functionId, instanceId, time.Now())
+	vb.log.Infof("Removed vm %s", instanceId)
+	return nil
+}
+
+func (vb *VMBackend) ListRunning(ctx context.Context, functionId string) ([]string, error) {
+	vb.mu.Lock()
+	defer vb.mu.Unlock()
+	ids := []string{}
+	for _, inst := range vb.instances {
+		if inst.functionId == functionId && inst.state == ContainerStateRunning {
+			ids = append(ids, inst.id)
+		}
+	}
+	return ids, nil
+}
+
+func (vb *VMBackend) ListInstances(ctx context.Context) ([]ContainerRecord, error) {
+	vb.mu.Lock()
+	defer vb.mu.Unlock()
+	records := make([]ContainerRecord, 0, len(vb.instances))
+	for _, inst := range vb.instances {
+		records = append(records, inst.record())
+	}
+	return records, nil
+}
+
+// Logs returns the guest's serial console, which the function's output is written to
+func (vb *VMBackend) Logs(ctx context.Context, instanceId string, tail int) (string, error) {
+	inst, err := vb.getInstance(instanceId)
+	if err != nil {
+		return "", err
+	}
+
+	vb.mu.Lock()
+	defer vb.mu.Unlock()
+	return inst.vm.Logs(tail), nil
+}
+
+// boot starts the VM for an instance, it must be called with the lock held
+func (vb *VMBackend) boot(ctx context.Context, inst *vmInstance) error {
+	if !strings.Contains(inst.config.Image, "golang") || inst.config.Port == nil {
+		return errors.NewValidationError(fmt.Sprintf("function '%s' must be a golang function with a port to run in a vm", inst.functionId))
+	}
+
+	binary, err := filepath.Abs(filepath.Join(vb.binariesDir, inst.functionId, "bootstrap"))
+	if err != nil {
+		return errors.NewInternalError(fmt.Sprintf("error resolving binary path: %v", err))
+	}
+	if _, err := os.Stat(binary); err != nil {
+		return errors.NewNotFoundError(fmt.Sprintf("binary for function '%s' not found: %v", inst.functionId, err))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, vmBootTimeout)
+	defer cancel()
+	vm, err := vb.manager.Boot(ctx, VMSpec{
+		Id:         inst.id,
+		FunctionId: inst.functionId,
+		Binary:     binary,
+		Port:       *inst.config.Port,
+		Env:        inst.config.EnvVars,
+	})
+	if err != nil {
+		vb.log.Error("Failed to boot vm: ", err)
+		return errors.NewDockerError(fmt.Sprintf("error booting vm: %v", err))
+	}
+	vb.log.Infof("Booted vm '%s' for function '%s' on %s", inst.id, inst.functionId, vm.Address)
+
+	inst.vm = vm
+	inst.state = ContainerStateRunning
+	inst.startedAt = time.Now()
+	inst.finishedAt = time.Time{}
+	inst.exitCode = 0
+	inst.exited = make(chan struct{})
+
+	vb.registry.ContainerStarted(inst.record())
+	go vb.wait(inst, vm, inst.exited)
+	return nil
+}
+
+// wait records the exit of a VM, reporting it to the registry like a container dying
+func (vb *VMBackend) wait(inst *vmInstance, vm *VM, exited chan struct{}) {
+	<-vm.Done()
+	exitCode := vm.ExitCode()
+	now := time.Now()
+
+	vb.mu.Lock()
+	inst.state = ContainerStateExited
+	inst.finishedAt = now
+	inst.exitCode = exitCode
+	vb.mu.Unlock()
+
+	vb.registry.ContainerDied(inst.functionId, inst.id, exitCode, now)
+	close(exited)
+}
+
+func (vb *VMBackend) getInstance(instanceId string) (*vmInstance, error) {
+	vb.mu.Lock()
+	defer vb.mu.Unlock()
+	inst, exists := vb.instances[instanceId]
+	if !exists {
+		return nil, errors.NewNotFoundError(fmt.Sprintf("vm '%s' not found", instanceId))
+	}
+	return inst, nil
+}
+
+// record must be called with the lock held
+func (inst *vmInstance) record() ContainerRecord {
+	port := fmt.Sprintf("%d", *inst.config.Port)
+	return ContainerRecord{
+		ContainerId: inst.id,
+		FunctionId:  inst.functionId,
+		State:       inst.state,
+		Ports:       map[string]string{port + "/tcp": port},
+		StartedAt:   inst.startedAt,
+		FinishedAt:  inst.finishedAt,
+		ExitCode:    inst.exitCode,
+	}
+}
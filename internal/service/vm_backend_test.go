@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jwtly10/jambda/api/data"
+	"github.com/jwtly10/jambda/internal/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestVMBackendLifecycle(t *testing.T) {
+	logger := logging.NewLogger(false, zapcore.DebugLevel)
+	registry := NewContainerRegistry(logger)
+	manager := newFakeVMManager()
+	binariesDir := t.TempDir()
+	backend := NewVMBackend(logger, registry, manager, binariesDir)
+	port := 8080
+	config := data.FunctionConfig{Image: "golang:1.22", Port: &port, Isolation: data.IsolationVM, EnvVars: map[string]string{"GREETING": "hello"}}
+	ctx := context.Background()
+
+	writeBootstrap(t, binariesDir, "fn", "exit 0\n")
+
+	instanceId, err := backend.StartInstance(ctx, "fn", config)
+	require.NoError(t, err)
+	assert.Equal(t, "vm-fn-1", instanceId)
+	assert.NoError(t, backend.WaitForRunning(ctx, instanceId))
+	require.Len(t, manager.Booted, 1)
+	assert.Equal(t, 8080, manager.Booted[0].Port)
+	assert.Equal(t, "hello", manager.Booted[0].Env["GREETING"])
+
+	endpoint, err := backend.GetEndpoint(ctx, instanceId, config)
+	assert.NoError(t, err)
+	assert.Equal(t, "http://127.0.0.1:8080", endpoint)
+
+	logs, err := backend.Logs(ctx, instanceId, 0)
+	assert.NoError(t, err)
+	assert.Contains(t, logs, "booted")
+
+	// Stops requested by jambda are not crashes
+	assert.NoError(t, backend.Stop(instanceId))
+	record, found := registry.GetContainer(instanceId)
+	assert.True(t, found)
+	assert.Equal(t, ContainerStateExited, record.State)
+	assert.Empty(t, registry.GetFunctionContainers("fn").Crashes)
+
+	// The exited VM's id is reused for the next instance
+	restarted, err := backend.StartInstance(ctx, "fn", config)
+	require.NoError(t, err)
+	assert.Equal(t, instanceId, restarted)
+
+	// A guest stopping by itself is a crash
+	require.NoError(t, manager.Crash(instanceId, 1))
+	assert.Eventually(t, func() bool {
+		return len(registry.GetFunctionContainers("fn").Crashes) == 1
+	}, time.Second, 10*time.Millisecond)
+	assert.Error(t, backend.WaitForRunning(ctx, instanceId))
+
+	assert.NoError(t, backend.Remove(ctx, instanceId))
+	records, err := backend.ListInstances(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, records)
+}
+
+func TestIsolationRouter(t *testing.T) {
+	logger := logging.NewLogger(false, zapcore.DebugLevel)
+	registry := NewContainerRegistry(logger)
+	binariesDir := t.TempDir()
+	containers := NewProcessBackend(logger, registry, binariesDir, ProcessSandbox{})
+	vms := NewVMBackend(logger, registry, newFakeVMManager(), binariesDir)
+	port := 8080
+	config := data.FunctionConfig{Image: "golang:1.22", Port: &port, Isolation: data.IsolationVM}
+	ctx := context.Background()
+
+	writeBootstrap(t, binariesDir, "fn", "exit 0\n")
+
+	router := NewIsolationRouter(containers, vms)
+	instanceId, err := router.StartInstance(ctx, "fn", config)
+	require.NoError(t, err)
+	assert.Equal(t, "vm-fn-1", instanceId)
+
+	running, err := router.ListRunning(ctx, "fn")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{instanceId}, running)
+
+	endpoint, err := router.GetEndpoint(ctx, instanceId, config)
+	assert.NoError(t, err)
+	assert.Equal(t, "http://127.0.0.1:8080", endpoint)
+	assert.NoError(t, router.Stop(instanceId))
+
+	// Without a vm backend, vm functions are rejected rather than run in a container
+	_, err = NewIsolationRouter(containers, nil).StartInstance(ctx, "fn", config)
+	assert.Error(t, err)
+}
+
+func TestFirecrackerConfig(t *testing.T) {
+	host, guest := vmAddresses(0)
+	assert.Equal(t, "172.16.0.1", host.String())
+	assert.Equal(t, "172.16.0.2", guest.String())
+
+	host, guest = vmAddresses(70)
+	assert.Equal(t, "172.16.1.25", host.String())
+	assert.Equal(t, "172.16.1.26", guest.String())
+
+	config := firecrackerConfig(FirecrackerConfig{KernelImage: "/vmlinux", RootfsImage: "/rootfs.ext4", VCPUs: 1, MemoryMB: 256}, "/vm/function.ext4", "jfc70", host, guest)
+	assert.Equal(t, "console=ttyS0 reboot=k panic=1 pci=off ip=172.16.1.26::172.16.1.25:255.255.255.252::eth0:off", config.BootSource.BootArgs)
+	require.Len(t, config.Drives, 2)
+	assert.True(t, config.Drives[0].IsRootDevice)
+	assert.Equal(t, "/vm/function.ext4", config.Drives[1].PathOnHost)
+	assert.Equal(t, "06:00:ac:10:01:1a", config.NetworkInterfaces[0].GuestMac)
+	assert.Equal(t, "jfc70", config.NetworkInterfaces[0].HostDevName)
+
+	env := vmEnvFile(VMSpec{Port: 9000, Env: map[string]string{"B": "2", "A": "1"}})
+	assert.Equal(t, "PORT=9000\nA=1\nB=2\n", env)
+}
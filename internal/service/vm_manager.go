@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"sync"
+)
+
+// VMSpec describes a microVM running a single instance of a function
+type VMSpec struct {
+	Id         string
+	FunctionId string
+	// Binary is the host path of the function's bootstrap binary, copied into the guest
+	Binary string
+	// Port is what the function listens on inside the guest, it's reached on the guest's own address
+	Port int
+	Env  map[string]string
+}
+
+// VMManager boots and shuts down the microVMs of the vm isolation tier
+type VMManager interface {
+	// Boot creates and boots a VM running the spec's binary, returning once the VM has been started
+	Boot(ctx context.Context, spec VMSpec) (*VM, error)
+	// Shutdown asks the guest to shut down, killing the VM if it hasn't within a timeout, and waits for it to exit
+	Shutdown(ctx context.Context, id string) error
+}
+
+// VM is a booted microVM
+type VM struct {
+	Id string
+	// Address is the guest's ip, the function's port is reached on it directly
+	Address string
+
+	mu       sync.Mutex
+	done     chan struct{}
+	exitCode int
+	console  *logBuffer
+}
+
+func newVM(id string, address string) *VM {
+	return &VM{
+		Id:      id,
+		Address: address,
+		done:    make(chan struct{}),
+		console: newLogBuffer(maxProcessLogBytes),
+	}
+}
+
+// Done is closed once the VM has exited
+func (vm *VM) Done() <-chan struct{} {
+	return vm.done
+}
+
+// ExitCode is the exit code of the VM process, only set once Done is closed
+func (vm *VM) ExitCode() int {
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+	return vm.exitCode
+}
+
+// Logs returns the last tail lines of the guest's serial console, or all of it if tail is 0
+func (vm *VM) Logs(tail int) string {
+	return vm.console.Tail(tail)
+}
+
+func (vm *VM) exited(exitCode int) {
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+	select {
+	case <-vm.done:
+		return
+	default:
+	}
+	vm.exitCode = exitCode
+	close(vm.done)
+}
@@ -0,0 +1,114 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.25.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	ExporterNone   = ""
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+	ExporterFile   = "file"
+)
+
+// tracerName is the instrumentation scope of jambda's own spans
+const tracerName = "github.com/jwtly10/jambda"
+
+// Attributes set on jambda's spans
+const (
+	FunctionIdKey   = attribute.Key("jambda.function_id")
+	ContainerIdKey  = attribute.Key("jambda.container_id")
+	InvocationIdKey = attribute.Key("jambda.invocation_id")
+)
+
+type Config struct {
+	// Exporter is where spans are sent, either 'otlp', 'stdout' or 'file', tracing is disabled when empty
+	Exporter string
+	// Endpoint is the OTLP/HTTP url spans are sent to, e.g 'http://localhost:4318', defaults to OTEL_EXPORTER_OTLP_ENDPOINT
+	Endpoint string
+	// File spans are appended to as JSON
+	File string
+	// SampleRatio is the fraction of new traces sampled, traces started by clients follow their sampling decision
+	SampleRatio float64
+}
+
+// Setup registers the global tracer provider exporting to the configured exporter, and the W3C trace context propagator.
+// The returned shutdown flushes any spans not yet exported.
+func Setup(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+	// Propagated even without an exporter, so traces of clients carry on into functions
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var file *os.File
+	var err error
+	switch cfg.Exporter {
+	case ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		var opts []otlptracehttp.Option
+		if cfg.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpointURL(cfg.Endpoint))
+		}
+		exporter, err = otlptracehttp.New(ctx, opts...)
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	case ExporterFile:
+		file, err = os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("error opening trace file: %v", err)
+		}
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(file))
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter '%s', must be 'otlp', 'stdout' or 'file'", cfg.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error creating %s trace exporter: %v", cfg.Exporter, err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName("jambda")))
+	if err != nil {
+		return nil, fmt.Errorf("error creating trace resource: %v", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if file != nil {
+			file.Close()
+		}
+		return err
+	}, nil
+}
+
+// Tracer returns the tracer of jambda's spans, from the global tracer provider
+func Tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// End ends the span, marking it as failed when err isn't nil
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
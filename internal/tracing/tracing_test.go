@@ -0,0 +1,36 @@
+package tracing
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+)
+
+func TestSetupExportsToFile(t *testing.T) {
+	provider := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(provider) })
+
+	file := filepath.Join(t.TempDir(), "traces.json")
+	shutdown, err := Setup(context.Background(), Config{Exporter: ExporterFile, File: file, SampleRatio: 1})
+	require.NoError(t, err)
+
+	_, span := Tracer().Start(context.Background(), "function.cold_start")
+	span.SetAttributes(FunctionIdKey.String("fn"))
+	span.End()
+	require.NoError(t, shutdown(context.Background()))
+
+	contents, err := os.ReadFile(file)
+	require.NoError(t, err)
+	assert.Contains(t, string(contents), `"Name":"function.cold_start"`)
+	assert.Contains(t, string(contents), `"jambda.function_id"`)
+}
+
+func TestSetupRejectsUnknownExporter(t *testing.T) {
+	_, err := Setup(context.Background(), Config{Exporter: "jaeger"})
+	assert.EqualError(t, err, "unknown tracing exporter 'jaeger', must be 'otlp', 'stdout' or 'file'")
+}
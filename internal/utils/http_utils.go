@@ -3,8 +3,11 @@ package utils
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/jwtly10/jambda/internal/errors"
 )
@@ -42,6 +45,24 @@ func HandleValidationError(w http.ResponseWriter, err error) {
 	WriteErrorResponse(w, statusCode, errorResponse)
 }
 
+func HandleBadGateway(w http.ResponseWriter, err error) {
+	statusCode := http.StatusBadGateway
+	errorResponse := ErrorResponse{Error: "BAD_GATEWAY", Message: err.Error()}
+	WriteErrorResponse(w, statusCode, errorResponse)
+}
+
+func HandleGatewayTimeout(w http.ResponseWriter, err error) {
+	statusCode := http.StatusGatewayTimeout
+	errorResponse := ErrorResponse{Error: "GATEWAY_TIMEOUT", Message: err.Error()}
+	WriteErrorResponse(w, statusCode, errorResponse)
+}
+
+func HandlePayloadTooLarge(w http.ResponseWriter, err error) {
+	statusCode := http.StatusRequestEntityTooLarge
+	errorResponse := ErrorResponse{Error: "PAYLOAD_TOO_LARGE", Message: err.Error()}
+	WriteErrorResponse(w, statusCode, errorResponse)
+}
+
 func HandleCustomErrors(w http.ResponseWriter, err error) {
 	var statusCode int
 	var errorResponse ErrorResponse
@@ -56,6 +77,16 @@ func HandleCustomErrors(w http.ResponseWriter, err error) {
 	case *errors.ValidationError:
 		statusCode = http.StatusBadRequest
 		errorResponse = ErrorResponse{Error: "VALIDATION_ERROR", Message: e.Error()}
+	case *errors.RateLimitError:
+		statusCode = http.StatusTooManyRequests
+		errorResponse = ErrorResponse{Error: "TOO_MANY_REQUESTS", Message: e.Error()}
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(e.RetryAfter)))
+	case *errors.UnavailableError:
+		statusCode = http.StatusServiceUnavailable
+		errorResponse = ErrorResponse{Error: "SERVICE_UNAVAILABLE", Message: e.Error()}
+		if e.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(e.RetryAfter)))
+		}
 	case *errors.InternalError:
 		statusCode = http.StatusInternalServerError
 		errorResponse = ErrorResponse{Error: "INTERNAL_SERVER_ERROR", Message: e.Error()}
@@ -67,6 +98,15 @@ func HandleCustomErrors(w http.ResponseWriter, err error) {
 	WriteErrorResponse(w, statusCode, errorResponse)
 }
 
+// retryAfterSeconds rounds up to whole seconds, as clients retrying early would be rejected again
+func retryAfterSeconds(d time.Duration) int {
+	seconds := int(math.Ceil(d.Seconds()))
+	if seconds < 1 {
+		return 1
+	}
+	return seconds
+}
+
 func capitalizeFirstLetter(s string) string {
 	if len(s) == 0 {
 		return s
@@ -7,6 +7,7 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/jwtly10/jambda/internal/errors"
 )
@@ -181,6 +182,20 @@ func TestHandleCustomErrors(t *testing.T) {
 			expectedError:   "INTERNAL_SERVER_ERROR",
 			expectedMessage: "internal error",
 		},
+		{
+			name:            "Rate limit error",
+			inputError:      &errors.RateLimitError{Message: "rate limited", RetryAfter: 1500 * time.Millisecond},
+			expectedCode:    http.StatusTooManyRequests,
+			expectedError:   "TOO_MANY_REQUESTS",
+			expectedMessage: "rate limited",
+		},
+		{
+			name:            "Unavailable error",
+			inputError:      &errors.UnavailableError{Message: "queue full"},
+			expectedCode:    http.StatusServiceUnavailable,
+			expectedError:   "SERVICE_UNAVAILABLE",
+			expectedMessage: "queue full",
+		},
 		{
 			name:            "Unknown error",
 			inputError:      fmt.Errorf("unknown error"),
@@ -217,3 +232,19 @@ func TestHandleCustomErrors(t *testing.T) {
 		})
 	}
 }
+
+func TestHandleRateLimitErrorSetsRetryAfter(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	HandleCustomErrors(recorder, errors.NewRateLimitError("daily quota exceeded", 1500*time.Millisecond))
+
+	if got := recorder.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("expected Retry-After '2', got '%s'", got)
+	}
+
+	recorder = httptest.NewRecorder()
+	HandleCustomErrors(recorder, errors.NewRateLimitError("rate limited", 0))
+
+	if got := recorder.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("expected Retry-After '1', got '%s'", got)
+	}
+}
@@ -2,12 +2,15 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
 	"time"
 
 	"github.com/jwtly10/jambda/api"
+	"github.com/jwtly10/jambda/api/data"
 	"github.com/jwtly10/jambda/api/handlers"
 	"github.com/jwtly10/jambda/api/middleware"
 	"github.com/jwtly10/jambda/api/routes"
@@ -17,6 +20,7 @@ import (
 	"github.com/jwtly10/jambda/internal/logging"
 	"github.com/jwtly10/jambda/internal/repository"
 	"github.com/jwtly10/jambda/internal/service"
+	"github.com/jwtly10/jambda/internal/tracing"
 	"github.com/spf13/afero"
 	"go.uber.org/zap/zapcore"
 )
@@ -31,6 +35,11 @@ import (
 // @host localhost:8080
 // @BasePath /v1/api
 func main() {
+	// The process backend runs jambda again to launch sandboxed functions, which takes over this process
+	if service.IsSandboxLauncher() {
+		service.RunSandboxLauncher()
+	}
+
 	logger := logging.NewLogger(false, zapcore.DebugLevel)
 
 	fs := afero.NewOsFs()
@@ -41,6 +50,20 @@ func main() {
 		panic("Unable to load config")
 	}
 
+	// Spans of requests to functions are exported, and their trace context propagated into functions
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		Exporter:    cfg.TracingExporter,
+		Endpoint:    cfg.TracingEndpoint,
+		File:        cfg.TracingFile,
+		SampleRatio: cfg.TracingSampleRatio,
+	})
+	if err != nil {
+		logger.Fatalf("Failed to setup tracing: %v", err)
+	}
+	if cfg.TracingExporter != "" {
+		logger.Infof("Exporting traces with the '%s' exporter", cfg.TracingExporter)
+	}
+
 	db, err := db.ConnectDB(cfg)
 	if err != nil {
 		logger.Fatal("Database connection failed:", err)
@@ -53,7 +76,9 @@ func main() {
 
 	// Setup global middleware
 	loggerMw := &middleware.RequestLoggerMiddleware{Log: logger}
-	router.Use(loggerMw)
+	// Registered last so it runs first, giving the request logger the invocation id
+	invocationMw := middleware.NewInvocationMiddleware(logger)
+	router.Use(loggerMw, invocationMw)
 
 	router.SetupSwagger()
 	router.ServeStaticFiles("./jambda-frontend/dist")
@@ -63,22 +88,119 @@ func main() {
 	functionRepo := repository.NewFunctionRepository(db)
 
 	fileService := service.NewFileService(functionRepo, logger, fs, *configValidator)
-	gatewayService := service.NewGatewayService(logger)
+	circuitBreakerService := service.NewCircuitBreakerService(logger)
+	gatewayService := service.NewGatewayService(logger, cfg.DefaultFunctionTimeout, circuitBreakerService)
 	functionService := service.NewFunctionService(functionRepo, logger, *fileService, *configValidator)
-	dockerService := service.NewDockerService(logger, *functionRepo)
+	containerRegistry := service.NewContainerRegistry(logger)
+	containerRuntime, err := service.NewContainerRuntime(cfg.ContainerRuntime, cfg.ContainerHost)
+	if err != nil {
+		logger.Fatalf("Invalid container runtime: %v", err)
+	}
+	dockerService := service.NewDockerService(logger, *functionRepo, containerRegistry, containerRuntime)
 
-	requestStatsService := service.NewRequestStatsService(logger, *dockerService, *functionService)
-	// This spins up a background check to scale down up any unused containers
-	go func() {
-		for {
-			time.Sleep(5 * time.Minute)
-			requestStatsService.ScaleDownUnusedContainers(30 * time.Minute)
+	// Function instances run as docker containers, kubernetes deployments, or as local processes on machines without a docker daemon
+	var backend service.ExecutionBackend
+	switch cfg.ExecutionBackend {
+	case service.BackendDocker:
+		backend = dockerService
+		// Keep track of every function container from the docker events stream
+		containerWatcherService := service.NewContainerWatcherService(logger, *dockerService, containerRegistry)
+		go containerWatcherService.Run()
+	case service.BackendProcess:
+		backend = service.NewProcessBackend(logger, containerRegistry, service.BinariesDir, service.ProcessSandbox{
+			User:         cfg.ProcessUser,
+			MaxMemory:    uint64(max(cfg.ProcessMaxMemory, 0)),
+			MaxProcesses: uint64(max(cfg.ProcessMaxProcesses, 0)),
+		})
+	case service.BackendKubernetes:
+		client, err := service.NewKubernetesClient(cfg.Kubeconfig)
+		if err != nil {
+			logger.Fatalf("Failed to connect to kubernetes: %v", err)
 		}
+		backend = service.NewKubernetesBackend(logger, client, cfg.KubernetesNamespace, cfg.KubernetesArtifactUrl)
+	default:
+		logger.Fatalf("Unknown execution backend '%s', must be 'docker', 'process' or 'kubernetes'", cfg.ExecutionBackend)
+	}
+	logger.Infof("Running functions with the '%s' execution backend", cfg.ExecutionBackend)
+
+	// Functions with isolation 'vm' run in firecracker microVMs instead, when a kernel and rootfs are configured
+	var vmBackend service.ExecutionBackend
+	if cfg.VMKernelImage != "" && cfg.VMRootfsImage != "" {
+		vmManager := service.NewFirecrackerManager(logger, service.FirecrackerConfig{
+			Binary:      cfg.FirecrackerBinary,
+			KernelImage: cfg.VMKernelImage,
+			RootfsImage: cfg.VMRootfsImage,
+		})
+		vmBackend = service.NewVMBackend(logger, containerRegistry, vmManager, service.BinariesDir)
+		logger.Info("VM isolation is enabled")
+	}
+	backend = service.NewIsolationRouter(backend, vmBackend)
+
+	instancePoolService := service.NewInstancePoolService(logger, backend)
+	// Drop instances from the pool as soon as they exit
+	containerRegistry.OnContainerExit(instancePoolService.RemoveContainer)
+
+	requestStatsService := service.NewRequestStatsService(logger)
+	// This spins up a background scheduler to scale down any functions past their idle timeout
+	idleScheduler := service.NewIdleScheduler(logger, instancePoolService, requestStatsService, cfg.DefaultIdleTimeout)
+	instancePoolService.OnInstanceAdded(idleScheduler.Notify)
+	go idleScheduler.Run()
+
+	// This scales warm functions between their min and max instances based on load
+	autoscalerService := service.NewAutoscalerService(logger, instancePoolService, requestStatsService)
+	go autoscalerService.Run(2 * time.Second)
+
+	// Restart warm instances that stop passing their liveness checks
+	healthMonitorService := service.NewHealthMonitorService(logger, instancePoolService)
+	go healthMonitorService.Run()
+	// Check instances straight away when proxied requests to them fail
+	gatewayService.OnUpstreamError(healthMonitorService.Recheck)
+	gatewayService.OnTimeout(requestStatsService.RecordTimeout)
+	// Replace the containers requests kept failing to reach once a function's circuit opens
+	circuitBreakerService.OnOpen(instancePoolService.RecreateInstances)
+
+	// Custom domains and path routes are matched before the execute path
+	routeRepo := repository.NewRouteRepository(db)
+	routeService := service.NewRouteService(logger, routeRepo, functionRepo)
+	if err := routeService.Load(); err != nil {
+		logger.Fatalf("Failed to load routes: %v", err)
+	}
+
+	// Clean up containers of deleted functions, and adopt any left running from before a restart
+	reconcilerService := service.NewReconcilerService(logger, instancePoolService, backend, *functionService, requestStatsService)
+	// Cached responses of a function are dropped when it's updated or deleted
+	responseCacheService := service.NewResponseCacheService(logger, cfg.ResponseCacheSize)
+	// and the functions routes refer to by name are looked up again
+	functionService.OnDelete(func(functionId string) {
+		responseCacheService.Purge(functionId)
+		routeService.ClearAliases()
+		reconcilerService.RemoveFunction(functionId)
+	})
+	go func() {
+		reconcilerService.Reconcile()
+		reconcilerService.Run(cfg.ReconcileInterval)
 	}()
 
+	// Keep warm instances running from boot, and after every deploy
+	prewarmService := service.NewPrewarmService(logger, instancePoolService, *dockerService, *functionService)
+	functionService.OnDeploy(func(functionId string, config data.FunctionConfig) {
+		responseCacheService.Purge(functionId)
+		routeService.ClearAliases()
+		prewarmService.WarmDeployedFunction(functionId, config)
+	})
+	prewarmService.WarmActiveFunctions()
+
 	// Setup specific middlewares
-	dockerMw := middleware.NewDockerMiddleware(logger, *dockerService)
+	dockerMw := middleware.NewDockerMiddleware(logger, *dockerService, instancePoolService)
 	usageMw := middleware.NewUsageMiddleware(logger, requestStatsService)
+	rateLimitService := service.NewRateLimitService(logger)
+	go rateLimitService.Run(10 * time.Minute)
+	rateLimitMw := middleware.NewRateLimitMiddleware(logger, *dockerService, rateLimitService)
+	cacheMw := middleware.NewCacheMiddleware(logger, *dockerService, responseCacheService)
+	circuitBreakerMw := middleware.NewCircuitBreakerMiddleware(logger, *dockerService, circuitBreakerService)
+	tracingMw := middleware.NewTracingMiddleware(logger)
+
+	routesMw := middleware.NewRoutesMiddleware(logger, routeService)
 
 	// Setup routes
 
@@ -86,23 +208,107 @@ func main() {
 	fileHandler := handlers.NewFunctionHandler(logger, *functionService)
 	routes.NewFunctionRoutes(router, logger, *fileHandler)
 
+	// Scaling routes
+	scalingHandler := handlers.NewScalingHandler(logger, autoscalerService, prewarmService)
+	routes.NewScalingRoutes(router, logger, *scalingHandler)
+
+	// Container routes
+	containerHandler := handlers.NewContainerHandler(logger, containerRegistry, backend)
+	routes.NewContainerRoutes(router, logger, *containerHandler)
+
 	// Gateway routes
-	gatewayHandler := handlers.NewGatewayHandler(logger, *gatewayService)
-	routes.NewGatewayRoutes(router, logger, *gatewayHandler, dockerMw, usageMw)
+	gatewayHandler := handlers.NewGatewayHandler(logger, gatewayService)
+	routes.NewGatewayRoutes(router, logger, *gatewayHandler, dockerMw, usageMw, circuitBreakerMw, cacheMw, rateLimitMw, tracingMw)
+
+	// Cache routes
+	cacheHandler := handlers.NewCacheHandler(logger, responseCacheService)
+	routes.NewCacheRoutes(router, logger, *cacheHandler)
+
+	// Route routes
+	routeHandler := handlers.NewRouteHandler(logger, routeService)
+	routes.NewRouteRoutes(router, logger, *routeHandler)
+
+	// Routes are matched before anything else
+	handler := routesMw.BeforeNext(router)
+
+	// HTTPS serves certificates from files, and from the ACME server for the hosts of routes
+	var tlsConfig *tls.Config
+	var acmeChallengeMw *middleware.AcmeChallengeMiddleware
+	if cfg.HTTPSAddr != "" {
+		var fileCert *service.FileCertificate
+		if cfg.TLSCertFile != "" {
+			fileCert, err = service.NewFileCertificate(logger, cfg.TLSCertFile, cfg.TLSKeyFile)
+			if err != nil {
+				logger.Fatalf("Failed to load TLS certificate: %v", err)
+			}
+			go fileCert.Run(10 * time.Second)
+		}
+
+		var acmeService *service.AcmeService
+		if cfg.AcmeDirectoryUrl != "" {
+			challengeProvider := service.NewHTTP01Provider()
+			acmeService, err = service.NewAcmeService(logger, service.AcmeConfig{
+				DirectoryUrl: cfg.AcmeDirectoryUrl,
+				Email:        cfg.AcmeEmail,
+				CacheDir:     cfg.AcmeCacheDir,
+				CAFile:       cfg.AcmeCAFile,
+			}, challengeProvider, func(host string) bool {
+				return slices.Contains(cfg.AcmeDomains, host) || routeService.HasHost(host)
+			})
+			if err != nil {
+				logger.Fatalf("Failed to setup ACME: %v", err)
+			}
+			go acmeService.Run(12 * time.Hour)
+			acmeChallengeMw = middleware.NewAcmeChallengeMiddleware(challengeProvider)
+		}
 
-	// Start server
-	server := &http.Server{
-		Addr:    ":8080",
-		Handler: router,
+		if fileCert == nil && acmeService == nil {
+			logger.Fatal("HTTPS_ADDR is set without TLS_CERT_FILE or ACME_DIRECTORY_URL")
+		}
+		tlsConfig = service.NewTLSConfig(fileCert, acmeService)
+	}
+
+	// Start servers
+	httpHandler := handler
+	if acmeChallengeMw != nil {
+		httpHandler = acmeChallengeMw.BeforeNext(handler)
 	}
+	servers := []*http.Server{{
+		Addr:              cfg.HTTPAddr,
+		Handler:           httpHandler,
+		ReadHeaderTimeout: cfg.ServerReadHeaderTimeout,
+		ReadTimeout:       cfg.ServerReadTimeout,
+		WriteTimeout:      cfg.ServerWriteTimeout,
+		IdleTimeout:       cfg.ServerIdleTimeout,
+	}}
 
 	go func() {
-		logger.Info("Starting server on port 8080")
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		logger.Infof("Starting server on %s", cfg.HTTPAddr)
+		if err := servers[0].ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			logger.Error("Error starting server", err)
 		}
 	}()
 
+	if tlsConfig != nil {
+		httpsServer := &http.Server{
+			Addr:              cfg.HTTPSAddr,
+			Handler:           handler,
+			TLSConfig:         tlsConfig,
+			ReadHeaderTimeout: cfg.ServerReadHeaderTimeout,
+			ReadTimeout:       cfg.ServerReadTimeout,
+			WriteTimeout:      cfg.ServerWriteTimeout,
+			IdleTimeout:       cfg.ServerIdleTimeout,
+		}
+		servers = append(servers, httpsServer)
+
+		go func() {
+			logger.Infof("Starting HTTPS server on %s", cfg.HTTPSAddr)
+			if err := httpsServer.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
+				logger.Error("Error starting HTTPS server", err)
+			}
+		}()
+	}
+
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt)
 	<-quit
@@ -111,8 +317,15 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	if err := server.Shutdown(ctx); err != nil {
-		logger.Error("Error shutting down server", err)
+	for _, server := range servers {
+		if err := server.Shutdown(ctx); err != nil {
+			logger.Error("Error shutting down server", err)
+		}
+	}
+
+	// Flush spans not yet exported
+	if err := shutdownTracing(ctx); err != nil {
+		logger.Error("Error shutting down tracing", err)
 	}
 
 	logger.Info("Server gracefully stopped")
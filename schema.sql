@@ -9,3 +9,16 @@ CREATE TABLE functions_tb
     updated_at    TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
+CREATE TABLE routes_tb
+(
+    id            SERIAL PRIMARY KEY,
+    host          VARCHAR(255) NOT NULL DEFAULT '',
+    path_prefix   VARCHAR(255) NOT NULL DEFAULT '/',
+    function_id   VARCHAR(8)   NOT NULL DEFAULT '',
+    function_name VARCHAR(255) NOT NULL DEFAULT '',
+    keep_prefix   BOOLEAN      NOT NULL DEFAULT FALSE,
+    created_at    TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at    TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (host, path_prefix)
+);
+